@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/digest"
+	"github.com/mkorenkov/covid-19/pkg/mailer"
+	"github.com/pkg/errors"
+)
+
+// digestCommand sends the daily digest right away: coviddy digest [--to a@example.com,b@example.com] [--at 2020-06-01T08:00:00Z] [--dry-run [--out dir]].
+func digestCommand(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	to := flags.String("to", strings.Join(cfg.DigestRecipients, ","), "comma separated recipients")
+	dryRun := flags.Bool("dry-run", false, "write the email to disk instead of sending it")
+	out := flags.String("out", ".", "directory --dry-run writes the email to")
+	at := flags.String("at", "", "build the digest as of this RFC3339 time instead of now")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	recipients := []string{}
+	for _, r := range strings.Split(*to, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	if len(recipients) == 0 && !*dryRun {
+		return errors.New("no recipients, set COVIDDY_DIGEST_RECIPIENTS or --to")
+	}
+	schedule, err := digest.ParseSchedule(cfg.DigestAt, cfg.DigestTimezone)
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(dbPath(cfg.Storage), 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "error opening DB, make sure the daemon is stopped")
+	}
+	defer db.Close()
+
+	now := time.Now()
+	if *at != "" {
+		if now, err = time.Parse(time.RFC3339, *at); err != nil {
+			return errors.Wrapf(err, "invalid --at %s", *at)
+		}
+	}
+	m, err := digest.Message(db, now, schedule.Location, digest.OptionsFromConfig(cfg), recipients)
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		if err := mailer.Send(mailer.FromConfig(cfg), m); err != nil {
+			return err
+		}
+		log.Printf("[INFO] Sent the daily digest to %d recipients\n", len(recipients))
+		return nil
+	}
+
+	payload, err := m.Bytes(cfg.SMTPFrom, now)
+	if err != nil {
+		return err
+	}
+	fileName := filepath.Join(*out, "digest-"+now.In(schedule.Location).Format("2006-01-02")+".eml")
+	if err := ioutil.WriteFile(fileName, payload, 0644); err != nil {
+		return errors.Wrapf(err, "error writing %s", fileName)
+	}
+	log.Printf("[INFO] Wrote the daily digest to %s\n", fileName)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/fsck"
+	"github.com/pkg/errors"
+)
+
+// fsckCommand checks DB integrity: coviddy fsck [--repair].
+func fsckCommand(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "remove dangling index entries, re-key datapoints and quarantine what can not be fixed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(dbPath(cfg.Storage), 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: !*repair})
+	if err != nil {
+		return errors.Wrap(err, "error opening DB, make sure the daemon is stopped")
+	}
+	defer db.Close()
+
+	report, err := fsck.Check(db, *repair)
+	if err != nil {
+		return errors.Wrap(err, "fsck failed")
+	}
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+	log.Printf("[INFO] Checked %d buckets, %d datapoints: %d problems, %d unrepaired\n", report.Buckets, report.Datapoints, len(report.Problems), report.Unrepaired())
+	if report.Unrepaired() > 0 {
+		return errors.Errorf("%d problems found, run with --repair to fix", report.Unrepaired())
+	}
+	return nil
+}
@@ -9,22 +9,34 @@ import (
 	"time"
 
 	"github.com/boltdb/bolt"
-	"github.com/gorilla/mux"
 	"github.com/hashicorp/logutils"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/mkorenkov/covid-19/pkg/auth"
 	"github.com/mkorenkov/covid-19/pkg/backup"
 	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/digest"
 	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/httpclient"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/mkorenkov/covid-19/pkg/mailer"
+	"github.com/mkorenkov/covid-19/pkg/metrics"
 	"github.com/mkorenkov/covid-19/pkg/reporter"
 	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/rules"
 	"github.com/mkorenkov/covid-19/pkg/scrapers"
 	"github.com/mkorenkov/covid-19/pkg/server"
+	"github.com/mkorenkov/covid-19/pkg/stream"
+	"github.com/mkorenkov/covid-19/pkg/validation"
+	"github.com/mkorenkov/covid-19/pkg/webhooks"
 	"github.com/pkg/errors"
 )
 
 const (
-	dbName         = "coviddy.db"
-	backupChanSize = 512
+	dbName                     = "coviddy.db"
+	backupChanSize             = 512
+	streamBufferSize           = 1024 // events buffered per stream client, a full scrape of countries and states fits
+	tokenLastUsedFlushInterval = 10 * time.Minute
 )
 
 func init() {
@@ -47,11 +59,77 @@ func ensureExists(dirName string) error {
 	return nil
 }
 
+func dbPath(storage config.Storage) string {
+	return path.Join(storage.StorageDir, dbName)
+}
+
+// snapshotTarget where DB snapshots are stored: COVIDDY_SNAPSHOT_DIR if set, S3 bucket otherwise.
+func snapshotTarget(storage config.Storage, s3 config.S3) backup.Target {
+	if storage.SnapshotDir != "" {
+		return backup.NewDirTarget(storage.SnapshotDir)
+	}
+	return backup.NewS3Target(backup.NewS3Client(s3), s3.GetBucket())
+}
+
+// rulesEngine loads alerting rules from COVIDDY_RULES_FILE, nil when it is not set.
+func rulesEngine(cfg config.Config, db *bolt.DB, dispatcher *webhooks.Dispatcher) (*rules.Engine, error) {
+	if cfg.RulesFile == "" {
+		return nil, nil
+	}
+	all, err := rules.Load(cfg.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+	notifiers := map[string]rules.Notifier{
+		rules.ReporterNotifier: rules.Reporter(),
+		rules.WebhookNotifier:  rules.Webhook(dispatcher),
+	}
+	if cfg.SMTPAddr != "" {
+		notifiers[rules.EmailNotifier] = rules.Email(mailer.FromConfig(cfg))
+	}
+	log.Printf("[INFO] Loaded %d alerting rules from %s\n", len(all), cfg.RulesFile)
+	return rules.New(db, all, notifiers)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := restoreCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	var cfg config.Config
 	if err := envconfig.Process("coviddy", &cfg); err != nil {
 		log.Fatal(err)
 	}
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "fsck":
+			err = fsckCommand(cfg, os.Args[2:])
+		case "quality":
+			err = qualityCommand(cfg, os.Args[2:])
+		case "rename":
+			err = renameCommand(cfg, false, os.Args[2:])
+		case "merge":
+			err = renameCommand(cfg, true, os.Args[2:])
+		case "digest":
+			err = digestCommand(cfg, os.Args[2:])
+		case "token":
+			err = tokenCommand(cfg, os.Args[2:])
+		default:
+			err = errors.Errorf("unknown command %s", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	serve(cfg)
+}
+
+func serve(cfg config.Config) {
 	if err := ensureExists(cfg.StorageDir); err != nil {
 		log.Fatal(err)
 	}
@@ -62,7 +140,12 @@ func main() {
 		log.Fatal(err)
 	}
 
-	myDB, err := bolt.Open(path.Join(cfg.StorageDir, dbName), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	validator, err := validation.New(cfg.ValidationLevels, cfg.ValidationSpikeSigma)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	myDB, err := bolt.Open(dbPath(cfg.Storage), 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -78,31 +161,55 @@ func main() {
 	errorsChan := make(chan error)
 	defer close(errorsChan)
 
-	rctx := requestcontext.New(cfg, myDB, errorsChan, backupChan)
+	rctx := requestcontext.New(cfg, myDB, errorsChan, backupChan, validator)
+	rctx.Latest = latest.New()
+	rctx.Health = health.NewTracker()
+	rctx.Stream = stream.NewBroker(streamBufferSize)
+	rctx.Webhooks = webhooks.NewDispatcher(myDB, rctx.Stream, httpclient.Default(), cfg.WebhookRetention)
+	validator.OnFlagged = rctx.Webhooks.Flagged
+	if rctx.Rules, err = rulesEngine(cfg, myDB, rctx.Webhooks); err != nil {
+		log.Fatal(err)
+	}
+	schedule, err := digest.ParseSchedule(cfg.DigestAt, cfg.DigestTimezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cfg.DigestRecipients) > 0 && cfg.SMTPAddr == "" {
+		log.Fatal(errors.New("COVIDDY_SMTP_ADDR is required to send the daily digest"))
+	}
+	if err := rctx.Latest.Load(myDB); err != nil {
+		log.Fatal(err)
+	}
 	ctx := requestcontext.WithContext(context.Background(), rctx)
 
+	metrics.Default.Register(
+		metrics.GaugeFunc("coviddy_backup_queue_depth", "Datapoints waiting for the S3 upload.", func() float64 { return float64(len(backupChan)) }),
+		metrics.GaugeFunc("coviddy_backup_queue_capacity", "Size of the S3 upload queue.", func() float64 { return float64(cap(backupChan)) }),
+		metrics.DBStats(myDB),
+		metrics.GaugeFunc("coviddy_stream_subscribers", "Clients connected to /api/v1/stream.", func() float64 { return float64(rctx.Stream.Subscribers()) }),
+	)
+	if cfg.MetricsLatestValues {
+		metrics.Default.Register(metrics.LatestValues(rctx.Latest, documents.CountryCollection, documents.StateCollection))
+	}
+
 	go reporter.ErrorReportingRoutine(errorsChan)
+	go rctx.Webhooks.Run(ctx, errorsChan)
 	go scrapers.States(ctx, cfg.ScrapeInterval, backupChan)
 	go scrapers.Countries(ctx, cfg.ScrapeInterval, backupChan)
 	go backup.ToS3(ctx, cfg, backupChan)
+	go backup.Snapshots(ctx, myDB, snapshotTarget(cfg.Storage, cfg.S3), cfg.SnapshotInterval)
+	go auth.FlushLastUsedEvery(ctx, myDB, tokenLastUsedFlushInterval, errorsChan)
+	if len(cfg.DigestRecipients) > 0 {
+		go digest.Run(ctx, myDB, mailer.FromConfig(cfg), cfg.DigestRecipients, schedule, digest.OptionsFromConfig(cfg))
+	}
 
-	b := server.NewBasicAuthMiddleware(cfg.Credentials)
-
-	r := mux.NewRouter()
-	r.HandleFunc("/", server.HomeHandler)
-
-	internal := r.PathPrefix("/api/internal/v1/").Subrouter()
-	internal.HandleFunc("/countries", server.UpsertAnythingHandler).Methods("POST")
-	internal.HandleFunc("/states", server.UpsertAnythingHandler).Methods("POST")
-	internal.HandleFunc("/import/country_or_state", server.UpsertAnythingHandler).Methods("POST")
-	internal.HandleFunc("/boltdb/import", server.BoltDBImportHandler).Methods("POST")
-	internal.Use(b.BasicAuth)
+	a := server.NewAuthMiddleware(cfg.Credentials)
+	l, err := server.NewRateLimitMiddleware(cfg.RateLimits, cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	api := r.PathPrefix("/api/v1/").Subrouter()
-	api.HandleFunc("/countries", server.ListCountriesHandler).Methods("GET")
-	api.HandleFunc("/states", server.ListStatesHandler).Methods("GET")
-	api.HandleFunc("/countries/{country}", server.CountryDatapointsHandler).Methods("GET")
-	api.HandleFunc("/states/{state}", server.StateDatapointsHandler).Methods("GET")
+	r := server.NewRouter(server.Guards{Require: a.Require, Identify: a.Identify, Limit: l.Limit, LimitAuth: l.LimitFailedAuth})
 
 	log.Printf("[INFO] Listening %s\n", cfg.ListenAddr)
 
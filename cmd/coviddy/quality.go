@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/quality"
+	"github.com/pkg/errors"
+)
+
+// qualityCommand prints the data quality report: coviddy quality [--days 30] [--all] [--json].
+func qualityCommand(cfg config.Config, args []string) error {
+	thresholds := quality.ThresholdsFromConfig(cfg)
+	flags := flag.NewFlagSet("quality", flag.ExitOnError)
+	days := flags.Int("days", 30, "check datapoints of the last N days")
+	all := flags.Bool("all", false, "list entities without issues as well")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.DurationVar(&thresholds.Stale, "stale", thresholds.Stale, "report entities without datapoints for longer than this")
+	flags.DurationVar(&thresholds.Gap, "gap", thresholds.Gap, "report holes between datapoints longer than this")
+	flags.DurationVar(&thresholds.Flat, "flat", thresholds.Flat, "report values unchanged for longer than this")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(dbPath(cfg.Storage), 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "error opening DB, make sure the daemon is stopped or use /api/v1/quality")
+	}
+	defer db.Close()
+
+	to := time.Now().UTC()
+	report, err := quality.Check(db, to.AddDate(0, 0, -*days), to, thresholds)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	issues := 0
+	for _, e := range report.Entities {
+		if e.Issues() > 0 {
+			issues++
+		}
+		if e.Issues() > 0 || *all {
+			fmt.Println(e)
+		}
+	}
+	log.Printf("[INFO] Checked %d entities since %s: %d with issues\n", len(report.Entities), report.From.Format(time.RFC3339), issues)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+// renameCommand renames or merges series: coviddy rename|merge --collection countries --from <name> --to <name>.
+func renameCommand(cfg config.Config, merge bool, args []string) error {
+	name := "rename"
+	if merge {
+		name = "merge"
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	collectionName := flags.String("collection", documents.CountryCollection, "countries or states")
+	from := flags.String("from", "", "name of the series to move")
+	to := flags.String("to", "", "new name, or name of the series to merge into")
+	overlap := flags.String("overlap", string(documents.KeepTarget), "merge only: keep_target, prefer_source, max_cases or fail")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	collection, err := documents.ParseCollection(*collectionName)
+	if err != nil {
+		return err
+	}
+	policy, err := documents.ParseOverlapPolicy(*overlap)
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(dbPath(cfg.Storage), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return errors.Wrap(err, "error opening DB, make sure the daemon is stopped or use the internal API")
+	}
+	defer db.Close()
+
+	var res documents.MergeResult
+	if merge {
+		res, err = documents.Merge(db, collection, *from, *to, policy)
+	} else {
+		res, err = documents.Rename(db, collection, *from, *to)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s failed", name)
+	}
+	log.Printf("[INFO] %s %s -> %s: %d moved, %d overlapping, %d replaced\n", res.Collection, res.From, res.To, res.Moved, res.Overlapping, res.Replaced)
+	return nil
+}
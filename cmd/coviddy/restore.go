@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/mkorenkov/covid-19/pkg/backup"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+// restoreCommand replaces the DB with a snapshot: coviddy restore [--at <time>].
+// It runs before the service config is loaded and reads only the storage settings, plus S3 ones without COVIDDY_SNAPSHOT_DIR.
+func restoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	at := flags.String("at", "", "restore the latest snapshot taken at or before this time (RFC3339 or YYYY-MM-DD), defaults to now")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	when := time.Now()
+	if *at != "" {
+		var err error
+		if when, err = timeseries.ParseTime(*at, true); err != nil {
+			return err
+		}
+	}
+
+	var storage config.Storage
+	if err := envconfig.Process("coviddy", &storage); err != nil {
+		return err
+	}
+	var s3 config.S3
+	if storage.SnapshotDir == "" {
+		if err := envconfig.Process("coviddy", &s3); err != nil {
+			return err
+		}
+	}
+	if err := ensureExists(storage.StorageDir); err != nil {
+		return err
+	}
+
+	manifest, err := backup.Restore(context.Background(), snapshotTarget(storage, s3), when, dbPath(storage))
+	if err != nil {
+		return errors.Wrap(err, "restore failed")
+	}
+	log.Printf("[INFO] Restored snapshot %s taken at %s (tx %d)\n", manifest.Snapshot, manifest.CreatedAt.Format(time.RFC3339), manifest.TxID)
+	return nil
+}
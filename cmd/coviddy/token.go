@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/auth"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// tokenCommand manages API tokens: coviddy token issue --name <name> --scopes read,upsert [--ttl 720h] | revoke <id> | list | hash-password.
+func tokenCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected a token command: issue, revoke, list or hash-password")
+	}
+	if args[0] == "hash-password" {
+		return hashPasswordCommand()
+	}
+
+	db, err := bolt.Open(dbPath(cfg.Storage), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return errors.Wrap(err, "error opening DB, make sure the daemon is stopped or use the internal API")
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "issue":
+		flags := flag.NewFlagSet("token issue", flag.ExitOnError)
+		name := flags.String("name", "", "what the token is for")
+		scopes := flags.String("scopes", auth.ScopeRead, "comma separated "+strings.Join(auth.Scopes, ", "))
+		ttl := flags.Duration("ttl", 0, "expire the token after this long, never by default")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		parsed, err := auth.ParseScopes(*scopes)
+		if err != nil {
+			return err
+		}
+		t, secret, err := auth.Issue(db, *name, parsed, *ttl, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Issued token %s (%s) with scopes %s\n", t.ID, t.Name, strings.Join(t.Scopes, ","))
+		fmt.Println(secret)
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("usage: coviddy token revoke <id>")
+		}
+		if err := auth.Revoke(db, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked token %s\n", args[1])
+		return nil
+	case "list":
+		tokens, err := auth.List(db)
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			expires, used := "never", "never"
+			if t.ExpiresAt != nil {
+				expires = t.ExpiresAt.Format(time.RFC3339)
+			}
+			if t.LastUsed != nil {
+				used = t.LastUsed.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\texpires %s\tlast used %s\n", t.ID, t.Name, strings.Join(t.Scopes, ","), expires, used)
+		}
+		return nil
+	}
+	return errors.Errorf("unknown token command %s", args[0])
+}
+
+// hashPasswordCommand reads a password from stdin and prints its bcrypt hash for COVIDDY_CREDENTIALS.
+func hashPasswordCommand() error {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return errors.Wrap(err, "error reading password from stdin")
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,8 +14,8 @@ import (
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/mkorenkov/covid-19/pkg/client"
 	"github.com/mkorenkov/covid-19/pkg/documents"
-	"github.com/mkorenkov/covid-19/pkg/httpclient"
 	"github.com/pkg/errors"
 )
 
@@ -34,8 +32,9 @@ func (e sentinelError) Error() string {
 type Config struct {
 	ImportDir       string `split_words:"true" required:"true"`
 	CoviddyURI      string `split_words:"true" required:"true"`
-	CoviddyUser     string `split_words:"true" required:"true"`
-	CoviddyPassword string `split_words:"true" required:"true"`
+	CoviddyToken    string `split_words:"true"` // API token with the upsert scope, instead of user and password
+	CoviddyUser     string `split_words:"true"`
+	CoviddyPassword string `split_words:"true"`
 }
 
 func parse(dateOverride time.Time, path string) (documents.CollectionEntry, error) {
@@ -126,7 +125,7 @@ func onError(errorChan <-chan error) {
 	}
 }
 
-func worker(ctx context.Context, wg *sync.WaitGroup, cfg Config, httpClient httpclient.HTTPClient, docs <-chan documents.CollectionEntry, errorChan chan<- error) {
+func worker(ctx context.Context, wg *sync.WaitGroup, c *client.Client, docs <-chan documents.CollectionEntry, errorChan chan<- error) {
 	defer wg.Done()
 	for {
 		select {
@@ -137,7 +136,12 @@ func worker(ctx context.Context, wg *sync.WaitGroup, cfg Config, httpClient http
 				return
 			}
 			if doc.GetName() != "" {
-				if err := r(cfg, httpClient, doc); err != nil {
+				err := c.Upsert(ctx, doc)
+				if errors.Is(err, client.QuarantinedError) {
+					log.Printf("[INFO] %s quarantined\n", doc)
+					continue
+				}
+				if err != nil {
 					errorChan <- errors.Wrapf(err, "Failed to upload %s", doc)
 				}
 				log.Printf("[INFO] %s\n", doc)
@@ -146,35 +150,9 @@ func worker(ctx context.Context, wg *sync.WaitGroup, cfg Config, httpClient http
 	}
 }
 
-func r(cfg Config, httpClient httpclient.HTTPClient, doc documents.CollectionEntry) error {
-	errChan := make(chan error)
-	defer close(errChan)
-	var buf bytes.Buffer
-
-	if err := doc.Save(&buf); err != nil {
-		return errors.Wrapf(err, "Error saving doc %s", doc)
-	}
-	req, err := http.NewRequest("POST", cfg.CoviddyURI, &buf)
-	if err != nil {
-		return errors.Wrap(err, "Error creating HTTP request")
-	}
-	req.SetBasicAuth(cfg.CoviddyUser, cfg.CoviddyPassword)
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return errors.Wrapf(err, "Error uploading doc %s", doc)
-	}
-	defer resp.Body.Close()
-
-	_, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return errors.Wrap(err, "Error reading response body")
-	}
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return errors.Errorf("Unexpected HTTP status %d", resp.StatusCode)
-	}
-
-	return nil
+// baseURL COVIDDY_URI used to be the full upsert URL, the client only needs the daemon part of it.
+func baseURL(uri string) string {
+	return strings.SplitN(uri, "/api/", 2)[0]
 }
 
 func main() {
@@ -184,7 +162,7 @@ func main() {
 	}
 
 	ctx := context.Background()
-	httpClient := httpclient.Retryable()
+	c := client.New(client.Config{URL: baseURL(cfg.CoviddyURI), Token: cfg.CoviddyToken, User: cfg.CoviddyUser, Password: cfg.CoviddyPassword})
 	docChan := make(chan documents.CollectionEntry, documentsChanSize)
 
 	errorChan := make(chan error)
@@ -199,7 +177,7 @@ func main() {
 	}()
 	for i := 0; i < workersCount; i++ {
 		wg.Add(1)
-		go worker(ctx, &wg, cfg, httpClient, docChan, errorChan)
+		go worker(ctx, &wg, c, docChan, errorChan)
 	}
 	wg.Wait()
 }
@@ -0,0 +1,233 @@
+package analytics
+
+import (
+	"math"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+)
+
+// DefaultWindow days most rolling metrics are computed over.
+const DefaultWindow = 7
+
+// Cori et al. (2013) gamma prior of Rt: shape a, scale b.
+const (
+	rtPriorShape = 1.0
+	rtPriorScale = 5.0
+)
+
+// SerialInterval gamma distributed time between symptom onsets of infector and infectee, in days.
+type SerialInterval struct {
+	Mean float64 `json:"mean"`
+	SD   float64 `json:"sd"`
+}
+
+// DefaultSerialInterval COVID-19 estimate by Nishiura et al. (2020).
+var DefaultSerialInterval = SerialInterval{Mean: 4.7, SD: 2.9}
+
+// MaxSerialInterval upper bound of the mean and SD, in days. Weights grows with both.
+const MaxSerialInterval = 30.0
+
+// Valid whether mean and SD are positive and within MaxSerialInterval.
+func (si SerialInterval) Valid() bool {
+	return si.Mean > 0 && si.SD > 0 && si.Mean <= MaxSerialInterval && si.SD <= MaxSerialInterval
+}
+
+// Weights discretized serial interval: w[k] probability of the interval being k days, w[0] is always 0.
+func (si SerialInterval) Weights() []float64 {
+	shape := (si.Mean / si.SD) * (si.Mean / si.SD)
+	scale := si.SD * si.SD / si.Mean
+	lgamma, _ := math.Lgamma(shape)
+	days := int(math.Ceil(si.Mean + 5*si.SD))
+
+	res := make([]float64, days+1)
+	sum := 0.0
+	for k := 1; k <= days; k++ {
+		x := float64(k)
+		res[k] = math.Exp((shape-1)*math.Log(x) - x/scale - lgamma - shape*math.Log(scale))
+		sum += res[k]
+	}
+	for k := range res {
+		res[k] /= sum
+	}
+	return res
+}
+
+// CFR naive case fatality rate: deaths per confirmed case.
+func CFR(cases float64, deaths float64) float64 {
+	if cases <= 0 {
+		return math.NaN()
+	}
+	return deaths / cases
+}
+
+// TestsPerCase tests performed per confirmed case, higher values mean fewer infections go unnoticed.
+func TestsPerCase(tests float64, cases float64) float64 {
+	if cases <= 0 || tests <= 0 {
+		return math.NaN()
+	}
+	return tests / cases
+}
+
+// Daily turns cumulative values into daily increments. Downward corrections count as 0.
+func Daily(cumulative []float64) []float64 {
+	res := make([]float64, len(cumulative))
+	for i := 1; i < len(cumulative); i++ {
+		if d := cumulative[i] - cumulative[i-1]; d > 0 {
+			res[i] = d
+		}
+	}
+	return res
+}
+
+func rollingSum(values []float64, i int, window int) float64 {
+	sum := 0.0
+	for j := i - window + 1; j <= i; j++ {
+		if j >= 0 {
+			sum += values[j]
+		}
+	}
+	return sum
+}
+
+// RollingAverage trailing mean over the window, NaN until the window is full.
+func RollingAverage(values []float64, window int) []float64 {
+	res := make([]float64, len(values))
+	for i := range values {
+		if i < window-1 {
+			res[i] = math.NaN()
+			continue
+		}
+		res[i] = rollingSum(values, i, window) / float64(window)
+	}
+	return res
+}
+
+// Positivity test positivity proxy: new cases per new test over the trailing window.
+// worldometers does not publish positive tests, so it is only as good as both series line up.
+func Positivity(newCases []float64, newTests []float64, window int) []float64 {
+	res := make([]float64, len(newCases))
+	for i := range newCases {
+		tests := rollingSum(newTests, i, window)
+		if i < window-1 || tests <= 0 {
+			res[i] = math.NaN()
+			continue
+		}
+		res[i] = rollingSum(newCases, i, window) / tests
+	}
+	return res
+}
+
+// DoublingTime days it takes the cumulative value to double, assuming the growth seen over the trailing window.
+// NaN when there is no growth.
+func DoublingTime(cumulative []float64, window int) []float64 {
+	res := make([]float64, len(cumulative))
+	for i := range cumulative {
+		res[i] = math.NaN()
+		if i < window || cumulative[i-window] <= 0 || cumulative[i] <= cumulative[i-window] {
+			continue
+		}
+		res[i] = float64(window) * math.Ln2 / math.Log(cumulative[i]/cumulative[i-window])
+	}
+	return res
+}
+
+// Rt effective reproduction number estimated the way Cori et al. (2013) do: daily incidence over the trailing window
+// against the infectiousness of earlier cases. Returns posterior mean and standard deviation, NaN where undefined.
+func Rt(incidence []float64, si SerialInterval, window int) ([]float64, []float64) {
+	w := si.Weights()
+	infectiousness := make([]float64, len(incidence))
+	for t := range incidence {
+		for k := 1; k < len(w) && k <= t; k++ {
+			infectiousness[t] += incidence[t-k] * w[k]
+		}
+	}
+
+	mean := make([]float64, len(incidence))
+	sd := make([]float64, len(incidence))
+	for t := range incidence {
+		mean[t], sd[t] = math.NaN(), math.NaN()
+		if t < window {
+			continue
+		}
+		lambda := rollingSum(infectiousness, t, window)
+		if lambda <= 0 {
+			continue
+		}
+		shape := rtPriorShape + rollingSum(incidence, t, window)
+		rate := 1/rtPriorScale + lambda
+		mean[t] = shape / rate
+		sd[t] = math.Sqrt(shape) / rate
+	}
+	return mean, sd
+}
+
+// Options tune Compute.
+type Options struct {
+	SerialInterval SerialInterval
+	Window         int
+}
+
+// Day metrics of a single day, nil where undefined.
+type Day struct {
+	Date         time.Time `json:"date"`
+	Cases        uint64    `json:"cases"`
+	Deaths       uint64    `json:"deaths"`
+	Tests        uint64    `json:"tests"`
+	NewCases     uint64    `json:"new_cases"`
+	NewDeaths    uint64    `json:"new_deaths"`
+	NewTests     uint64    `json:"new_tests"`
+	CFR          *float64  `json:"cfr"`
+	TestsPerCase *float64  `json:"tests_per_case"`
+	Positivity   *float64  `json:"positivity"`
+	DoublingTime *float64  `json:"doubling_time"`
+	Rt           *float64  `json:"rt"`
+	RtSD         *float64  `json:"rt_sd"`
+}
+
+func nullable(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// Compute derives daily metrics from the stored cumulative series (oldest first).
+// A day gets the last values reported by its end.
+func Compute(docs []documents.DataEntry, opts Options) []Day {
+	if len(docs) == 0 {
+		return []Day{}
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	dates, cases := timeseries.Daily(docs, func(d documents.DataEntry) float64 { return float64(d.Cases) })
+	_, deaths := timeseries.Daily(docs, func(d documents.DataEntry) float64 { return float64(d.Deaths) })
+	_, tests := timeseries.Daily(docs, func(d documents.DataEntry) float64 { return float64(d.Tests) })
+
+	newCases, newDeaths, newTests := Daily(cases), Daily(deaths), Daily(tests)
+	positivity := Positivity(newCases, newTests, opts.Window)
+	doubling := DoublingTime(cases, opts.Window)
+	rt, rtSD := Rt(newCases, opts.SerialInterval, opts.Window)
+
+	res := make([]Day, len(dates))
+	for i := range dates {
+		res[i] = Day{
+			Date:         dates[i],
+			Cases:        uint64(cases[i]),
+			Deaths:       uint64(deaths[i]),
+			Tests:        uint64(tests[i]),
+			NewCases:     uint64(newCases[i]),
+			NewDeaths:    uint64(newDeaths[i]),
+			NewTests:     uint64(newTests[i]),
+			CFR:          nullable(CFR(cases[i], deaths[i])),
+			TestsPerCase: nullable(TestsPerCase(tests[i], cases[i])),
+			Positivity:   nullable(positivity[i]),
+			DoublingTime: nullable(doubling[i]),
+			Rt:           nullable(rt[i]),
+			RtSD:         nullable(rtSD[i]),
+		}
+	}
+	return res
+}
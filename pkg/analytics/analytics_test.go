@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatios(t *testing.T) {
+	assert.InDelta(t, 0.025, CFR(1000, 25), 1e-9)
+	assert.True(t, math.IsNaN(CFR(0, 0)))
+	assert.InDelta(t, 5.0, TestsPerCase(5000, 1000), 1e-9)
+	assert.True(t, math.IsNaN(TestsPerCase(0, 1000)))
+
+	assert.Equal(t, []float64{0, 10, 0, 10}, Daily([]float64{100, 110, 105, 115}))
+
+	average := RollingAverage([]float64{1, 2, 3, 4}, 3)
+	assert.True(t, math.IsNaN(average[1]))
+	assert.Equal(t, []float64{2, 3}, average[2:])
+
+	positivity := Positivity([]float64{100, 100, 100, 100}, []float64{1000, 1000, 1000, 1000}, 3)
+	assert.True(t, math.IsNaN(positivity[1]))
+	assert.InDelta(t, 0.1, positivity[3], 1e-9)
+}
+
+func TestDoublingTime(t *testing.T) {
+	cumulative := make([]float64, 20)
+	for i := range cumulative {
+		cumulative[i] = 100 * math.Pow(2, float64(i)/3)
+	}
+	res := DoublingTime(cumulative, 7)
+	assert.True(t, math.IsNaN(res[6]))
+	assert.InDelta(t, 3.0, res[7], 1e-9)
+	assert.InDelta(t, 3.0, res[19], 1e-9)
+
+	flat := DoublingTime([]float64{5, 5, 5, 5}, 2)
+	assert.True(t, math.IsNaN(flat[3]))
+}
+
+func TestSerialIntervalWeights(t *testing.T) {
+	w := DefaultSerialInterval.Weights()
+	assert.Equal(t, 0.0, w[0])
+	sum, mean := 0.0, 0.0
+	for k := range w {
+		sum += w[k]
+		mean += float64(k) * w[k]
+	}
+	assert.InDelta(t, 1.0, sum, 1e-9)
+	assert.InDelta(t, DefaultSerialInterval.Mean, mean, 0.1)
+}
+
+func TestRt(t *testing.T) {
+	constant := make([]float64, 60)
+	for i := range constant {
+		constant[i] = 1000
+	}
+	rt, sd := Rt(constant, DefaultSerialInterval, 7)
+	assert.True(t, math.IsNaN(rt[6]))
+	assert.InDelta(t, 1.0, rt[59], 0.001)
+	assert.InDelta(t, 0.012, sd[59], 0.001)
+
+	// exponential growth at rate r: R = (1 + r*scale)^shape for a gamma serial interval (Wallinga & Lipsitch, 2007),
+	// i.e. ~1.54 for r = 0.1 and a 4.7 +- 2.9 days serial interval.
+	growing := make([]float64, 60)
+	for i := range growing {
+		growing[i] = 10 * math.Exp(0.1*float64(i))
+	}
+	rt, _ = Rt(growing, DefaultSerialInterval, 7)
+	assert.InDelta(t, 1.54, rt[59], 0.05)
+
+	declining := make([]float64, 60)
+	for i := range declining {
+		declining[i] = 100000 * math.Exp(-0.05*float64(i))
+	}
+	rt, _ = Rt(declining, DefaultSerialInterval, 7)
+	assert.Less(t, rt[59], 1.0)
+}
+
+func TestCompute(t *testing.T) {
+	docs := []documents.DataEntry{}
+	for day := 1; day <= 10; day++ {
+		// two scrapes a day, the later one wins
+		docs = append(docs,
+			documents.DataEntry{When: time.Date(2020, 6, day, 6, 0, 0, 0, time.UTC), Cases: uint64(day * 90), Deaths: uint64(day), Tests: uint64(day * 900)},
+			documents.DataEntry{When: time.Date(2020, 6, day, 18, 0, 0, 0, time.UTC), Cases: uint64(day * 100), Deaths: uint64(day * 2), Tests: uint64(day * 1000)},
+		)
+	}
+	res := Compute(docs, Options{SerialInterval: DefaultSerialInterval})
+	require.Len(t, res, 10)
+	assert.Equal(t, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), res[0].Date)
+	assert.Equal(t, uint64(100), res[0].Cases)
+	assert.Equal(t, uint64(0), res[0].NewCases)
+	assert.Nil(t, res[0].Rt)
+
+	last := res[9]
+	assert.Equal(t, uint64(100), last.NewCases)
+	assert.InDelta(t, 0.02, *last.CFR, 1e-9)
+	assert.InDelta(t, 10.0, *last.TestsPerCase, 1e-9)
+	assert.InDelta(t, 0.1, *last.Positivity, 1e-9)
+	require.NotNil(t, last.DoublingTime)
+	require.NotNil(t, last.Rt)
+
+	assert.Empty(t, Compute(nil, Options{}))
+}
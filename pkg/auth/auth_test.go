@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDB(t *testing.T) (*bolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	_, _, err := Issue(db, "ci", []string{"write"}, 0, now)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+	_, _, err = Issue(db, "", []string{ScopeRead}, 0, now)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+
+	issued, secret, err := Issue(db, "ci", []string{ScopeUpsert}, time.Hour, now)
+	require.NoError(t, err)
+	assert.Contains(t, secret, issued.ID)
+	assert.Empty(t, issued.Hash)
+
+	got, err := Authenticate(db, secret, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "ci", got.Name)
+	assert.Equal(t, now.Add(time.Minute), *got.LastUsed)
+	assert.True(t, Allows(got.Scopes, ScopeUpsert))
+	assert.False(t, Allows(got.Scopes, ScopeImport))
+
+	_, err = Authenticate(db, secret+"x", now)
+	assert.Equal(t, UnauthorizedError, err)
+	_, err = Authenticate(db, "cvd_"+issued.ID, now)
+	assert.Equal(t, UnauthorizedError, err)
+	_, err = Authenticate(db, secret, now.Add(time.Hour))
+	assert.Equal(t, UnauthorizedError, err, "expired")
+
+	txID := func() int {
+		id := 0
+		db.View(func(tx *bolt.Tx) error {
+			id = tx.ID()
+			return nil
+		})
+		return id
+	}
+	before := txID()
+	tokens, err := List(db)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Empty(t, tokens[0].Hash)
+	assert.Equal(t, now.Add(time.Minute), *tokens[0].LastUsed, "not written yet")
+	assert.Equal(t, before, txID(), "authenticating does not write")
+
+	require.NoError(t, FlushLastUsed(db))
+	assert.Equal(t, before+1, txID())
+	require.NoError(t, FlushLastUsed(db))
+	assert.Equal(t, before+1, txID(), "nothing left to flush")
+	tokens, err = List(db)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), *tokens[0].LastUsed)
+
+	require.NoError(t, Revoke(db, issued.ID))
+	_, err = Authenticate(db, secret, now)
+	assert.Equal(t, UnauthorizedError, err)
+	assert.True(t, errors.Is(Revoke(db, issued.ID), TokenNotFoundError))
+}
+
+func TestUsers(t *testing.T) {
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+	users := Users{"plain": "password", "hashed": hash}
+
+	assert.True(t, users.Check("plain", "password"))
+	assert.False(t, users.Check("plain", "passwor"))
+	assert.True(t, users.Check("hashed", "secret"))
+	assert.False(t, users.Check("hashed", hash))
+	assert.False(t, users.Check("nobody", ""))
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("read, upsert,read")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeRead, ScopeUpsert}, scopes)
+	assert.True(t, Allows([]string{ScopeAdmin}, ScopeImport))
+
+	_, err = ParseScopes("")
+	assert.Error(t, err)
+	_, err = ParseScopes("read,delete")
+	assert.Error(t, err)
+}
@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// TokensBucket stores API tokens keyed by ID.
+const TokensBucket = "Tokens"
+
+// Scopes of API tokens. Admin implies every other scope.
+const (
+	ScopeRead   = "read"
+	ScopeUpsert = "upsert"
+	ScopeImport = "import"
+	ScopeAdmin  = "admin"
+)
+
+// Scopes all supported scopes.
+var Scopes = []string{ScopeRead, ScopeUpsert, ScopeImport, ScopeAdmin}
+
+const (
+	// TokenNotFoundError no token with the given ID.
+	TokenNotFoundError = sentinelError("Token not found")
+	// InvalidTokenError token name or scopes are not valid.
+	InvalidTokenError = sentinelError("Invalid token")
+	// UnauthorizedError credentials are missing, unknown, wrong or expired.
+	UnauthorizedError = sentinelError("Unauthorized")
+)
+
+// tokenPrefix makes tokens easy to spot in configs and logs.
+const tokenPrefix = "cvd_"
+
+// lastUses LastUsed times not written to the DB yet. Authenticating does not write, so reads stay cheap
+// and do not change the DB transaction ID that responses are cached by.
+type lastUses struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+var pendingLastUses = &lastUses{used: map[string]time.Time{}}
+
+func (u *lastUses) record(id string, when time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if when.After(u.used[id]) {
+		u.used[id] = when.UTC()
+	}
+}
+
+func (u *lastUses) get(id string) (time.Time, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	when, ok := u.used[id]
+	return when, ok
+}
+
+func (u *lastUses) forget(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.used, id)
+}
+
+func (u *lastUses) take() map[string]time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	res := u.used
+	u.used = map[string]time.Time{}
+	return res
+}
+
+// withPendingLastUse overlays the LastUsed time not written yet.
+func withPendingLastUse(t Token) Token {
+	if when, ok := pendingLastUses.get(t.ID); ok && (t.LastUsed == nil || when.After(*t.LastUsed)) {
+		t.LastUsed = &when
+	}
+	return t
+}
+
+type sentinelError string
+
+func (e sentinelError) Error() string {
+	return string(e)
+}
+
+// Token API token. Only the SHA-256 hash of the secret is stored.
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	Created   time.Time  `json:"created"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil never expires
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// Expired tells whether the token is past its expiry.
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Allows tells whether the scopes grant the scope.
+func Allows(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes parses comma separated scopes.
+func ParseScopes(v string) ([]string, error) {
+	res := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !contains(Scopes, s) {
+			return nil, errors.Errorf("unknown scope %q, expected any of %s", s, strings.Join(Scopes, ", "))
+		}
+		if !contains(res, s) {
+			res = append(res, s)
+		}
+	}
+	if len(res) == 0 {
+		return nil, errors.Errorf("at least one scope is required, expected any of %s", strings.Join(Scopes, ", "))
+	}
+	return res, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "error generating random token")
+	}
+	return b, nil
+}
+
+// splitToken splits cvd_<id>_<secret> into the token ID and the whole token.
+func splitToken(token string) (string, bool) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(token, tokenPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func putToken(tx *bolt.Tx, t Token) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(TokensBucket))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket", TokensBucket)
+	}
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrap(err, "error encoding API token")
+	}
+	return bucket.Put([]byte(t.ID), payload)
+}
+
+func getToken(tx *bolt.Tx, id string) (Token, error) {
+	t := Token{}
+	bucket := tx.Bucket([]byte(TokensBucket))
+	if bucket == nil {
+		return t, errors.Wrapf(TokenNotFoundError, "token %s", id)
+	}
+	payload := bucket.Get([]byte(id))
+	if payload == nil {
+		return t, errors.Wrapf(TokenNotFoundError, "token %s", id)
+	}
+	return t, errors.Wrapf(json.Unmarshal(payload, &t), "error decoding API token %s", id)
+}
+
+// Issue creates a token with the scopes, ttl of 0 never expires. The secret token is returned once, only its hash is stored.
+func Issue(db *bolt.DB, name string, scopes []string, ttl time.Duration, now time.Time) (Token, string, error) {
+	t := Token{Name: strings.TrimSpace(name), Scopes: scopes, Created: now.UTC()}
+	if t.Name == "" {
+		return t, "", errors.Wrap(InvalidTokenError, "name is required")
+	}
+	if _, err := ParseScopes(strings.Join(scopes, ",")); err != nil {
+		return t, "", errors.Wrap(InvalidTokenError, err.Error())
+	}
+	if ttl < 0 {
+		return t, "", errors.Wrap(InvalidTokenError, "expiry must not be negative")
+	}
+	if ttl > 0 {
+		expires := t.Created.Add(ttl)
+		t.ExpiresAt = &expires
+	}
+	id, err := randomBytes(8)
+	if err != nil {
+		return t, "", err
+	}
+	secret, err := randomBytes(32)
+	if err != nil {
+		return t, "", err
+	}
+	t.ID = hex.EncodeToString(id)
+	token := tokenPrefix + t.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	t.Hash = hash(token)
+	err = db.Update(func(tx *bolt.Tx) error {
+		return putToken(tx, t)
+	})
+	if err != nil {
+		return t, "", errors.Wrap(err, "error saving API token")
+	}
+	t.Hash = ""
+	return t, token, nil
+}
+
+// Revoke deletes the token.
+func Revoke(db *bolt.DB, id string) error {
+	pendingLastUses.forget(id)
+	return db.Update(func(tx *bolt.Tx) error {
+		if _, err := getToken(tx, id); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(TokensBucket)).Delete([]byte(id))
+	})
+}
+
+// List returns all tokens, oldest first, with hashes left out.
+func List(db *bolt.DB) ([]Token, error) {
+	res := []Token{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(TokensBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			t := Token{}
+			if err := json.Unmarshal(v, &t); err != nil {
+				return errors.Wrapf(err, "error decoding API token %s", k)
+			}
+			t.Hash = ""
+			res = append(res, withPendingLastUse(t))
+			return nil
+		})
+	})
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res, err
+}
+
+// Authenticate finds the token and records its use. UnauthorizedError is returned for unknown, wrong or expired tokens.
+func Authenticate(db *bolt.DB, token string, now time.Time) (Token, error) {
+	id, ok := splitToken(token)
+	if !ok {
+		return Token{}, UnauthorizedError
+	}
+	var t Token
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = getToken(tx, id)
+		return err
+	})
+	if errors.Is(err, TokenNotFoundError) {
+		return Token{}, UnauthorizedError
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(token)), []byte(t.Hash)) != 1 || t.Expired(now) {
+		return Token{}, UnauthorizedError
+	}
+	pendingLastUses.record(t.ID, now)
+	t.Hash = ""
+	return withPendingLastUse(t), nil
+}
+
+// FlushLastUsed writes LastUsed times recorded by Authenticate to the DB, revoked tokens are skipped.
+func FlushLastUsed(db *bolt.DB) error {
+	used := pendingLastUses.take()
+	if len(used) == 0 {
+		return nil
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for id, when := range used {
+			t, err := getToken(tx, id)
+			if errors.Is(err, TokenNotFoundError) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if t.LastUsed != nil && !when.After(*t.LastUsed) {
+				continue
+			}
+			when := when
+			t.LastUsed = &when
+			if err := putToken(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "error saving API token last use")
+}
+
+// FlushLastUsedEvery flushes LastUsed times every interval until the context is done.
+func FlushLastUsedEvery(ctx context.Context, db *bolt.DB, interval time.Duration, errorChan chan<- error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := FlushLastUsed(db); err != nil {
+				errorChan <- err
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Users basic auth users and their passwords: bcrypt hashes, or plain text as it used to be.
+type Users map[string]string
+
+func isBcrypt(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
+
+// Check verifies the user password in constant time.
+func (u Users) Check(user string, password string) bool {
+	expected, ok := u[user]
+	if isBcrypt(expected) {
+		return bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) == nil
+	}
+	// equal length hashes, so the comparison does not leak the password length
+	got, want := sha256.Sum256([]byte(password)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1 && ok
+}
+
+// HashPassword bcrypt hash of the password for COVIDDY_CREDENTIALS.
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	res, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(res), errors.Wrap(err, "error hashing password")
+}
+
+// Principal who made an authenticated request.
+type Principal struct {
+	Name    string // user or token name
+	TokenID string // empty for basic auth users
+	Scopes  []string
+}
+
+type ctxKey struct{}
+
+// NewContext stores the principal in the context.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the principal of an authenticated request.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const restoreLockTimeout = 1 * time.Second
+
+// Restore replaces the DB at dbPath with the latest snapshot taken at or before the given time.
+// The snapshot is downloaded next to the DB, verified against its manifest and bolt consistency checks,
+// and only then swapped in. The replaced DB is kept as dbPath.pre-restore-<timestamp>.
+// Fails when the DB at dbPath is in use (e.g. the daemon is running).
+func Restore(ctx context.Context, target Target, at time.Time, dbPath string) (Manifest, error) {
+	manifest, err := FindManifest(ctx, target, at)
+	if err != nil {
+		return manifest, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dbPath), "restore-*.db")
+	if err != nil {
+		return manifest, errors.Wrap(err, "error creating restore temp file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := download(ctx, target, manifest, tmp); err != nil {
+		tmp.Close()
+		return manifest, err
+	}
+	if err := tmp.Close(); err != nil {
+		return manifest, errors.Wrap(err, "error closing restore temp file")
+	}
+	if err := check(tmp.Name()); err != nil {
+		return manifest, errors.Wrapf(err, "snapshot %s is corrupted", manifest.Snapshot)
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := ensureNotInUse(dbPath); err != nil {
+			return manifest, err
+		}
+		previous := dbPath + ".pre-restore-" + time.Now().UTC().Format(snapshotTimeLayout)
+		if err := os.Rename(dbPath, previous); err != nil {
+			return manifest, errors.Wrapf(err, "error moving %s out of the way", dbPath)
+		}
+	} else if !os.IsNotExist(err) {
+		return manifest, errors.Wrap(err, "Unexpected error while calling os.Stat")
+	}
+	if err := os.Rename(tmp.Name(), dbPath); err != nil {
+		return manifest, errors.Wrapf(err, "error moving snapshot to %s", dbPath)
+	}
+	return manifest, nil
+}
+
+// download streams the snapshot into w, verifying sizes and checksums from the manifest.
+func download(ctx context.Context, target Target, manifest Manifest, w *os.File) error {
+	body, err := target.Get(ctx, manifest.Snapshot)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	gzHash := newCountingHash()
+	gz, err := gzip.NewReader(io.TeeReader(body, gzHash))
+	if err != nil {
+		return errors.Wrapf(err, "error creating gzip reader for %s", manifest.Snapshot)
+	}
+	rawHash := newCountingHash()
+	if _, err := io.Copy(io.MultiWriter(w, rawHash), gz); err != nil {
+		return errors.Wrapf(err, "error downloading %s", manifest.Snapshot)
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "failed to Close() gzip reader")
+	}
+	// drain whatever follows the gzip stream so the checksum covers the whole object
+	if _, err := io.Copy(ioutil.Discard, io.TeeReader(body, gzHash)); err != nil {
+		return errors.Wrapf(err, "error downloading %s", manifest.Snapshot)
+	}
+	if gzHash.n != manifest.GzipSize || gzHash.Sum() != manifest.GzipSHA256 {
+		return errors.Errorf("checksum mismatch for %s", manifest.Snapshot)
+	}
+	if rawHash.n != manifest.Size || rawHash.Sum() != manifest.SHA256 {
+		return errors.Errorf("checksum mismatch for uncompressed %s", manifest.Snapshot)
+	}
+	if err := w.Sync(); err != nil {
+		return errors.Wrap(err, "error fsyncing restored DB")
+	}
+	return nil
+}
+
+// check runs bolt consistency checks on the DB file.
+func check(dbPath string) error {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: restoreLockTimeout, ReadOnly: true})
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s", dbPath)
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		var firstErr error
+		for err := range tx.Check() {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	})
+}
+
+// ensureNotInUse makes sure nobody holds the bolt file lock.
+func ensureNotInUse(dbPath string) error {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: restoreLockTimeout})
+	if err != nil {
+		return errors.Wrapf(err, "%s is in use, stop the daemon before restoring", dbPath)
+	}
+	return db.Close()
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -14,6 +15,8 @@ import (
 	"github.com/go-pkgz/repeater"
 	"github.com/go-pkgz/repeater/strategy"
 	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/metrics"
 	"github.com/mkorenkov/covid-19/pkg/requestcontext"
 	"github.com/pkg/errors"
 )
@@ -50,14 +53,35 @@ func key(prefix string, doc documents.CollectionEntry) string {
 	return path.Join(pathParts...)
 }
 
-// Upload uploads Country / State information to S3 using the client.
-func Upload(ctx context.Context, s3Client *s3.S3, bucketWithPath string, doc documents.CollectionEntry) error {
+// splitBucketPath splits "bucket/optional/prefix" into bucket and prefix.
+func splitBucketPath(bucketWithPath string) (string, string) {
 	bucketPath := strings.Split(bucketWithPath, "/")
 	bucket := bucketPath[0]
 	prefix := ""
 	if len(bucketPath) > 1 {
 		prefix = path.Join(bucketPath[1:]...)
 	}
+	return bucket, prefix
+}
+
+// NewS3Client creates S3 client for the given configuration.
+func NewS3Client(config S3Config) *s3.S3 {
+	s3Config := &aws.Config{
+		Credentials: credentials.NewStaticCredentials(config.GetAccessKey(), config.GetSecret(), ""),
+
+		Region:           aws.String(config.GetRegion()),
+		S3ForcePathStyle: aws.Bool(true),
+	}
+	if config.GetEndpoint() != "" {
+		s3Config.Endpoint = aws.String(config.GetEndpoint())
+	}
+	newSession := session.New(s3Config)
+	return s3.New(newSession)
+}
+
+// Upload uploads Country / State information to S3 using the client.
+func Upload(ctx context.Context, s3Client *s3.S3, bucketWithPath string, doc documents.CollectionEntry) error {
+	bucket, prefix := splitBucketPath(bucketWithPath)
 
 	docKey := key(prefix, doc)
 	if docKey == "" {
@@ -96,17 +120,7 @@ func Upload(ctx context.Context, s3Client *s3.S3, bucketWithPath string, doc doc
 
 // ToS3 streams documents to S3 for backup reasons.
 func ToS3(ctx context.Context, config S3Config, docs <-chan documents.CollectionEntry) {
-	s3Config := &aws.Config{
-		Credentials: credentials.NewStaticCredentials(config.GetAccessKey(), config.GetSecret(), ""),
-
-		Region:           aws.String(config.GetRegion()),
-		S3ForcePathStyle: aws.Bool(true),
-	}
-	if config.GetEndpoint() != "" {
-		s3Config.Endpoint = aws.String(config.GetEndpoint())
-	}
-	newSession := session.New(s3Config)
-	s3Client := s3.New(newSession)
+	s3Client := NewS3Client(config)
 
 	errorChan := requestcontext.Errors(ctx)
 	if errorChan == nil {
@@ -121,7 +135,12 @@ func ToS3(ctx context.Context, config S3Config, docs <-chan documents.Collection
 			if !more {
 				return
 			}
-			if err := Upload(ctx, s3Client, config.GetBucket(), doc); err != nil {
+			err := Upload(ctx, s3Client, config.GetBucket(), doc)
+			if tracker := requestcontext.Health(ctx); tracker != nil {
+				tracker.Record(health.Backup, time.Now(), err)
+			}
+			if err != nil {
+				metrics.BackupUploadErrors.Inc()
 				errorChan <- errors.Wrap(err, "Failed writing to S3")
 			}
 		}
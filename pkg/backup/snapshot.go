@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+const (
+	snapshotsPrefix    = "snapshots/"
+	snapshotSuffix     = ".db.gz"
+	manifestSuffix     = ".manifest.json"
+	snapshotTimeLayout = "2006-01-02T15:04:05Z"
+)
+
+// Manifest describes a single DB snapshot. Manifest is uploaded after the snapshot,
+// so a snapshot without a manifest is incomplete and never used for restores.
+type Manifest struct {
+	CreatedAt  time.Time `json:"created_at"`
+	Snapshot   string    `json:"snapshot"`
+	TxID       int       `json:"tx_id"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	GzipSize   int64     `json:"gzip_size"`
+	GzipSHA256 string    `json:"gzip_sha256"`
+}
+
+func snapshotKeys(createdAt time.Time) (string, string) {
+	base := snapshotsPrefix + createdAt.UTC().Format(snapshotTimeLayout)
+	return base + snapshotSuffix, base + manifestSuffix
+}
+
+// countingHash counts and hashes everything written to it.
+type countingHash struct {
+	n int64
+	h hash.Hash
+}
+
+func newCountingHash() *countingHash {
+	return &countingHash{h: sha256.New()}
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.h.Write(p)
+}
+
+func (c *countingHash) Sum() string {
+	return hex.EncodeToString(c.h.Sum(nil))
+}
+
+// Snapshot writes a consistent gzipped copy of the DB to the target, followed by its manifest.
+func Snapshot(ctx context.Context, db *bolt.DB, target Target) (Manifest, error) {
+	var manifest Manifest
+
+	tmp, err := ioutil.TempFile(filepath.Dir(db.Path()), "snapshot-*"+snapshotSuffix)
+	if err != nil {
+		return manifest, errors.Wrap(err, "error creating snapshot temp file")
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	gzHash := newCountingHash()
+	rawHash := newCountingHash()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, gzHash))
+	err = db.View(func(tx *bolt.Tx) error {
+		manifest.CreatedAt = time.Now().UTC().Truncate(time.Second)
+		manifest.TxID = tx.ID()
+		_, txErr := tx.WriteTo(io.MultiWriter(gz, rawHash))
+		return txErr
+	})
+	if err != nil {
+		return manifest, errors.Wrap(err, "error writing DB snapshot")
+	}
+	if err := gz.Close(); err != nil {
+		return manifest, errors.Wrap(err, "failed to Close() gzip writer")
+	}
+
+	snapshotKey, manifestKey := snapshotKeys(manifest.CreatedAt)
+	manifest.Snapshot = snapshotKey
+	manifest.Size = rawHash.n
+	manifest.SHA256 = rawHash.Sum()
+	manifest.GzipSize = gzHash.n
+	manifest.GzipSHA256 = gzHash.Sum()
+
+	if err := target.Put(ctx, snapshotKey, tmp); err != nil {
+		return manifest, errors.Wrap(err, "error uploading snapshot")
+	}
+	manifestBody, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, errors.Wrap(err, "JSON marshal error")
+	}
+	if err := target.Put(ctx, manifestKey, bytes.NewReader(manifestBody)); err != nil {
+		return manifest, errors.Wrap(err, "error uploading snapshot manifest")
+	}
+	return manifest, nil
+}
+
+// Snapshots periodically backs up the whole DB to the target. Non-positive interval turns snapshots off.
+func Snapshots(ctx context.Context, db *bolt.DB, target Target, interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("[INFO] DB snapshots are off\n")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	errorChan := requestcontext.Errors(ctx)
+	if errorChan == nil {
+		panic(errors.New("Could not retrieve error chan from context"))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			manifest, err := Snapshot(ctx, db, target)
+			if tracker := requestcontext.Health(ctx); tracker != nil {
+				tracker.Record(health.Snapshots, time.Now(), err)
+			}
+			if err != nil {
+				errorChan <- errors.Wrap(err, "Failed to snapshot DB")
+				continue
+			}
+			log.Printf("[INFO] Saved DB snapshot %s (tx %d, %d bytes)\n", manifest.Snapshot, manifest.TxID, manifest.GzipSize)
+		}
+	}
+}
+
+// FindManifest returns the manifest of the latest snapshot taken at or before the given time.
+func FindManifest(ctx context.Context, target Target, at time.Time) (Manifest, error) {
+	var manifest Manifest
+	keys, err := target.List(ctx, snapshotsPrefix)
+	if err != nil {
+		return manifest, err
+	}
+	found := ""
+	for _, k := range keys {
+		if !strings.HasSuffix(k, manifestSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeLayout, strings.TrimSuffix(strings.TrimPrefix(k, snapshotsPrefix), manifestSuffix))
+		if err != nil {
+			continue
+		}
+		if createdAt.After(at) {
+			break
+		}
+		found = k
+	}
+	if found == "" {
+		return manifest, errors.Errorf("no snapshots taken at or before %s", at.Format(time.RFC3339))
+	}
+
+	body, err := target.Get(ctx, found)
+	if err != nil {
+		return manifest, err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return manifest, errors.Wrapf(err, "error decoding manifest %s", found)
+	}
+	return manifest, nil
+}
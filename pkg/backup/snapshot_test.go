@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a tiny in-memory stand-in for S3 supporting PutObject, GetObject and ListObjectsV2.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+type fakeS3Config struct {
+	endpoint string
+}
+
+func (c fakeS3Config) GetBucket() string    { return "backups/coviddy" }
+func (c fakeS3Config) GetEndpoint() string  { return c.endpoint }
+func (c fakeS3Config) GetRegion() string    { return "us-east-1" }
+func (c fakeS3Config) GetAccessKey() string { return "key" }
+func (c fakeS3Config) GetSecret() string    { return "secret" }
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objectPath := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[objectPath] = body
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		type content struct {
+			Key string
+		}
+		res := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}{}
+		prefix := path.Join(objectPath, r.URL.Query().Get("prefix"))
+		keys := []string{}
+		for k := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, strings.TrimPrefix(k, objectPath+"/"))
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res.Contents = append(res.Contents, content{Key: k})
+		}
+		xml.NewEncoder(w).Encode(res)
+	case r.Method == http.MethodGet:
+		body, ok := f.objects[objectPath]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func writeValue(t *testing.T, db *bolt.DB, value string) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("test"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte(value))
+	})
+	require.NoError(t, err)
+}
+
+func readValue(t *testing.T, dbPath string) string {
+	db, err := bolt.Open(dbPath, 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	var res string
+	err = db.View(func(tx *bolt.Tx) error {
+		res = string(tx.Bucket([]byte("test")).Get([]byte("key")))
+		return nil
+	})
+	require.NoError(t, err)
+	return res
+}
+
+func testSnapshotAndRestore(t *testing.T, target Target) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dbPath := path.Join(dir, "coviddy.db")
+	db, err := bolt.Open(dbPath, 0600, nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	writeValue(t, db, "first")
+	first, err := Snapshot(ctx, db, target)
+	require.NoError(t, err)
+
+	time.Sleep(1100 * time.Millisecond)
+	writeValue(t, db, "second")
+	second, err := Snapshot(ctx, db, target)
+	require.NoError(t, err)
+	assert.True(t, second.CreatedAt.After(first.CreatedAt))
+
+	_, err = Restore(ctx, target, time.Now(), dbPath)
+	require.Error(t, err, "DB is in use")
+	require.NoError(t, db.Close())
+
+	_, err = Restore(ctx, target, first.CreatedAt.Add(-time.Hour), dbPath)
+	require.Error(t, err, "no snapshots that early")
+
+	restored, err := Restore(ctx, target, first.CreatedAt.Add(500*time.Millisecond), dbPath)
+	require.NoError(t, err)
+	assert.Equal(t, first.Snapshot, restored.Snapshot)
+	assert.Equal(t, "first", readValue(t, dbPath))
+
+	restored, err = Restore(ctx, target, time.Now(), dbPath)
+	require.NoError(t, err)
+	assert.Equal(t, second.Snapshot, restored.Snapshot)
+	assert.Equal(t, "second", readValue(t, dbPath))
+}
+
+func TestSnapshotRestoreDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot-target")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testSnapshotAndRestore(t, NewDirTarget(dir))
+}
+
+func TestSnapshotRestoreS3(t *testing.T) {
+	s3 := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer s3.Close()
+	cfg := fakeS3Config{endpoint: s3.URL}
+
+	testSnapshotAndRestore(t, NewS3Target(NewS3Client(cfg), cfg.GetBucket()))
+}
+
+func TestRestoreCorruptedSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot-corrupted")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	target := NewDirTarget(path.Join(dir, "target"))
+
+	db, err := bolt.Open(path.Join(dir, "coviddy.db"), 0600, nil)
+	require.NoError(t, err)
+	writeValue(t, db, "value")
+	manifest, err := Snapshot(context.Background(), db, target)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "target", manifest.Snapshot), []byte("garbage"), 0600))
+	_, err = Restore(context.Background(), target, time.Now(), path.Join(dir, "coviddy.db"))
+	require.Error(t, err)
+	assert.Equal(t, "value", readValue(t, path.Join(dir, "coviddy.db")))
+}
@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-pkgz/repeater"
+	"github.com/go-pkgz/repeater/strategy"
+	"github.com/pkg/errors"
+)
+
+// Target is a place to keep backup objects: S3 bucket or local directory.
+type Target interface {
+	// Put stores the object under the given key, replacing the existing one.
+	Put(ctx context.Context, key string, body io.ReadSeeker) error
+	// Get opens the object stored under the given key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns sorted keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// S3Target stores backup objects in S3 bucket (optionally under a prefix).
+type S3Target struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewS3Target creates S3Target. bucketWithPath is either "bucket" or "bucket/prefix".
+func NewS3Target(client *s3.S3, bucketWithPath string) *S3Target {
+	bucket, prefix := splitBucketPath(bucketWithPath)
+	return &S3Target{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (t *S3Target) fullKey(key string) string {
+	if t.prefix == "" {
+		return key
+	}
+	return path.Join(t.prefix, key)
+}
+
+// Put implements Target.
+func (t *S3Target) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	f := func() error {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "error rewinding body")
+		}
+		_, err := t.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Body:   body,
+			Bucket: aws.String(t.bucket),
+			Key:    aws.String(t.fullKey(key)),
+		})
+		return err
+	}
+
+	r := repeater.New(&strategy.Backoff{
+		Repeats: repeatTimes,
+		Factor:  repeaterFactor,
+		Jitter:  true,
+	})
+	if err := r.Do(ctx, f); err != nil {
+		return errors.Wrapf(err, "Repeater tried hard, but no could not upload %s to S3", key)
+	}
+	return nil
+}
+
+// Get implements Target.
+func (t *S3Target) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := t.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(t.fullKey(key)),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s from S3", key)
+	}
+	return out.Body, nil
+}
+
+// List implements Target.
+func (t *S3Target) List(ctx context.Context, prefix string) ([]string, error) {
+	res := []string{}
+	stripPrefix := ""
+	if t.prefix != "" {
+		stripPrefix = t.prefix + "/"
+	}
+	err := t.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(t.bucket),
+		Prefix: aws.String(t.fullKey(prefix)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			res = append(res, strings.TrimPrefix(aws.StringValue(obj.Key), stripPrefix))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing %s in S3", prefix)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// DirTarget stores backup objects in a local directory.
+type DirTarget struct {
+	dir string
+}
+
+// NewDirTarget creates DirTarget.
+func NewDirTarget(dir string) *DirTarget {
+	return &DirTarget{dir: dir}
+}
+
+// Put implements Target. Objects are written to a temp file first and renamed into place.
+func (t *DirTarget) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	fullPath := filepath.Join(t.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create %s", filepath.Dir(fullPath))
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "error rewinding body")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fullPath), ".put-*")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temp file for %s", key)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "error writing %s", key)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "error fsyncing %s", key)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "error closing %s", key)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return errors.Wrapf(err, "error renaming %s", key)
+	}
+	return nil
+}
+
+// Get implements Target.
+func (t *DirTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(t.dir, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening %s", key)
+	}
+	return f, nil
+}
+
+// List implements Target.
+func (t *DirTarget) List(ctx context.Context, prefix string) ([]string, error) {
+	res := []string{}
+	err := filepath.Walk(t.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".put-") {
+			return nil
+		}
+		rel, err := filepath.Rel(t.dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			res = append(res, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing %s", t.dir)
+	}
+	sort.Strings(res)
+	return res, nil
+}
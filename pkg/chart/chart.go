@@ -0,0 +1,327 @@
+package chart
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	marginLeft   = 64
+	marginRight  = 16
+	marginTop    = 44
+	marginBottom = 28
+	fontSize     = 12
+	day          = 24 * time.Hour
+)
+
+// Theme colors of the chart.
+type Theme struct {
+	Background string
+	Foreground string
+	Grid       string
+	Palette    []string // series colors, reused when there are more series
+}
+
+// Themes by name.
+var Themes = map[string]Theme{
+	"light": {Background: "#ffffff", Foreground: "#333333", Grid: "#e5e5e5", Palette: []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"}},
+	"dark":  {Background: "#1e1e1e", Foreground: "#dddddd", Grid: "#3a3a3a", Palette: []string{"#4fa3e0", "#f0605d", "#5cc85c", "#ffa64d", "#b58fdb", "#c4a484", "#f29fd6", "#4dd9e6"}},
+}
+
+// ParseTheme returns the theme by name, empty string means light.
+func ParseTheme(name string) (Theme, error) {
+	if name == "" {
+		name = "light"
+	}
+	if t, ok := Themes[name]; ok {
+		return t, nil
+	}
+	return Theme{}, errors.Errorf("unknown theme %s, expected light or dark", name)
+}
+
+// Series values of a single line, NaN where unknown.
+type Series struct {
+	Name    string
+	Values  []float64
+	Average []float64 // optional overlay, drawn bold on top of the values
+	Bars    bool      // values drawn as bars rather than a line
+}
+
+// Chart line chart over daily dates.
+type Chart struct {
+	Title  string
+	Width  int
+	Height int
+	Log    bool
+	Theme  Theme
+	Dates  []time.Time // x axis, values of all the series are aligned with it
+	Series []Series
+}
+
+// scale maps values onto the plot height.
+type scale struct {
+	log      bool
+	min, max float64 // log10 of the bounds on log scale
+	ticks    []float64
+	top      float64
+	height   float64
+}
+
+func (s scale) y(v float64) (float64, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	if s.log {
+		if v <= 0 {
+			return 0, false
+		}
+		v = math.Log10(v)
+	}
+	return s.top + s.height*(1-(v-s.min)/(s.max-s.min)), true
+}
+
+// barBase where bars start: zero, clamped to the axis range, e.g. the bottom of the plot on log scale.
+func (s scale) barBase() float64 {
+	y, ok := s.y(0)
+	if !ok {
+		return s.top + s.height
+	}
+	return math.Max(s.top, math.Min(y, s.top+s.height))
+}
+
+// niceStep rounds the step up to 1, 2 or 5 times a power of 10.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func (c Chart) scale(top float64, height float64) scale {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for _, values := range [][]float64{s.Values, s.Average} {
+			for _, v := range values {
+				if math.IsNaN(v) || math.IsInf(v, 0) || (c.Log && v <= 0) {
+					continue
+				}
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	res := scale{log: c.Log, top: top, height: height}
+	if c.Log {
+		if math.IsInf(lo, 1) {
+			lo, hi = 1, 10
+		}
+		res.min, res.max = math.Floor(math.Log10(lo)), math.Ceil(math.Log10(hi))
+		if res.max <= res.min {
+			res.max = res.min + 1
+		}
+		for e := res.min; e <= res.max; e++ {
+			res.ticks = append(res.ticks, math.Pow(10, e))
+		}
+		return res
+	}
+	if math.IsInf(lo, 1) {
+		lo, hi = 0, 1
+	}
+	lo, hi = math.Min(lo, 0), math.Max(hi, 1)
+	step := niceStep((hi - lo) / 5)
+	res.min, res.max = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	for v := res.min; v <= res.max+step/2; v += step {
+		res.ticks = append(res.ticks, v)
+	}
+	return res
+}
+
+// formatTick short tick labels: 500, 2.5k, 1M.
+func formatTick(v float64) string {
+	for _, unit := range []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "k"}} {
+		if math.Abs(v) >= unit.size {
+			return strconv.FormatFloat(v/unit.size, 'f', -1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// dateTicks indexes of the labeled dates, at most 8 of them.
+func dateTicks(dates []time.Time) []int {
+	if len(dates) == 0 {
+		return nil
+	}
+	every := 1
+	for _, days := range []int{1, 2, 7, 14, 30, 61, 91, 182, 365, 730} {
+		every = days
+		if len(dates)/days < 8 {
+			break
+		}
+	}
+	res := []int{}
+	for i := 0; i < len(dates); i += every {
+		res = append(res, i)
+	}
+	return res
+}
+
+type svgWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (s *svgWriter) printf(format string, args ...interface{}) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = fmt.Fprintf(s.w, format, args...)
+}
+
+// path SVG path data of the values, broken where values are unknown.
+func path(values []float64, x func(i int) float64, sc scale) string {
+	b := &strings.Builder{}
+	move := true
+	for i, v := range values {
+		y, ok := sc.y(v)
+		if !ok {
+			move = true
+			continue
+		}
+		cmd := "L"
+		if move {
+			cmd = "M"
+			move = false
+		}
+		fmt.Fprintf(b, "%s%.1f %.1f ", cmd, x(i), y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Render writes the chart as SVG.
+func (c Chart) Render(out io.Writer) error {
+	if len(c.Theme.Palette) == 0 {
+		c.Theme = Themes["light"]
+	}
+	width, height := float64(c.Width), float64(c.Height)
+	left, top := float64(marginLeft), float64(marginTop)
+	plotWidth, plotHeight := width-marginLeft-marginRight, height-marginTop-marginBottom
+	sc := c.scale(top, plotHeight)
+	x := func(i int) float64 {
+		if len(c.Dates) < 2 {
+			return left + plotWidth/2
+		}
+		return left + plotWidth*float64(i)/float64(len(c.Dates)-1)
+	}
+	th := c.Theme
+
+	s := &svgWriter{w: bufio.NewWriter(out)}
+	s.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="%d">`+"\n", c.Width, c.Height, c.Width, c.Height, fontSize)
+	s.printf(`<rect width="100%%" height="100%%" fill="%s"/>`+"\n", th.Background)
+	s.printf(`<text x="%.1f" y="18" fill="%s" font-size="%d" font-weight="bold">%s</text>`+"\n", left, th.Foreground, fontSize+2, html.EscapeString(c.Title))
+
+	// legend
+	legendX := left
+	for i, series := range c.Series {
+		color := th.Palette[i%len(th.Palette)]
+		s.printf(`<rect x="%.1f" y="26" width="10" height="10" fill="%s"/>`, legendX, color)
+		s.printf(`<text x="%.1f" y="35" fill="%s">%s</text>`+"\n", legendX+14, th.Foreground, html.EscapeString(series.Name))
+		legendX += 14 + float64(len(series.Name)*7+16)
+	}
+
+	// grid and axes
+	for _, tick := range sc.ticks {
+		y, _ := sc.y(tick)
+		s.printf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`, left, y, left+plotWidth, y, th.Grid)
+		s.printf(`<text x="%.1f" y="%.1f" fill="%s" text-anchor="end">%s</text>`+"\n", left-6, y+4, th.Foreground, formatTick(tick))
+	}
+	layout := "Jan 2"
+	if len(c.Dates) > 0 && c.Dates[len(c.Dates)-1].Sub(c.Dates[0]) > 365*day {
+		layout = "Jan 2006"
+	}
+	for _, i := range dateTicks(c.Dates) {
+		s.printf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`, x(i), top+plotHeight, x(i), top+plotHeight+4, th.Foreground)
+		s.printf(`<text x="%.1f" y="%.1f" fill="%s" text-anchor="middle">%s</text>`+"\n", x(i), top+plotHeight+18, th.Foreground, c.Dates[i].Format(layout))
+	}
+	s.printf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", left, top+plotHeight, left+plotWidth, top+plotHeight, th.Foreground)
+	if len(c.Dates) == 0 {
+		s.printf(`<text x="%.1f" y="%.1f" fill="%s" text-anchor="middle">No data</text>`+"\n", left+plotWidth/2, top+plotHeight/2, th.Foreground)
+	}
+
+	// series
+	barWidth := 0.8 * plotWidth / math.Max(float64(len(c.Dates)), 1)
+	for i, series := range c.Series {
+		color := th.Palette[i%len(th.Palette)]
+		if series.Bars {
+			base := sc.barBase()
+			for j, v := range series.Values {
+				// negative values hang below the zero line
+				if y, ok := sc.y(v); ok && y != base {
+					s.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" fill-opacity="0.35"/>`+"\n", x(j)-barWidth/2, math.Min(y, base), barWidth, math.Abs(base-y), color)
+				}
+			}
+		} else if p := path(series.Values, x, sc); p != "" {
+			opacity := "1"
+			if series.Average != nil {
+				opacity = "0.4"
+			}
+			s.printf(`<path d="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-opacity="%s"/>`+"\n", p, color, opacity)
+		}
+		if p := path(series.Average, x, sc); p != "" {
+			s.printf(`<path d="%s" fill="none" stroke="%s" stroke-width="2.5"/>`+"\n", p, color)
+		}
+	}
+	s.printf("</svg>\n")
+	if s.err != nil {
+		return errors.Wrap(s.err, "error writing chart")
+	}
+	return errors.Wrap(s.w.Flush(), "error writing chart")
+}
+
+// Align puts daily values of several series onto their common dates, oldest first. Missing days get NaN.
+func Align(dates [][]time.Time, values [][]float64) ([]time.Time, [][]float64) {
+	index := map[time.Time]bool{}
+	for _, ds := range dates {
+		for _, d := range ds {
+			index[d] = true
+		}
+	}
+	grid := make([]time.Time, 0, len(index))
+	for d := range index {
+		grid = append(grid, d)
+	}
+	sort.Slice(grid, func(i, j int) bool {
+		return grid[i].Before(grid[j])
+	})
+	position := map[time.Time]int{}
+	for i, d := range grid {
+		position[d] = i
+	}
+	res := make([][]float64, len(values))
+	for i := range values {
+		res[i] = make([]float64, len(grid))
+		for j := range res[i] {
+			res[i][j] = math.NaN()
+		}
+		for j, d := range dates[i] {
+			res[i][position[d]] = values[i][j]
+		}
+	}
+	return grid, res
+}
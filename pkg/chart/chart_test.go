@@ -0,0 +1,89 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// elements counts SVG elements by name, failing on malformed XML.
+func elements(t *testing.T, svg []byte) map[string]int {
+	res := map[string]int{}
+	d := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return res
+		}
+		require.NoError(t, err)
+		if start, ok := tok.(xml.StartElement); ok {
+			res[start.Name.Local]++
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	dates := []time.Time{}
+	values := []float64{}
+	for i := 0; i < 30; i++ {
+		dates = append(dates, time.Date(2020, 6, 1+i, 0, 0, 0, 0, time.UTC))
+		values = append(values, float64(i*i))
+	}
+	values[10] = math.NaN()
+
+	c := Chart{Title: "Ukraine & friends", Width: 800, Height: 400, Theme: Themes["dark"], Dates: dates, Series: []Series{{Name: "cases", Values: values, Average: values, Bars: true}}}
+	buf := &bytes.Buffer{}
+	require.NoError(t, c.Render(buf))
+	counts := elements(t, buf.Bytes())
+	assert.Equal(t, 1, counts["svg"])
+	assert.Equal(t, 1, counts["path"])
+	assert.Equal(t, 2+28, counts["rect"]) // background, legend and bars, the NaN and the 0 have none
+	assert.Contains(t, buf.String(), "Ukraine &amp; friends")
+	assert.Contains(t, buf.String(), ">Jun 1<")
+
+	c.Log = true
+	sc := c.scale(0, 100)
+	assert.Equal(t, []float64{1, 10, 100, 1000}, sc.ticks)
+
+	c.Dates, c.Series = nil, nil
+	buf.Reset()
+	require.NoError(t, c.Render(buf))
+	assert.Contains(t, buf.String(), "No data")
+}
+
+func TestScale(t *testing.T) {
+	assert.Equal(t, 2.0, niceStep(1.3))
+	assert.Equal(t, 500.0, niceStep(420))
+	assert.Equal(t, "2.5k", formatTick(2500))
+	assert.Equal(t, "1M", formatTick(1e6))
+
+	sc := Chart{Series: []Series{{Values: []float64{0, 1234}}}}.scale(0, 100)
+	assert.Equal(t, []float64{0, 500, 1000, 1500}, sc.ticks)
+	y, ok := sc.y(1500)
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, y)
+	assert.Equal(t, 100.0, sc.barBase())
+
+	sc = Chart{Series: []Series{{Values: []float64{-50, 150}}}}.scale(0, 100)
+	assert.Equal(t, []float64{-50, 0, 50, 100, 150}, sc.ticks)
+	assert.Equal(t, 75.0, sc.barBase())
+
+	sc = Chart{Log: true, Series: []Series{{Values: []float64{10, 1000}}}}.scale(0, 100)
+	assert.Equal(t, 100.0, sc.barBase())
+}
+
+func TestAlign(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 6, d, 0, 0, 0, 0, time.UTC) }
+	grid, values := Align([][]time.Time{{day(2), day(3)}, {day(1), day(2)}}, [][]float64{{20, 30}, {1, 2}})
+	assert.Equal(t, []time.Time{day(1), day(2), day(3)}, grid)
+	assert.True(t, math.IsNaN(values[0][0]))
+	assert.Equal(t, []float64{20, 30}, values[0][1:])
+	assert.Equal(t, []float64{1, 2}, values[1][:2])
+	assert.True(t, math.IsNaN(values[1][2]))
+}
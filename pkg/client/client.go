@@ -0,0 +1,251 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/httpclient"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/pkg/errors"
+)
+
+// QuarantinedError the datapoint was accepted, but validation quarantined it.
+const QuarantinedError = sentinelError("datapoint quarantined by validation")
+
+type sentinelError string
+
+func (e sentinelError) Error() string {
+	return string(e)
+}
+
+// Config where the coviddy daemon is and how to authenticate.
+type Config struct {
+	URL      string // base URL, e.g. https://coviddy.example.com
+	Token    string // API token for the internal API, wins over basic auth
+	User     string // basic auth for the internal API
+	Password string
+}
+
+// Client typed coviddy API client. Requests are retried through httpclient, DB uploads are not.
+type Client struct {
+	cfg    Config
+	http   httpclient.HTTPClient
+	upload httpclient.HTTPClient
+}
+
+// New creates a client with the retryable HTTP client, DB uploads go through httpclient.Uploads.
+func New(cfg Config) *Client {
+	c := NewWithHTTPClient(cfg, httpclient.RetryableAPI())
+	c.upload = httpclient.Uploads()
+	return c
+}
+
+// NewWithHTTPClient creates a client making all requests through the given HTTP client.
+func NewWithHTTPClient(cfg Config, c httpclient.HTTPClient) *Client {
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &Client{cfg: cfg, http: c, upload: c}
+}
+
+// StatusCode HTTP status code of a failed request, 0 when the request did not get a response.
+func StatusCode(err error) int {
+	statusErr := &httpclient.StatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// Entity country or state with its newest values.
+type Entity struct {
+	Name      string    `json:"name"`
+	Code      string    `json:"code"`
+	Cases     uint64    `json:"cases"`
+	Deaths    uint64    `json:"deaths"`
+	Tests     uint64    `json:"tests"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Datapoint single datapoint of a series, fields left out of the query are nil.
+type Datapoint struct {
+	When   time.Time `json:"when"`
+	Cases  *uint64   `json:"cases,omitempty"`
+	Deaths *uint64   `json:"deaths,omitempty"`
+	Tests  *uint64   `json:"tests,omitempty"`
+}
+
+// Series time ordered datapoints of a country or state.
+type Series struct {
+	Name       string      `json:"name"`
+	Code       string      `json:"code"`
+	Data       []Datapoint `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Query datapoints between From and To, zero values mean unbounded. Fields are cases, deaths or tests, all when empty.
+type Query struct {
+	From   time.Time
+	To     time.Time
+	Fields []string
+}
+
+func (q Query) values() url.Values {
+	res := url.Values{}
+	if !q.From.IsZero() {
+		res.Set("from", q.From.UTC().Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		res.Set("to", q.To.UTC().Format(time.RFC3339))
+	}
+	if len(q.Fields) > 0 {
+		res.Set("fields", strings.Join(q.Fields, ","))
+	}
+	return res
+}
+
+// do sends the request and decodes the JSON response into v, unless v is nil.
+func (c *Client) do(req *http.Request, auth bool, v interface{}) error {
+	return c.doWith(c.http, req, auth, v)
+}
+
+func (c *Client) doWith(client httpclient.HTTPClient, req *http.Request, auth bool, v interface{}) error {
+	switch {
+	case auth && c.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	case auth:
+		req.SetBasicAuth(c.cfg.User, c.cfg.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed", req.Method, req.URL.Path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// not every HTTP client turns statuses into errors
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &httpclient.StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		return QuarantinedError
+	}
+	if v == nil {
+		_, err := io.Copy(ioutil.Discard, resp.Body)
+		return errors.Wrap(err, "error reading response")
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "error decoding %s response", req.URL.Path)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	u := c.cfg.URL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating HTTP request")
+	}
+	return c.do(req, false, v)
+}
+
+// ListCountries countries with their newest values, by code.
+func (c *Client) ListCountries(ctx context.Context) ([]Entity, error) {
+	res := []Entity{}
+	return res, c.get(ctx, "/api/v2/countries", nil, &res)
+}
+
+// ListStates states with their newest values, by code.
+func (c *Client) ListStates(ctx context.Context) ([]Entity, error) {
+	res := []Entity{}
+	return res, c.get(ctx, "/api/v2/states", nil, &res)
+}
+
+// LatestCountries newest datapoint per country, most cases first.
+func (c *Client) LatestCountries(ctx context.Context) ([]latest.Entry, error) {
+	res := []latest.Entry{}
+	return res, c.get(ctx, "/api/v1/countries/latest", nil, &res)
+}
+
+// LatestStates newest datapoint per state, most cases first.
+func (c *Client) LatestStates(ctx context.Context) ([]latest.Entry, error) {
+	res := []latest.Entry{}
+	return res, c.get(ctx, "/api/v1/states/latest", nil, &res)
+}
+
+// series reads all pages of the series.
+func (c *Client) series(ctx context.Context, path string, q Query) (Series, error) {
+	res := Series{Data: []Datapoint{}}
+	params := q.values()
+	for {
+		page := Series{}
+		if err := c.get(ctx, path, params, &page); err != nil {
+			return res, err
+		}
+		res.Name, res.Code = page.Name, page.Code
+		res.Data = append(res.Data, page.Data...)
+		if page.NextCursor == "" {
+			return res, nil
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+}
+
+// CountryDatapoints datapoints of the country matching the query, oldest first.
+func (c *Client) CountryDatapoints(ctx context.Context, country string, q Query) (Series, error) {
+	return c.series(ctx, "/api/v2/countries/"+url.PathEscape(country), q)
+}
+
+// StateDatapoints datapoints of the state matching the query, oldest first.
+func (c *Client) StateDatapoints(ctx context.Context, state string, q Query) (Series, error) {
+	return c.series(ctx, "/api/v2/states/"+url.PathEscape(state), q)
+}
+
+// Upsert saves a country or state datapoint, the collection is found by name.
+// QuarantinedError is returned when validation holds the datapoint back.
+func (c *Client) Upsert(ctx context.Context, doc documents.CollectionEntry) error {
+	buf := &bytes.Buffer{}
+	if err := doc.Save(buf); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+"/api/internal/v1/import/country_or_state", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return errors.Wrap(err, "error creating HTTP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, true, nil)
+}
+
+// ImportBoltDB uploads a coviddy DB file, the daemon imports its datapoints in the background.
+// The upload is neither retried nor timed out, use a context deadline to bound it.
+func (c *Client) ImportBoltDB(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s", path)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", path)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+"/api/internal/v1/boltdb/import", f)
+	if err != nil {
+		return errors.Wrap(err, "error creating HTTP request")
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// redirects need the body from the start
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	return c.doWith(c.upload, req, true, nil)
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryDatapointsPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/countries/ukraine", r.URL.Path)
+		assert.Equal(t, "2020-06-01T00:00:00Z", r.URL.Query().Get("from"))
+		assert.Equal(t, "cases", r.URL.Query().Get("fields"))
+		res := Series{Name: "Ukraine", Code: "ukraine", Data: []Datapoint{{When: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)}}, NextCursor: "next"}
+		if r.URL.Query().Get("cursor") == "next" {
+			res.Data[0].When = res.Data[0].When.AddDate(0, 0, 1)
+			res.NextCursor = ""
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(res))
+	}))
+	defer srv.Close()
+
+	c := NewWithHTTPClient(Config{URL: srv.URL + "/"}, http.DefaultClient)
+	res, err := c.CountryDatapoints(context.Background(), "ukraine", Query{From: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), Fields: []string{"cases"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Ukraine", res.Name)
+	assert.Len(t, res.Data, 2)
+	assert.Empty(t, res.NextCursor)
+}
+
+func TestUpsert(t *testing.T) {
+	status := int32(http.StatusCreated)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "secret", password)
+		doc, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(doc), `"name":"Ukraine"`)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	c := NewWithHTTPClient(Config{URL: srv.URL, User: "user", Password: "secret"}, http.DefaultClient)
+	doc := documents.DataEntry{Name: "Ukraine", When: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC), Cases: 100}
+	assert.NoError(t, c.Upsert(context.Background(), doc))
+
+	atomic.StoreInt32(&status, http.StatusAccepted)
+	assert.Equal(t, QuarantinedError, c.Upsert(context.Background(), doc))
+}
+
+func TestImportBoltDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "import.db")
+	require.NoError(t, ioutil.WriteFile(path, []byte("bolt"), 0600))
+
+	calls := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "bolt", string(body))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c := New(Config{URL: srv.URL})
+	err = c.ImportBoltDB(context.Background(), path)
+	assert.Equal(t, http.StatusBadGateway, StatusCode(err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "uploads are not retried")
+	assert.NoError(t, c.ImportBoltDB(context.Background(), path))
+
+	err = c.ImportBoltDB(context.Background(), filepath.Join(dir, "missing.db"))
+	assert.Error(t, err)
+	assert.Equal(t, 0, StatusCode(err))
+}
+
+func TestStatusCode(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := New(Config{URL: srv.URL}).ListCountries(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, StatusCode(err))
+}
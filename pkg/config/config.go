@@ -5,17 +5,66 @@ import (
 	"time"
 )
 
+// S3 backup bucket settings.
+type S3 struct {
+	S3Secret    string `split_words:"true" required:"true"`
+	S3AccessKey string `split_words:"true" required:"true"`
+	S3Region    string `split_words:"true" default:"us-east-1"`
+	S3Endpoint  string `split_words:"true"`
+	S3Bucket    string `split_words:"true" required:"true"`
+}
+
+// Storage where the DB and its snapshots live, all the restore command needs besides S3.
+type Storage struct {
+	StorageDir  string `split_words:"true" required:"true"`
+	SnapshotDir string `split_words:"true"` // store DB snapshots in this directory instead of S3
+}
+
 type Config struct {
-	S3Secret       string            `split_words:"true" required:"true"`
-	S3AccessKey    string            `split_words:"true" required:"true"`
-	S3Region       string            `split_words:"true" default:"us-east-1"`
-	S3Endpoint     string            `split_words:"true"`
-	S3Bucket       string            `split_words:"true" required:"true"`
-	StorageDir     string            `split_words:"true" required:"true"`
+	S3
+	Storage
 	ScrapeInterval time.Duration     `split_words:"true" required:"true"`
 	ListenAddr     string            `split_words:"true" required:"true"`
-	Credentials    map[string]string `split_words:"true" required:"true"` // comma separated user:password pairs
+	Credentials    map[string]string `split_words:"true" required:"true"` // comma separated user:password pairs, passwords may be bcrypt hashes
 	SentryDSN      string            `split_words:"true" required:"true"`
+
+	ValidationLevels     map[string]string `split_words:"true"`             // comma separated rule:level pairs, level is warn, quarantine or reject
+	ValidationSpikeSigma float64           `split_words:"true" default:"6"` // day-over-day growth above mean + N sigma gets flagged
+
+	SnapshotInterval time.Duration `split_words:"true" default:"24h"` // 0 turns DB snapshots off
+
+	SerialIntervalMean float64 `split_words:"true" default:"4.7"` // days, used for Rt estimates
+	SerialIntervalSD   float64 `split_words:"true" default:"2.9"`
+
+	QualityStaleAfter  time.Duration `split_words:"true" default:"48h"` // data quality report thresholds
+	QualityGap         time.Duration `split_words:"true" default:"12h"`
+	QualityFlatFor     time.Duration `split_words:"true" default:"72h"`
+	QualityScrapeSlack time.Duration `split_words:"true" default:"10m"`
+	QualityMaxGaps     int           `split_words:"true" default:"5"`
+
+	ReconcileThreshold float64 `split_words:"true" default:"0.02"` // relative difference between US totals worth reporting
+
+	MetricsLatestValues bool `split_words:"true"` // expose newest cases and deaths per entity on /metrics
+
+	ReadyScrapeIntervals  float64 `split_words:"true" default:"3"`   // /readyz fails when the last successful scrape is older than N scrape intervals
+	ReadyBackupQueueRatio float64 `split_words:"true" default:"0.9"` // /readyz fails when the S3 upload queue is fuller than this
+
+	WebhookRetention time.Duration `split_words:"true" default:"168h"` // how long delivered webhooks stay in the delivery log
+
+	RulesFile string `split_words:"true"` // alerting rules, YAML; alerting is off when empty
+
+	SMTPAddr     string `split_words:"true"` // host:port
+	SMTPFrom     string `split_words:"true"`
+	SMTPUsername string `split_words:"true"`
+	SMTPPassword string `split_words:"true"`
+
+	DigestRecipients []string `split_words:"true"`                 // comma separated, the daily digest is off when empty
+	DigestAt         string   `split_words:"true" default:"08:00"` // HH:MM
+	DigestTimezone   string   `split_words:"true" default:"UTC"`   // IANA name, e.g. Europe/Kiev
+	DigestLimit      int      `split_words:"true" default:"10"`    // rows per digest section
+
+	RateLimits     map[string]string `split_words:"true" default:"api:600/1m,dashboard:120/1m,auth:10/1m"` // comma separated group:<requests>/<period> pairs, groups are api, dashboard, internal and auth
+	TrustedProxies []string          `split_words:"true"`                                                  // comma separated IPs or CIDRs of proxies in front, anonymous clients behind them are limited per X-Forwarded-For IP
 }
 
 // ImportsDir where to store the imports.
@@ -24,26 +73,26 @@ func (c Config) ImportsDir() string {
 }
 
 // GetBucket returns S3 bucket.
-func (c Config) GetBucket() string {
+func (c S3) GetBucket() string {
 	return c.S3Bucket
 }
 
 // GetEndpoint (optinal) returns S3 endpoint.
-func (c Config) GetEndpoint() string {
+func (c S3) GetEndpoint() string {
 	return c.S3Endpoint
 }
 
 // GetRegion returns S3 region.
-func (c Config) GetRegion() string {
+func (c S3) GetRegion() string {
 	return c.S3Region
 }
 
 // GetAccessKey returns AWS access keys.
-func (c Config) GetAccessKey() string {
+func (c S3) GetAccessKey() string {
 	return c.S3AccessKey
 }
 
 // GetSecret returns AWS secret.
-func (c Config) GetSecret() string {
+func (c S3) GetSecret() string {
 	return c.S3Secret
 }
@@ -0,0 +1,119 @@
+package digest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/rankings"
+	"github.com/mkorenkov/covid-19/pkg/regions"
+	"github.com/pkg/errors"
+)
+
+const (
+	moversWindow    = 7 * 24 * time.Hour
+	increasesWindow = 24 * time.Hour
+	moversMetric    = "new_cases_per_1m"
+	increasesMetric = "new_cases"
+)
+
+// Options what goes into the digest.
+type Options struct {
+	Limit      int           // rows per section
+	StaleAfter time.Duration // countries without datapoints for longer than this are listed as stale
+}
+
+// OptionsFromConfig reads COVIDDY_DIGEST_LIMIT, stale countries are the ones COVIDDY_QUALITY_STALE_AFTER reports.
+func OptionsFromConfig(cfg config.Config) Options {
+	return Options{Limit: cfg.DigestLimit, StaleAfter: cfg.QualityStaleAfter}
+}
+
+// Stale country without recent datapoints.
+type Stale struct {
+	Code        string
+	Name        string
+	LastUpdated time.Time
+	For         time.Duration
+}
+
+// Digest daily summary of the countries.
+type Digest struct {
+	Date      time.Time        // when the digest was built, in the recipients' timezone
+	Countries int              // countries with datapoints
+	Movers    []rankings.Entry // climbed the most in the ranking of 7-day new cases per 1M
+	Increases []rankings.Entry // most new cases over the last day
+	Stale     []Stale          // most recently stale first
+}
+
+// Build reads the stored countries and summarizes them as of now.
+func Build(db *bolt.DB, now time.Time, loc *time.Location, opts Options) (Digest, error) {
+	res := Digest{Date: now.In(loc)}
+	series := []rankings.Series{}
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, k := range documents.ListKeys(tx, documents.CountryCollection) {
+			if regions.IsTotal(k) {
+				continue
+			}
+			last, ok, err := documents.ReadLast(tx, k)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			res.Countries++
+			if age := now.Sub(last.GetWhen()); age > opts.StaleAfter {
+				res.Stale = append(res.Stale, Stale{Code: k, Name: last.Name, LastUpdated: last.GetWhen().In(loc), For: age.Round(time.Hour)})
+			}
+			// one more window back, so values carried forward into the previous window are there
+			docs, err := documents.ReadSeries(tx, k, now.Add(-3*moversWindow), now)
+			if err != nil {
+				return err
+			}
+			series = append(series, rankings.Series{Key: k, Docs: docs})
+		}
+		return nil
+	})
+	if err != nil {
+		return res, errors.Wrap(err, "error reading countries for the digest")
+	}
+
+	movers, err := rankings.ParseMetric(moversMetric)
+	if err != nil {
+		return res, err
+	}
+	for _, e := range rankings.Rank(series, movers, now, moversWindow, true) {
+		if e.Movement != nil && *e.Movement > 0 {
+			res.Movers = append(res.Movers, e)
+		}
+	}
+	sort.SliceStable(res.Movers, func(i, j int) bool {
+		return *res.Movers[i].Movement > *res.Movers[j].Movement
+	})
+	res.Movers = head(res.Movers, opts.Limit)
+
+	increases, err := rankings.ParseMetric(increasesMetric)
+	if err != nil {
+		return res, err
+	}
+	for _, e := range rankings.Rank(series, increases, now, increasesWindow, true) {
+		if e.Value > 0 {
+			res.Increases = append(res.Increases, e)
+		}
+	}
+	res.Increases = head(res.Increases, opts.Limit)
+
+	sort.Slice(res.Stale, func(i, j int) bool {
+		return res.Stale[i].LastUpdated.After(res.Stale[j].LastUpdated)
+	})
+	return res, nil
+}
+
+func head(entries []rankings.Entry, limit int) []rankings.Entry {
+	if limit > 0 && len(entries) > limit {
+		return entries[:limit]
+	}
+	return entries
+}
@@ -0,0 +1,112 @@
+package digest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/mailer"
+	"github.com/mkorenkov/covid-19/pkg/mailer/smtptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// daily saves a datapoint per day from June 1st until the last day, new cases change after June 8th.
+func daily(t *testing.T, db *bolt.DB, name string, population uint64, last int, before uint64, after uint64) {
+	docs := []documents.CollectionEntry{}
+	cases := uint64(0)
+	for day := 1; day <= last; day++ {
+		if day <= 8 {
+			cases += before
+		} else {
+			cases += after
+		}
+		docs = append(docs, documents.DataEntry{Name: name, When: time.Date(2020, 6, day, 12, 0, 0, 0, time.UTC), Cases: cases, Population: population})
+	}
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs, nil))
+}
+
+func testDB(t *testing.T) (*bolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "digest")
+	require.NoError(t, err)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+
+	daily(t, db, "Big", 100000000, 15, 1000, 500) // 70 then 35 per 1M a week
+	daily(t, db, "Small", 1000000, 15, 10, 90)    // 70 then 630 per 1M a week
+	daily(t, db, "Quiet", 1000000, 10, 0, 0)      // stopped reporting on June 10th
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	kyiv, err := time.LoadLocation("Europe/Kiev")
+	require.NoError(t, err)
+
+	d, err := Build(db, time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC), kyiv, Options{Limit: 10, StaleAfter: 48 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, 3, d.Countries)
+	assert.Equal(t, 15, d.Date.Hour())
+
+	require.Len(t, d.Movers, 1)
+	assert.Equal(t, "small", d.Movers[0].Code)
+	assert.Equal(t, 1, *d.Movers[0].Movement)
+
+	require.Len(t, d.Increases, 2)
+	assert.Equal(t, "big", d.Increases[0].Code)
+	assert.Equal(t, 500.0, d.Increases[0].Value)
+	assert.Equal(t, "small", d.Increases[1].Code)
+
+	require.Len(t, d.Stale, 1)
+	assert.Equal(t, "quiet", d.Stale[0].Code)
+	assert.Equal(t, 120*time.Hour, d.Stale[0].For)
+
+	m, err := Render(d, []string{"leadership@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "[coviddy] Daily digest, Mon, 15 Jun 2020", m.Subject)
+	assert.Contains(t, m.Text, "Small: #1, up 1 from #2, 630 per 1M")
+	assert.Contains(t, m.Text, "Big: +500")
+	assert.Contains(t, m.Text, "Quiet: last updated 2020-06-10 15:00 EEST, 5d 0h ago")
+	assert.Contains(t, m.HTML, "<td>Small</td>")
+}
+
+func TestSchedule(t *testing.T) {
+	s, err := ParseSchedule("08:30", "America/New_York")
+	require.NoError(t, err)
+	// 12:00 UTC is 08:00 EDT
+	assert.Equal(t, time.Date(2020, 6, 15, 12, 30, 0, 0, time.UTC), s.Next(time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)).UTC())
+	assert.Equal(t, time.Date(2020, 6, 16, 12, 30, 0, 0, time.UTC), s.Next(time.Date(2020, 6, 15, 12, 30, 0, 0, time.UTC)).UTC())
+
+	_, err = ParseSchedule("8am", "UTC")
+	assert.Error(t, err)
+	_, err = ParseSchedule("08:00", "Mars/Olympus")
+	assert.Error(t, err)
+}
+
+func TestSend(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	srv, err := smtptest.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	to := []string{"a@example.com", "b@example.com"}
+	m, err := Message(db, time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC), time.UTC, Options{Limit: 10, StaleAfter: 48 * time.Hour}, to)
+	require.NoError(t, err)
+	require.NoError(t, mailer.Send(mailer.Config{Addr: srv.Addr(), From: "coviddy@example.com", Username: "coviddy", Password: "secret"}, m))
+
+	received := srv.Messages()
+	require.Len(t, received, 1)
+	assert.Equal(t, "coviddy@example.com", received[0].From)
+	assert.Equal(t, to, received[0].To)
+	assert.True(t, strings.Contains(string(received[0].Data), "Subject: [coviddy] Daily digest, Mon, 15 Jun 2020"))
+}
@@ -0,0 +1,146 @@
+package digest
+
+import (
+	htmltemplate "html/template"
+	"math"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/mailer"
+	"github.com/pkg/errors"
+)
+
+const dateLayout = "Mon, 2 Jan 2006"
+
+const textTemplate = `Coviddy daily digest, {{ .Date.Format "` + dateLayout + `" }}
+{{ .Countries }} countries tracked.
+
+Top movers (7-day new cases per 1M)
+{{- range .Movers }}
+  {{ .Name }}: #{{ .Rank }}, up {{ deref .Movement }} from #{{ deref .PreviousRank }}, {{ number .Value }} per 1M
+{{- else }}
+  none
+{{- end }}
+
+Biggest daily increases (new cases over 24h)
+{{- range .Increases }}
+  {{ .Name }}: +{{ number .Value }}
+{{- else }}
+  none
+{{- end }}
+
+Stale countries
+{{- range .Stale }}
+  {{ .Name }}: last updated {{ .LastUpdated.Format "2006-01-02 15:04 MST" }}, {{ duration .For }} ago
+{{- else }}
+  none
+{{- end }}
+`
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h2>Coviddy daily digest, {{ .Date.Format "` + dateLayout + `" }}</h2>
+<p>{{ .Countries }} countries tracked.</p>
+
+<h3>Top movers (7-day new cases per 1M)</h3>
+{{ if .Movers -}}
+<table cellpadding="4">
+<tr><th align="left">Country</th><th align="right">Rank</th><th align="right">Up</th><th align="right">Per 1M</th></tr>
+{{- range .Movers }}
+<tr><td>{{ .Name }}</td><td align="right">#{{ .Rank }}</td><td align="right">&#9650; {{ deref .Movement }}</td><td align="right">{{ number .Value }}</td></tr>
+{{- end }}
+</table>
+{{- else -}}
+<p>None.</p>
+{{- end }}
+
+<h3>Biggest daily increases (new cases over 24h)</h3>
+{{ if .Increases -}}
+<table cellpadding="4">
+<tr><th align="left">Country</th><th align="right">New cases</th></tr>
+{{- range .Increases }}
+<tr><td>{{ .Name }}</td><td align="right">+{{ number .Value }}</td></tr>
+{{- end }}
+</table>
+{{- else -}}
+<p>None.</p>
+{{- end }}
+
+<h3>Stale countries</h3>
+{{ if .Stale -}}
+<table cellpadding="4">
+<tr><th align="left">Country</th><th align="left">Last updated</th><th align="right">Stale for</th></tr>
+{{- range .Stale }}
+<tr><td>{{ .Name }}</td><td>{{ .LastUpdated.Format "2006-01-02 15:04 MST" }}</td><td align="right">{{ duration .For }}</td></tr>
+{{- end }}
+</table>
+{{- else -}}
+<p>None.</p>
+{{- end }}
+</body>
+</html>
+`
+
+// number rounds to integers above 10 and groups thousands: 1,234,567 or 3.5.
+func number(v float64) string {
+	if math.Abs(v) < 10 {
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	digits := strconv.FormatFloat(math.Abs(math.Round(v)), 'f', 0, 64)
+	groups := []string{}
+	for len(digits) > 3 {
+		groups = append([]string{digits[len(digits)-3:]}, groups...)
+		digits = digits[:len(digits)-3]
+	}
+	res := strings.Join(append([]string{digits}, groups...), ",")
+	if v < 0 {
+		return "-" + res
+	}
+	return res
+}
+
+func deref(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+var funcs = map[string]interface{}{
+	"number":   number,
+	"deref":    deref,
+	"duration": formatDuration,
+}
+
+var (
+	textDigest = texttemplate.Must(texttemplate.New("text").Funcs(funcs).Parse(textTemplate))
+	htmlDigest = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(htmlTemplate))
+)
+
+// Render renders the digest as an email with a plain text and an HTML body.
+func Render(d Digest, to []string) (mailer.Message, error) {
+	res := mailer.Message{To: to, Subject: "[coviddy] Daily digest, " + d.Date.Format(dateLayout)}
+	text := &strings.Builder{}
+	if err := textDigest.Execute(text, d); err != nil {
+		return res, errors.Wrap(err, "error rendering digest text")
+	}
+	html := &strings.Builder{}
+	if err := htmlDigest.Execute(html, d); err != nil {
+		return res, errors.Wrap(err, "error rendering digest HTML")
+	}
+	res.Text, res.HTML = text.String(), html.String()
+	return res, nil
+}
+
+// formatDuration "3d 4h" rather than "76h0m0s".
+func formatDuration(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int((d % (24 * time.Hour)) / time.Hour)
+	if days == 0 {
+		return strconv.Itoa(hours) + "h"
+	}
+	return strconv.Itoa(days) + "d " + strconv.Itoa(hours) + "h"
+}
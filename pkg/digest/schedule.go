@@ -0,0 +1,82 @@
+package digest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/mailer"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+// Schedule time of the day the digest goes out.
+type Schedule struct {
+	Hour     int
+	Minute   int
+	Location *time.Location
+}
+
+// ParseSchedule parses "HH:MM" in the IANA timezone, e.g. "08:00" in "Europe/Kiev".
+func ParseSchedule(at string, timezone string) (Schedule, error) {
+	res := Schedule{}
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return res, errors.Errorf("invalid digest time %q, expected HH:MM", at)
+	}
+	if res.Location, err = time.LoadLocation(timezone); err != nil {
+		return res, errors.Wrapf(err, "invalid digest timezone %q", timezone)
+	}
+	res.Hour, res.Minute = t.Hour(), t.Minute()
+	return res, nil
+}
+
+// Next the first scheduled time after now.
+func (s Schedule) Next(now time.Time) time.Time {
+	local := now.In(s.Location)
+	res := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, s.Minute, 0, 0, s.Location)
+	if !res.After(local) {
+		res = time.Date(local.Year(), local.Month(), local.Day()+1, s.Hour, s.Minute, 0, 0, s.Location)
+	}
+	return res
+}
+
+// Message builds and renders the digest as of now.
+func Message(db *bolt.DB, now time.Time, loc *time.Location, opts Options, to []string) (mailer.Message, error) {
+	d, err := Build(db, now, loc, opts)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	return Render(d, to)
+}
+
+// Run sends the digest to the recipients on schedule.
+func Run(ctx context.Context, db *bolt.DB, cfg mailer.Config, to []string, schedule Schedule, opts Options) {
+	errorChan := requestcontext.Errors(ctx)
+	if errorChan == nil {
+		panic(errors.New("Could not retrieve error chan from context"))
+	}
+
+	for {
+		next := schedule.Next(time.Now())
+		log.Printf("[INFO] Next digest at %s\n", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		m, err := Message(db, time.Now(), schedule.Location, opts, to)
+		if err == nil {
+			err = mailer.Send(cfg, m)
+		}
+		if err != nil {
+			errorChan <- errors.Wrap(err, "Failed to send the daily digest")
+			continue
+		}
+		log.Printf("[INFO] Sent the daily digest to %d recipients\n", len(to))
+	}
+}
@@ -19,7 +19,12 @@ func (e sentinelError) Error() string {
 const BucketNotFoundError = sentinelError("Bucket not found")
 
 func key(doc CollectionEntry) string {
-	name := strings.TrimSpace(doc.GetName())
+	return Key(doc.GetName())
+}
+
+// Key returns the bucket key for the given country / state name.
+func Key(name string) string {
+	name = strings.TrimSpace(name)
 	name = strings.ToLower(name)
 	name = strings.ReplaceAll(name, ". ", "_")
 	name = strings.ReplaceAll(name, " ", "_")
@@ -27,9 +32,35 @@ func key(doc CollectionEntry) string {
 	return name
 }
 
+// IsDocumentBucket tells top-level document buckets (lower-cased keys) from the capitalized
+// system buckets such as Countries, States or Flags.
+func IsDocumentBucket(name string) bool {
+	return name == strings.ToLower(name)
+}
+
+// PutDatapoint stores the datapoint body under its key and bumps the bucket sequence,
+// so readers can tell the series changed even when an existing datapoint got overwritten.
+func PutDatapoint(bucket *bolt.Bucket, key []byte, body []byte) error {
+	if err := bucket.Put(key, body); err != nil {
+		return err
+	}
+	_, err := bucket.NextSequence()
+	return err
+}
+
 // BulkSave optionally creates bucket if it does not exists and saves entries to it.
-func BulkSave(db *bolt.DB, collectionname string, docs []CollectionEntry) error {
+// Entries are run through the validator first (nil validator accepts everything).
+func BulkSave(db *bolt.DB, collectionname string, docs []CollectionEntry, validator Validator) error {
+	_, err := BulkSaveAccepted(db, collectionname, docs, validator)
+	return err
+}
+
+// BulkSaveAccepted is BulkSave that also returns the entries the validator accepted, i.e. the stored ones.
+func BulkSaveAccepted(db *bolt.DB, collectionname string, docs []CollectionEntry, validator Validator) ([]CollectionEntry, error) {
+	var accepted []CollectionEntry
 	err := db.Batch(func(tx *bolt.Tx) error {
+		// batched transactions may be retried
+		accepted = []CollectionEntry{}
 		masterCollectionBucket, txErr := tx.CreateBucketIfNotExists([]byte(collectionname))
 		if txErr != nil {
 			return errors.Wrapf(txErr, "error creating %s bucket", collectionname)
@@ -39,7 +70,21 @@ func BulkSave(db *bolt.DB, collectionname string, docs []CollectionEntry) error
 			if doc.GetName() == "" {
 				continue
 			}
-			bucketKey := key(doc)
+			bucketKey := ResolveAlias(tx, key(doc))
+
+			verdict, txErr := validate(tx, validator, bucketKey, doc)
+			if txErr != nil {
+				return txErr
+			}
+			switch verdict {
+			case Rejected:
+				continue
+			case Quarantined:
+				if txErr := quarantine(tx, bucketKey, doc); txErr != nil {
+					return txErr
+				}
+				continue
+			}
 
 			docBucket, txErr := tx.CreateBucketIfNotExists([]byte(bucketKey))
 			if txErr != nil {
@@ -52,13 +97,17 @@ func BulkSave(db *bolt.DB, collectionname string, docs []CollectionEntry) error
 			if txErr != nil {
 				return errors.Wrap(txErr, "JSON marshal error")
 			}
-			if txErr := docBucket.Put([]byte(doc.GetWhen().UTC().Format(time.RFC3339)), docBody); txErr != nil {
+			if txErr := PutDatapoint(docBucket, []byte(doc.GetWhen().UTC().Format(time.RFC3339)), docBody); txErr != nil {
 				return errors.Wrapf(txErr, "error creating %s record in %s", doc.GetName(), bucketKey)
 			}
+			accepted = append(accepted, doc)
 		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return accepted, nil
 }
 
 // Save optionally creates bucket if it does not exists and saves entry to it.
@@ -72,7 +121,7 @@ func Save(db *bolt.DB, collectionname string, doc CollectionEntry) error {
 		if doc.GetName() == "" {
 			return nil
 		}
-		bucketKey := key(doc)
+		bucketKey := ResolveAlias(tx, key(doc))
 
 		docBucket, txErr := tx.CreateBucketIfNotExists([]byte(bucketKey))
 		if txErr != nil {
@@ -85,7 +134,7 @@ func Save(db *bolt.DB, collectionname string, doc CollectionEntry) error {
 		if txErr != nil {
 			return errors.Wrap(txErr, "JSON marshal error")
 		}
-		if txErr := docBucket.Put([]byte(doc.GetWhen().UTC().Format(time.RFC3339)), docBody); txErr != nil {
+		if txErr := PutDatapoint(docBucket, []byte(doc.GetWhen().UTC().Format(time.RFC3339)), docBody); txErr != nil {
 			return errors.Wrapf(txErr, "error creating %s record in %s", doc.GetName(), bucketKey)
 		}
 		return nil
@@ -94,25 +143,41 @@ func Save(db *bolt.DB, collectionname string, doc CollectionEntry) error {
 }
 
 // FindBucketAndSave does not create bucket if that does not exist. Saves the entry to the given bucket if it does.
-func FindBucketAndSave(db *bolt.DB, doc CollectionEntry) error {
+// The entry is run through the validator first (nil validator accepts everything), the verdict is returned.
+func FindBucketAndSave(db *bolt.DB, doc CollectionEntry, validator Validator) (Verdict, error) {
+	verdict := Accepted
 	err := db.Batch(func(tx *bolt.Tx) error {
+		verdict = Accepted
 		if doc.GetName() == "" {
 			return nil
 		}
-		bucketKey := key(doc)
+		bucketKey := ResolveAlias(tx, key(doc))
 
 		docBucket := tx.Bucket([]byte(bucketKey))
 		if docBucket == nil {
 			return errors.Wrapf(BucketNotFoundError, "Bucket %s was not found", bucketKey)
 		}
+
+		var txErr error
+		verdict, txErr = validate(tx, validator, bucketKey, doc)
+		if txErr != nil {
+			return txErr
+		}
+		switch verdict {
+		case Rejected:
+			return nil
+		case Quarantined:
+			return quarantine(tx, bucketKey, doc)
+		}
+
 		docBody, txErr := json.Marshal(doc)
 		if txErr != nil {
 			return errors.Wrap(txErr, "JSON marshal error")
 		}
-		if txErr := docBucket.Put([]byte(doc.GetWhen().UTC().Format(time.RFC3339)), docBody); txErr != nil {
+		if txErr := PutDatapoint(docBucket, []byte(doc.GetWhen().UTC().Format(time.RFC3339)), docBody); txErr != nil {
 			return errors.Wrapf(txErr, "error creating %s record in %s", doc.GetName(), bucketKey)
 		}
 		return nil
 	})
-	return err
+	return verdict, err
 }
@@ -0,0 +1,65 @@
+package documents
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T) (*bolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "documents")
+	require.NoError(t, err)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func entry(name string, day int, cases uint64) DataEntry {
+	return DataEntry{Name: name, When: time.Date(2020, 6, day, 0, 0, 0, 0, time.UTC), Cases: cases}
+}
+
+func count(t *testing.T, db *bolt.DB, bucketKey string) int {
+	res := 0
+	err := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucketKey)); b != nil {
+			res = b.Stats().KeyN
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return res
+}
+
+// verdictByCases quarantines datapoints with 0 cases and rejects ones with less than 10.
+type verdictByCases struct{}
+
+func (verdictByCases) Validate(tx *bolt.Tx, bucketKey string, doc CollectionEntry) (Verdict, error) {
+	switch cases := doc.(DataEntry).Cases; {
+	case cases == 0:
+		return Quarantined, nil
+	case cases < 10:
+		return Rejected, nil
+	}
+	return Accepted, nil
+}
+
+func TestBulkSaveAccepted(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	docs := []CollectionEntry{entry("USA", 1, 10), entry("USA", 2, 5), entry("Italy", 1, 0), entry("Italy", 2, 20)}
+	accepted, err := BulkSaveAccepted(db, CountryCollection, docs, verdictByCases{})
+	require.NoError(t, err)
+	assert.Equal(t, []CollectionEntry{entry("USA", 1, 10), entry("Italy", 2, 20)}, accepted)
+	assert.Equal(t, 1, count(t, db, "usa"))
+	assert.Equal(t, 1, count(t, db, "italy"))
+}
@@ -24,11 +24,13 @@ type CollectionEntry interface {
 }
 
 type DataEntry struct {
-	Name   string    `json:"name"`
-	When   time.Time `json:"when"`
-	Cases  uint64    `json:"total_cases"`
-	Deaths uint64    `json:"total_deaths"`
-	Tests  uint64    `json:"total_tests"`
+	Name       string    `json:"name"`
+	When       time.Time `json:"when"`
+	Cases      uint64    `json:"total_cases"`
+	Deaths     uint64    `json:"total_deaths"`
+	Tests      uint64    `json:"total_tests"`
+	Region     string    `json:"region,omitempty"`     // countries only
+	Population uint64    `json:"population,omitempty"` // countries only
 }
 
 func (s DataEntry) Save(w io.Writer) error {
@@ -63,10 +65,12 @@ func FromState(state worldometers.UnitedState) *DataEntry {
 
 func FromCountry(country worldometers.Country) *DataEntry {
 	return &DataEntry{
-		When:   time.Now(),
-		Name:   country.Name,
-		Cases:  country.TotalCases,
-		Deaths: country.TotalDeaths,
-		Tests:  country.TotalTests,
+		When:       time.Now(),
+		Name:       country.Name,
+		Cases:      country.TotalCases,
+		Deaths:     country.TotalDeaths,
+		Tests:      country.TotalTests,
+		Region:     country.Region,
+		Population: country.Population,
 	}
 }
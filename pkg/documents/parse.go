@@ -2,6 +2,8 @@ package documents
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,14 +19,16 @@ const InvalidDateError = sentinelError("DataEntry timestamp is earlier than Dec
 // "total_tests" stored in "tests_per_1m" json field. Important to note,
 // "region" filed contains "population" of the country.
 type legacyCountryData struct {
-	Name           string    `json:"name"`
-	When           time.Time `json:"when"`
-	Cases          uint64    `json:"total_cases"`
-	Deaths         uint64    `json:"total_deaths"`
-	Tests          uint64    `json:"total_tests"`
-	PossibleCases  uint64    `json:"cases_per_1m"`  // make sure to ignore when importing from https://github.com/edoc-hcraes/covid-19-data
-	PossibleDeaths uint64    `json:"deaths_per_1m"` // make sure to ignore when importing from https://github.com/edoc-hcraes/covid-19-data
-	PossibleTests  uint64    `json:"tests_per_1m"`  // except for corrupted entries: make sure to ignore when importing from https://github.com/edoc-hcraes/covid-19-data
+	Name           string      `json:"name"`
+	When           time.Time   `json:"when"`
+	Cases          uint64      `json:"total_cases"`
+	Deaths         uint64      `json:"total_deaths"`
+	Tests          uint64      `json:"total_tests"`
+	PossibleCases  uint64      `json:"cases_per_1m"`  // make sure to ignore when importing from https://github.com/edoc-hcraes/covid-19-data
+	PossibleDeaths uint64      `json:"deaths_per_1m"` // make sure to ignore when importing from https://github.com/edoc-hcraes/covid-19-data
+	PossibleTests  uint64      `json:"tests_per_1m"`  // except for corrupted entries: make sure to ignore when importing from https://github.com/edoc-hcraes/covid-19-data
+	Population     float64     `json:"population"`    // tests per 1M in corrupted entries
+	Region         interface{} `json:"region"`        // population in corrupted entries, e.g. "330,885,824"
 }
 
 // NoValidationsParse does not perform validations. Use Parse instead
@@ -39,6 +43,14 @@ func NoValidationsParse(payload []byte) (DataEntry, error) {
 			Deaths: legacyCountryEntry.Deaths,
 			Tests:  legacyCountryEntry.Tests,
 		}
+		res.Population = uint64(legacyCountryEntry.Population)
+		if region, ok := legacyCountryEntry.Region.(string); ok {
+			if population, isPopulation := parseNumber(region); isPopulation {
+				res.Population = population
+			} else {
+				res.Region = region
+			}
+		}
 		if legacyCountryEntry.PossibleCases > legacyCountryEntry.Cases {
 			res.Cases = legacyCountryEntry.PossibleCases
 		}
@@ -56,6 +68,12 @@ func NoValidationsParse(payload []byte) (DataEntry, error) {
 	return res, nil
 }
 
+// parseNumber tells formatted numbers such as "330,885,824" apart from region names.
+func parseNumber(v string) (uint64, bool) {
+	res, err := strconv.ParseUint(strings.ReplaceAll(v, ",", ""), 10, 64)
+	return res, err == nil
+}
+
 // Parse parses country / state data from JSON
 func Parse(payload []byte) (CollectionEntry, error) {
 	res, err := NoValidationsParse(payload)
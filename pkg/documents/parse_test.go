@@ -41,6 +41,18 @@ func TestParseCountriesAndStates(t *testing.T) {
 	}
 }
 
+func TestParseRegionAndPopulation(t *testing.T) {
+	vietnam, err := NoValidationsParse([]byte(`{"name":"Vietnam","when":"2020-06-28T01:09:01-07:00","total_cases":355,"population":97329851,"region":"Asia"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Asia", vietnam.Region)
+	assert.Equal(t, uint64(97329851), vietnam.Population)
+
+	corrupted, err := NoValidationsParse([]byte(`{"name":"USA","when":"2020-06-01T22:47:18Z","total_cases":2026493,"population":65657,"region":"330,885,824"}`))
+	require.NoError(t, err)
+	assert.Empty(t, corrupted.Region)
+	assert.Equal(t, uint64(330885824), corrupted.Population)
+}
+
 func TestParseInvalidDate(t *testing.T) {
 	testCases := []string{
 		`{"name": "USA", "total_cases":2026493,"total_deaths":113055,"total_recoverred":773480,"total_tests":342,"active_cases":0,"critical_cases":1139958,"cases_per_1m":16907,"deaths_per_1m":6124,"tests_per_1m":21725064,"population":65657,"region":"330,885,824"}`,
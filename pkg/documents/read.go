@@ -0,0 +1,73 @@
+package documents
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// ReadSeries reads datapoints stored between from and to (inclusive), oldest first.
+// bucketKey is resolved through aliases, BucketNotFoundError is returned for unknown series.
+func ReadSeries(tx *bolt.Tx, bucketKey string, from time.Time, to time.Time) ([]DataEntry, error) {
+	bucketKey = ResolveAlias(tx, bucketKey)
+	bucket := tx.Bucket([]byte(bucketKey))
+	if bucket == nil {
+		return nil, errors.Wrapf(BucketNotFoundError, "Bucket %s was not found", bucketKey)
+	}
+	min := []byte(from.UTC().Format(time.RFC3339))
+	max := []byte(to.UTC().Format(time.RFC3339))
+
+	res := []DataEntry{}
+	c := bucket.Cursor()
+	for k, v := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+		doc, err := NoValidationsParse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding %s/%s", bucketKey, k)
+		}
+		res = append(res, doc)
+	}
+	return res, nil
+}
+
+// ReadLast reads the newest datapoint of the series, false when there is none.
+func ReadLast(tx *bolt.Tx, bucketKey string) (DataEntry, bool, error) {
+	bucket := tx.Bucket([]byte(bucketKey))
+	if bucket == nil {
+		return DataEntry{}, false, nil
+	}
+	_, payload := bucket.Cursor().Last()
+	if payload == nil {
+		return DataEntry{}, false, nil
+	}
+	doc, err := NoValidationsParse(payload)
+	if err != nil {
+		return DataEntry{}, false, errors.Wrapf(err, "error decoding %s", bucketKey)
+	}
+	return doc, true, nil
+}
+
+// ListKeys returns bucket keys of all series in the collection.
+func ListKeys(tx *bolt.Tx, collection string) []string {
+	res := []string{}
+	masterCollectionBucket := tx.Bucket([]byte(collection))
+	if masterCollectionBucket == nil {
+		return res
+	}
+	masterCollectionBucket.ForEach(func(k, v []byte) error {
+		res = append(res, string(v))
+		return nil
+	})
+	return res
+}
+
+// CollectionOf finds the collection the series belongs to.
+func CollectionOf(tx *bolt.Tx, bucketKey string) (string, bool) {
+	for _, collection := range []string{CountryCollection, StateCollection} {
+		if master := tx.Bucket([]byte(collection)); master != nil && master.Get([]byte(bucketKey)) != nil {
+			return collection, true
+		}
+	}
+	return "", false
+}
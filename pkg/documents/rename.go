@@ -0,0 +1,251 @@
+package documents
+
+import (
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// AliasesBucket maps keys of renamed / merged series to the keys they live under now.
+const AliasesBucket = "Aliases"
+
+// InvalidRenameError names given to Rename or Merge can not work, whatever is stored.
+const InvalidRenameError = sentinelError("Invalid rename")
+
+// OverlapPolicy decides which datapoint survives when both series have one with the same timestamp.
+type OverlapPolicy string
+
+const (
+	// KeepTarget keeps the datapoint of the series being merged into.
+	KeepTarget = OverlapPolicy("keep_target")
+	// PreferSource overwrites the datapoint with the one from the series being merged.
+	PreferSource = OverlapPolicy("prefer_source")
+	// MaxCases keeps the datapoint reporting more cases.
+	MaxCases = OverlapPolicy("max_cases")
+	// FailOnOverlap aborts the merge.
+	FailOnOverlap = OverlapPolicy("fail")
+)
+
+// ParseOverlapPolicy converts user input into OverlapPolicy, empty string means KeepTarget.
+func ParseOverlapPolicy(v string) (OverlapPolicy, error) {
+	if v == "" {
+		return KeepTarget, nil
+	}
+	switch p := OverlapPolicy(v); p {
+	case KeepTarget, PreferSource, MaxCases, FailOnOverlap:
+		return p, nil
+	}
+	return "", errors.Errorf("unknown overlap policy %q", v)
+}
+
+// ParseCollection accepts collection name in any case, e.g. "countries" or "States".
+func ParseCollection(v string) (string, error) {
+	for _, c := range []string{CountryCollection, StateCollection} {
+		if strings.EqualFold(v, c) {
+			return c, nil
+		}
+	}
+	return "", errors.Errorf("unknown collection %q", v)
+}
+
+// MergeResult describes what happened to the series.
+type MergeResult struct {
+	Collection  string `json:"collection"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Moved       int    `json:"moved"`
+	Overlapping int    `json:"overlapping"`
+	Replaced    int    `json:"replaced"`
+}
+
+// ResolveAlias returns the key the series with the given key lives under.
+func ResolveAlias(tx *bolt.Tx, bucketKey string) string {
+	aliases := tx.Bucket([]byte(AliasesBucket))
+	if aliases == nil {
+		return bucketKey
+	}
+	if target := aliases.Get([]byte(bucketKey)); target != nil {
+		return string(target)
+	}
+	return bucketKey
+}
+
+// Rename moves the series to a new name. Fails if a series with the new name already exists.
+// Later saves under the old name land in the renamed series.
+func Rename(db *bolt.DB, collection string, from string, to string) (MergeResult, error) {
+	return move(db, collection, from, to, false, FailOnOverlap)
+}
+
+// Merge moves all datapoints of one series into another one, resolving overlapping timestamps with the policy.
+// Later saves under the old name land in the merged series.
+func Merge(db *bolt.DB, collection string, from string, into string, policy OverlapPolicy) (MergeResult, error) {
+	return move(db, collection, from, into, true, policy)
+}
+
+func move(db *bolt.DB, collection string, from string, to string, merge bool, policy OverlapPolicy) (MergeResult, error) {
+	res := MergeResult{Collection: collection, From: Key(from), To: Key(to)}
+	if res.From == "" || res.To == "" {
+		return res, errors.Wrap(InvalidRenameError, "both names are required")
+	}
+	if res.From == res.To {
+		return res, errors.Wrapf(InvalidRenameError, "%s and %s have the same key", from, to)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		res.Moved, res.Overlapping, res.Replaced = 0, 0, 0
+		master := tx.Bucket([]byte(collection))
+		if master == nil || master.Get([]byte(res.From)) == nil {
+			return errors.Wrapf(BucketNotFoundError, "%s is not in %s", res.From, collection)
+		}
+		src := tx.Bucket([]byte(res.From))
+		if src == nil {
+			return errors.Wrapf(BucketNotFoundError, "Bucket %s was not found", res.From)
+		}
+		dst := tx.Bucket([]byte(res.To))
+		switch {
+		case dst != nil && !merge:
+			return errors.Errorf("%s already exists, merge instead", res.To)
+		case dst == nil && merge:
+			return errors.Wrapf(BucketNotFoundError, "Bucket %s was not found", res.To)
+		case dst != nil && master.Get([]byte(res.To)) == nil:
+			return errors.Errorf("%s is not in %s", res.To, collection)
+		}
+		dst, txErr := tx.CreateBucketIfNotExists([]byte(res.To))
+		if txErr != nil {
+			return errors.Wrapf(txErr, "error creating %s bucket", res.To)
+		}
+
+		txErr = src.ForEach(func(k, v []byte) error {
+			existing := dst.Get(k)
+			if existing == nil {
+				res.Moved++
+				return PutDatapoint(dst, clone(k), clone(v))
+			}
+			res.Overlapping++
+			replace, err := overlap(policy, existing, v)
+			if err != nil {
+				return errors.Wrapf(err, "%s/%s", res.From, k)
+			}
+			if !replace {
+				return nil
+			}
+			res.Replaced++
+			return PutDatapoint(dst, clone(k), clone(v))
+		})
+		if txErr != nil {
+			return errors.Wrapf(txErr, "error moving %s to %s", res.From, res.To)
+		}
+
+		for _, nested := range []string{FlagsBucket, QuarantineBucket} {
+			if txErr := moveNested(tx, nested, res.From, res.To); txErr != nil {
+				return txErr
+			}
+		}
+		if txErr := tx.DeleteBucket([]byte(res.From)); txErr != nil {
+			return errors.Wrapf(txErr, "error removing %s bucket", res.From)
+		}
+		if txErr := master.Delete([]byte(res.From)); txErr != nil {
+			return errors.Wrapf(txErr, "error removing %s record from %s", res.From, collection)
+		}
+		if txErr := master.Put([]byte(res.To), []byte(res.To)); txErr != nil {
+			return errors.Wrapf(txErr, "error creating %s record in %s", res.To, collection)
+		}
+		return addAlias(tx, res.From, res.To)
+	})
+	return res, err
+}
+
+// overlap tells whether the incoming datapoint should replace the existing one.
+func overlap(policy OverlapPolicy, existing []byte, incoming []byte) (bool, error) {
+	switch policy {
+	case KeepTarget:
+		return false, nil
+	case PreferSource:
+		return true, nil
+	case MaxCases:
+		existingEntry, err := NoValidationsParse(existing)
+		if err != nil {
+			return false, err
+		}
+		incomingEntry, err := NoValidationsParse(incoming)
+		if err != nil {
+			return false, err
+		}
+		return incomingEntry.Cases > existingEntry.Cases, nil
+	}
+	return false, errors.New("overlapping timestamps")
+}
+
+// moveNested moves topLevel/from entries to topLevel/to, existing entries are kept.
+func moveNested(tx *bolt.Tx, topLevel string, from string, to string) error {
+	top := tx.Bucket([]byte(topLevel))
+	if top == nil || top.Bucket([]byte(from)) == nil {
+		return nil
+	}
+	dst, err := top.CreateBucketIfNotExists([]byte(to))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket in %s", to, topLevel)
+	}
+	err = top.Bucket([]byte(from)).ForEach(func(k, v []byte) error {
+		if v == nil || dst.Get(k) != nil {
+			return nil
+		}
+		return dst.Put(clone(k), clone(v))
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error moving %s/%s", topLevel, from)
+	}
+	return top.DeleteBucket([]byte(from))
+}
+
+// addAlias records from -> to and re-points aliases that used to lead to from.
+func addAlias(tx *bolt.Tx, from string, to string) error {
+	aliases, err := tx.CreateBucketIfNotExists([]byte(AliasesBucket))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket", AliasesBucket)
+	}
+	repoint := [][]byte{}
+	err = aliases.ForEach(func(k, v []byte) error {
+		if string(v) == from {
+			repoint = append(repoint, clone(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error reading aliases")
+	}
+	for _, k := range repoint {
+		if err := aliases.Put(k, []byte(to)); err != nil {
+			return errors.Wrapf(err, "error updating alias %s", k)
+		}
+	}
+	// renaming back to an old name: that name is a series again, not an alias
+	if err := aliases.Delete([]byte(to)); err != nil {
+		return errors.Wrapf(err, "error removing alias %s", to)
+	}
+	if err := aliases.Put([]byte(from), []byte(to)); err != nil {
+		return errors.Wrapf(err, "error creating alias %s", from)
+	}
+	return nil
+}
+
+// Aliases returns all recorded aliases, old key -> current key.
+func Aliases(db *bolt.DB) (map[string]string, error) {
+	res := map[string]string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		aliases := tx.Bucket([]byte(AliasesBucket))
+		if aliases == nil {
+			return nil
+		}
+		return aliases.ForEach(func(k, v []byte) error {
+			res[string(k)] = string(v)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// clone copies bolt owned slices, those are not safe to use across writes.
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
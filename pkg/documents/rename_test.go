@@ -0,0 +1,73 @@
+package documents
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameAndAlias(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, BulkSave(db, CountryCollection, []CollectionEntry{entry("S. Korea", 1, 10), entry("S. Korea", 2, 20)}, nil))
+	res, err := Rename(db, CountryCollection, "S. Korea", "South Korea")
+	require.NoError(t, err)
+	assert.Equal(t, "s_korea", res.From)
+	assert.Equal(t, "south_korea", res.To)
+	assert.Equal(t, 2, res.Moved)
+
+	require.NoError(t, BulkSave(db, CountryCollection, []CollectionEntry{entry("S. Korea", 3, 30)}, nil))
+	assert.Equal(t, 0, count(t, db, "s_korea"))
+	assert.Equal(t, 3, count(t, db, "south_korea"))
+
+	err = db.View(func(tx *bolt.Tx) error {
+		master := tx.Bucket([]byte(CountryCollection))
+		assert.Nil(t, master.Get([]byte("s_korea")))
+		assert.NotNil(t, master.Get([]byte("south_korea")))
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = Rename(db, CountryCollection, "Atlantis", "Narnia")
+	assert.True(t, errors.Is(err, BucketNotFoundError))
+	_, err = Rename(db, CountryCollection, "South Korea", "south korea")
+	assert.True(t, errors.Is(err, InvalidRenameError))
+	_, err = Rename(db, CountryCollection, "", "Narnia")
+	assert.True(t, errors.Is(err, InvalidRenameError))
+}
+
+func TestMergeOverlapPolicies(t *testing.T) {
+	for policy, expectedCases := range map[OverlapPolicy]uint64{KeepTarget: 100, PreferSource: 5, MaxCases: 100} {
+		db, cleanup := openTestDB(t)
+
+		require.NoError(t, BulkSave(db, CountryCollection, []CollectionEntry{entry("Reunion", 1, 5), entry("Reunion", 2, 6), entry("France", 1, 100)}, nil))
+		res, err := Merge(db, CountryCollection, "Reunion", "France", policy)
+		require.NoError(t, err, policy)
+		assert.Equal(t, 1, res.Moved)
+		assert.Equal(t, 1, res.Overlapping)
+		assert.Equal(t, 2, count(t, db, "france"))
+
+		err = db.View(func(tx *bolt.Tx) error {
+			doc, parseErr := NoValidationsParse(tx.Bucket([]byte("france")).Get([]byte("2020-06-01T00:00:00Z")))
+			require.NoError(t, parseErr)
+			assert.Equal(t, expectedCases, doc.Cases, policy)
+			return nil
+		})
+		require.NoError(t, err)
+		aliases, err := Aliases(db)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"reunion": "france"}, aliases)
+		cleanup()
+	}
+
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+	require.NoError(t, BulkSave(db, CountryCollection, []CollectionEntry{entry("Reunion", 1, 5), entry("France", 1, 100)}, nil))
+	_, err := Merge(db, CountryCollection, "Reunion", "France", FailOnOverlap)
+	require.Error(t, err)
+	assert.Equal(t, 1, count(t, db, "reunion"), "failed merge is rolled back")
+}
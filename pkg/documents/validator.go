@@ -0,0 +1,80 @@
+package documents
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FlagsBucket holds validation flags, one nested bucket per document bucket.
+	FlagsBucket = "Flags"
+	// QuarantineBucket holds documents that were not admitted to their series, one nested bucket per document bucket.
+	QuarantineBucket = "Quarantine"
+)
+
+// Verdict tells the save functions what to do with a document.
+type Verdict int
+
+const (
+	// Accepted documents are written to their series.
+	Accepted Verdict = iota
+	// Quarantined documents are kept aside in QuarantineBucket.
+	Quarantined
+	// Rejected documents are dropped.
+	Rejected
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Quarantined:
+		return "quarantined"
+	case Rejected:
+		return "rejected"
+	}
+	return "accepted"
+}
+
+// Validator checks a document against the series it is about to join.
+// It runs inside the write transaction, so it sees documents saved earlier in the same batch.
+type Validator interface {
+	Validate(tx *bolt.Tx, bucketKey string, doc CollectionEntry) (Verdict, error)
+}
+
+func validate(tx *bolt.Tx, validator Validator, bucketKey string, doc CollectionEntry) (Verdict, error) {
+	if validator == nil {
+		return Accepted, nil
+	}
+	verdict, err := validator.Validate(tx, bucketKey, doc)
+	if err != nil {
+		return verdict, errors.Wrapf(err, "error validating %s", doc.GetName())
+	}
+	return verdict, nil
+}
+
+// quarantine stores the document in QuarantineBucket.
+func quarantine(tx *bolt.Tx, bucketKey string, doc CollectionEntry) error {
+	return PutNested(tx, QuarantineBucket, bucketKey, doc.GetWhen(), doc)
+}
+
+// PutNested JSON encodes value and stores it in topLevel/bucketKey under the given timestamp.
+func PutNested(tx *bolt.Tx, topLevel string, bucketKey string, when time.Time, value interface{}) error {
+	top, err := tx.CreateBucketIfNotExists([]byte(topLevel))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket", topLevel)
+	}
+	nested, err := top.CreateBucketIfNotExists([]byte(bucketKey))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket in %s", bucketKey, topLevel)
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrap(err, "JSON marshal error")
+	}
+	if err := nested.Put([]byte(when.UTC().Format(time.RFC3339)), body); err != nil {
+		return errors.Wrapf(err, "error creating record in %s/%s", topLevel, bucketKey)
+	}
+	return nil
+}
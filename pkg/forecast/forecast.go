@@ -0,0 +1,263 @@
+package forecast
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// z of the 95% prediction interval.
+const z95 = 1.96
+
+// NotEnoughDataError the series is too short or too flat to fit the model.
+const NotEnoughDataError = sentinelError("not enough data to fit the model")
+
+type sentinelError string
+
+func (e sentinelError) Error() string {
+	return string(e)
+}
+
+// Prediction forecast value with its 95% prediction interval.
+type Prediction struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Model fits the cumulative daily series (oldest first) and predicts the next horizon days.
+type Model func(y []float64, horizon int) ([]Prediction, error)
+
+// Models available models by name.
+var Models = map[string]Model{
+	"log_linear": LogLinear,
+	"logistic":   Logistic,
+	"holt":       Holt,
+}
+
+// ModelNames names of the available models, sorted.
+func ModelNames() []string {
+	res := make([]string, 0, len(Models))
+	for name := range Models {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ols fits y = a + b*x by ordinary least squares.
+func ols(x []float64, y []float64) (a float64, b float64, sxx float64, meanX float64) {
+	n := float64(len(x))
+	meanY := 0.0
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+	sxy := 0.0
+	for i := range x {
+		sxx += (x[i] - meanX) * (x[i] - meanX)
+		sxy += (x[i] - meanX) * (y[i] - meanY)
+	}
+	b = sxy / sxx
+	return meanY - b*meanX, b, sxx, meanX
+}
+
+// cumulative values do not go down: clamp predictions to the last observed value.
+func clamp(predictions []Prediction, last float64) []Prediction {
+	for i := range predictions {
+		predictions[i].Value = math.Max(predictions[i].Value, last)
+		predictions[i].Lower = math.Max(predictions[i].Lower, last)
+		predictions[i].Upper = math.Max(predictions[i].Upper, predictions[i].Value)
+	}
+	return predictions
+}
+
+// LogLinear exponential growth: fits log(y) linearly over time.
+func LogLinear(y []float64, horizon int) ([]Prediction, error) {
+	x, logY := []float64{}, []float64{}
+	for i := range y {
+		if y[i] > 0 {
+			x = append(x, float64(i))
+			logY = append(logY, math.Log(y[i]))
+		}
+	}
+	if len(x) < 3 {
+		return nil, errors.Wrap(NotEnoughDataError, "log-linear model needs at least 3 positive values")
+	}
+	a, b, sxx, meanX := ols(x, logY)
+	sse := 0.0
+	for i := range x {
+		residual := logY[i] - (a + b*x[i])
+		sse += residual * residual
+	}
+	n := float64(len(x))
+	sigma := math.Sqrt(sse / (n - 2))
+
+	res := make([]Prediction, horizon)
+	for h := 1; h <= horizon; h++ {
+		x0 := float64(len(y) - 1 + h)
+		fit := a + b*x0
+		spread := z95 * sigma * math.Sqrt(1+1/n+(x0-meanX)*(x0-meanX)/sxx)
+		res[h-1] = Prediction{Value: math.Exp(fit), Lower: math.Exp(fit - spread), Upper: math.Exp(fit + spread)}
+	}
+	return clamp(res, y[len(y)-1]), nil
+}
+
+// Logistic fits y = K / (1 + exp(-r*(t - t0))). K is searched on a grid above the largest value,
+// r and t0 come from the linearized fit for each K.
+func Logistic(y []float64, horizon int) ([]Prediction, error) {
+	if len(y) < 5 || y[0] <= 0 || y[len(y)-1] <= y[0] {
+		return nil, errors.Wrap(NotEnoughDataError, "logistic model needs at least 5 positive, growing values")
+	}
+	max := y[len(y)-1]
+	for _, v := range y {
+		if v <= 0 {
+			return nil, errors.Wrap(NotEnoughDataError, "logistic model needs positive values")
+		}
+		max = math.Max(max, v)
+	}
+	x := make([]float64, len(y))
+	for i := range x {
+		x[i] = float64(i)
+	}
+	predict := func(k float64, a float64, b float64, t float64) float64 {
+		return k / (1 + math.Exp(a+b*t))
+	}
+
+	bestSSE := math.Inf(1)
+	var bestK, bestA, bestB float64
+	z := make([]float64, len(y))
+	for step := 0; step <= 200; step++ {
+		// K from 1.001x to 20x of the largest value, geometrically spaced
+		k := max * 1.001 * math.Pow(20/1.001, float64(step)/200)
+		for i := range y {
+			z[i] = math.Log(k/y[i] - 1)
+		}
+		a, b, _, _ := ols(x, z)
+		if b >= 0 {
+			continue
+		}
+		sse := 0.0
+		for i := range y {
+			residual := y[i] - predict(k, a, b, x[i])
+			sse += residual * residual
+		}
+		if sse < bestSSE {
+			bestSSE, bestK, bestA, bestB = sse, k, a, b
+		}
+	}
+	if math.IsInf(bestSSE, 1) {
+		return nil, errors.Wrap(NotEnoughDataError, "logistic model does not fit the series")
+	}
+	sigma := math.Sqrt(bestSSE / float64(len(y)-3))
+
+	res := make([]Prediction, horizon)
+	for h := 1; h <= horizon; h++ {
+		value := predict(bestK, bestA, bestB, float64(len(y)-1+h))
+		// residual based, widening with the horizon
+		spread := z95 * sigma * math.Sqrt(float64(h))
+		res[h-1] = Prediction{Value: value, Lower: value - spread, Upper: value + spread}
+	}
+	return clamp(res, y[len(y)-1]), nil
+}
+
+// holtSmoothing runs Holt's linear exponential smoothing, returns the final level, trend and one step ahead SSE.
+func holtSmoothing(y []float64, alpha float64, beta float64) (float64, float64, float64) {
+	level, trend := y[0], y[1]-y[0]
+	sse := 0.0
+	for i := 1; i < len(y); i++ {
+		residual := y[i] - (level + trend)
+		sse += residual * residual
+		prevLevel := level
+		level = alpha*y[i] + (1-alpha)*(level+trend)
+		trend = beta*(level-prevLevel) + (1-beta)*trend
+	}
+	return level, trend, sse
+}
+
+// Holt linear exponential smoothing, smoothing parameters picked by a grid search over one step ahead errors.
+func Holt(y []float64, horizon int) ([]Prediction, error) {
+	if len(y) < 4 {
+		return nil, errors.Wrap(NotEnoughDataError, "holt model needs at least 4 values")
+	}
+	bestSSE := math.Inf(1)
+	var bestAlpha, bestBeta, level, trend float64
+	for alpha := 0.05; alpha < 1; alpha += 0.05 {
+		for beta := 0.05; beta < 1; beta += 0.05 {
+			l, b, sse := holtSmoothing(y, alpha, beta)
+			if sse < bestSSE {
+				bestSSE, bestAlpha, bestBeta, level, trend = sse, alpha, beta, l, b
+			}
+		}
+	}
+	sigma2 := bestSSE / float64(len(y)-3)
+
+	res := make([]Prediction, horizon)
+	for h := 1; h <= horizon; h++ {
+		fh := float64(h)
+		value := level + fh*trend
+		// ETS(A,A,N) forecast variance, Hyndman & Athanasopoulos, Forecasting: Principles and Practice, table 8.8
+		variance := sigma2 * (1 + (fh-1)*(bestAlpha*bestAlpha+bestAlpha*bestBeta*fh+bestBeta*bestBeta*fh*(2*fh-1)/6))
+		spread := z95 * math.Sqrt(variance)
+		res[h-1] = Prediction{Value: value, Lower: value - spread, Upper: value + spread}
+	}
+	return clamp(res, y[len(y)-1]), nil
+}
+
+// Errors forecast accuracy over the replayed origins.
+type Errors struct {
+	Origins  int     `json:"origins"`
+	MAE      float64 `json:"mae"`
+	RMSE     float64 `json:"rmse"`
+	MAPE     float64 `json:"mape"`     // percent, actual zeros are skipped
+	Coverage float64 `json:"coverage"` // share of actual values within the prediction interval
+}
+
+// Backtest replays the series: fits the model on window values before each of the last origins days
+// and compares the following horizon predictions against what was actually reported.
+func Backtest(model Model, y []float64, window int, horizon int, origins int) (Errors, error) {
+	res := Errors{}
+	var absSum, sqSum, pctSum, covered float64
+	var n, pctN int
+	first := len(y) - horizon - origins + 1
+	if first < window {
+		first = window
+	}
+	for origin := first; origin+horizon <= len(y); origin++ {
+		predictions, err := model(y[origin-window:origin], horizon)
+		if errors.Is(err, NotEnoughDataError) {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Origins++
+		for h, p := range predictions {
+			actual := y[origin+h]
+			diff := p.Value - actual
+			absSum += math.Abs(diff)
+			sqSum += diff * diff
+			if actual > 0 {
+				pctSum += math.Abs(diff) / actual
+				pctN++
+			}
+			if actual >= p.Lower && actual <= p.Upper {
+				covered++
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return res, errors.Wrap(NotEnoughDataError, "series is too short to backtest")
+	}
+	res.MAE = absSum / float64(n)
+	res.RMSE = math.Sqrt(sqSum / float64(n))
+	if pctN > 0 {
+		res.MAPE = 100 * pctSum / float64(pctN)
+	}
+	res.Coverage = covered / float64(n)
+	return res, nil
+}
@@ -0,0 +1,79 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func series(n int, f func(t float64) float64) []float64 {
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = f(float64(i))
+	}
+	return res
+}
+
+func TestLogLinear(t *testing.T) {
+	y := series(21, func(t float64) float64 { return 100 * math.Exp(0.1*t) })
+	res, err := LogLinear(y, 14)
+	require.NoError(t, err)
+	require.Len(t, res, 14)
+	assert.InDelta(t, 100*math.Exp(0.1*21), res[0].Value, 1e-6)
+	assert.InDelta(t, 100*math.Exp(0.1*34), res[13].Value, 1e-4)
+	assert.InDelta(t, res[13].Value, res[13].Upper, 1e-4, "exact fit has no spread")
+
+	noisy := series(21, func(t float64) float64 { return 100 * math.Exp(0.1*t) * (1 + 0.05*math.Sin(t)) })
+	res, err = LogLinear(noisy, 14)
+	require.NoError(t, err)
+	assert.Less(t, res[0].Lower, res[0].Value)
+	assert.Greater(t, res[13].Upper-res[13].Lower, res[0].Upper-res[0].Lower, "interval widens with the horizon")
+
+	_, err = LogLinear([]float64{0, 0, 5}, 1)
+	assert.True(t, errors.Is(err, NotEnoughDataError))
+}
+
+func TestLogistic(t *testing.T) {
+	logistic := func(t float64) float64 { return 10000 / (1 + math.Exp(-0.3*(t-15))) }
+	res, err := Logistic(series(30, logistic), 14)
+	require.NoError(t, err)
+	assert.InDelta(t, logistic(30), res[0].Value, logistic(30)*0.02)
+	assert.InDelta(t, logistic(43), res[13].Value, logistic(43)*0.02)
+
+	_, err = Logistic([]float64{5, 5, 5, 5, 5}, 1)
+	assert.True(t, errors.Is(err, NotEnoughDataError))
+}
+
+func TestHolt(t *testing.T) {
+	res, err := Holt(series(21, func(t float64) float64 { return 100 + 10*t }), 7)
+	require.NoError(t, err)
+	assert.InDelta(t, 310, res[0].Value, 1e-6)
+	assert.InDelta(t, 370, res[6].Value, 1e-6)
+
+	// cumulative values do not go down
+	res, err = Holt([]float64{100, 90, 80, 70, 60}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, Prediction{Value: 60, Lower: 60, Upper: 60}, res[2])
+}
+
+func TestBacktest(t *testing.T) {
+	y := series(60, func(t float64) float64 { return 100 + 10*t })
+	res, err := Backtest(Holt, y, 21, 7, 30)
+	require.NoError(t, err)
+	assert.Equal(t, 30, res.Origins)
+	assert.InDelta(t, 0, res.MAE, 1e-6)
+	assert.InDelta(t, 0, res.MAPE, 1e-6)
+
+	exponential := series(60, func(t float64) float64 { return 100 * math.Exp(0.05*t) })
+	logLinear, err := Backtest(LogLinear, exponential, 21, 7, 30)
+	require.NoError(t, err)
+	holt, err := Backtest(Holt, exponential, 21, 7, 30)
+	require.NoError(t, err)
+	assert.Less(t, logLinear.RMSE, holt.RMSE)
+
+	_, err = Backtest(Holt, y[:10], 21, 7, 30)
+	assert.True(t, errors.Is(err, NotEnoughDataError))
+}
@@ -0,0 +1,261 @@
+package fsck
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+// Kind of a problem found in the DB.
+type Kind string
+
+const (
+	// DanglingIndex master collection bucket points to a bucket that does not exist.
+	DanglingIndex = Kind("dangling_index")
+	// OrphanBucket document bucket that is not listed in any master collection bucket.
+	OrphanBucket = Kind("orphan_bucket")
+	// UnparsablePayload stored payload does not pass documents.Parse.
+	UnparsablePayload = Kind("unparsable_payload")
+	// BadKey datapoint key is not a UTC RFC3339 timestamp.
+	BadKey = Kind("bad_key")
+)
+
+// Action taken to repair a problem.
+type Action string
+
+const (
+	// Removed the broken entry was deleted.
+	Removed = Action("removed")
+	// Rekeyed the datapoint was moved under the key derived from its timestamp.
+	Rekeyed = Action("rekeyed")
+	// Quarantined the entry was moved to documents.QuarantineBucket.
+	Quarantined = Action("quarantined")
+)
+
+var collections = []string{documents.CountryCollection, documents.StateCollection}
+
+// Problem single inconsistency found in the DB.
+type Problem struct {
+	Kind   Kind   `json:"kind"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key,omitempty"`
+	Detail string `json:"detail"`
+	Action Action `json:"action,omitempty"`
+}
+
+func (p Problem) String() string {
+	res := fmt.Sprintf("%s %s", p.Kind, p.Bucket)
+	if p.Key != "" {
+		res += "/" + p.Key
+	}
+	res += ": " + p.Detail
+	if p.Action != "" {
+		res += " (" + string(p.Action) + ")"
+	}
+	return res
+}
+
+// Report result of the DB check.
+type Report struct {
+	Buckets    int       `json:"buckets"`
+	Datapoints int       `json:"datapoints"`
+	Problems   []Problem `json:"problems"`
+}
+
+// Unrepaired returns the number of problems left as is.
+func (r Report) Unrepaired() int {
+	res := 0
+	for _, p := range r.Problems {
+		if p.Action == "" {
+			res++
+		}
+	}
+	return res
+}
+
+// Check walks the DB and reports dangling index entries, orphan buckets, unparsable payloads and bad keys.
+// When repair is set, dangling index entries are removed, datapoints with bad keys are re-keyed
+// and everything else is moved to documents.QuarantineBucket.
+func Check(db *bolt.DB, repair bool) (Report, error) {
+	report := Report{Problems: []Problem{}}
+	run := db.View
+	if repair {
+		run = db.Update
+	}
+	err := run(func(tx *bolt.Tx) error {
+		indexed, err := checkIndexes(tx, repair, &report)
+		if err != nil {
+			return err
+		}
+		documentBuckets := []string{}
+		err = tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if documents.IsDocumentBucket(string(name)) {
+				documentBuckets = append(documentBuckets, string(name))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "error listing buckets")
+		}
+		for _, name := range documentBuckets {
+			report.Buckets++
+			if !indexed[name] {
+				if err := orphan(tx, name, repair, &report); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := checkDatapoints(tx, name, repair, &report); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+// checkIndexes verifies master collection buckets, returns the set of indexed document buckets.
+func checkIndexes(tx *bolt.Tx, repair bool, report *Report) (map[string]bool, error) {
+	indexed := map[string]bool{}
+	for _, collection := range collections {
+		master := tx.Bucket([]byte(collection))
+		if master == nil {
+			continue
+		}
+		dangling := [][]byte{}
+		err := master.ForEach(func(k, v []byte) error {
+			if tx.Bucket(v) == nil {
+				dangling = append(dangling, clone(k))
+				return nil
+			}
+			indexed[string(v)] = true
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", collection)
+		}
+		for _, k := range dangling {
+			p := Problem{Kind: DanglingIndex, Bucket: collection, Key: string(k), Detail: "points to a missing bucket"}
+			if repair {
+				if err := master.Delete(k); err != nil {
+					return nil, errors.Wrapf(err, "error removing %s from %s", k, collection)
+				}
+				p.Action = Removed
+			}
+			report.Problems = append(report.Problems, p)
+		}
+	}
+	return indexed, nil
+}
+
+// orphan reports the bucket missing from master collections and quarantines it on repair.
+func orphan(tx *bolt.Tx, name string, repair bool, report *Report) error {
+	p := Problem{Kind: OrphanBucket, Bucket: name, Detail: "not listed in any collection"}
+	if repair {
+		bucket := tx.Bucket([]byte(name))
+		err := bucket.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+			return quarantine(tx, name, clone(k), clone(v))
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error quarantining %s", name)
+		}
+		if err := tx.DeleteBucket([]byte(name)); err != nil {
+			return errors.Wrapf(err, "error removing %s", name)
+		}
+		p.Action = Quarantined
+	}
+	report.Problems = append(report.Problems, p)
+	return nil
+}
+
+// checkDatapoints verifies keys and payloads of a single document bucket.
+func checkDatapoints(tx *bolt.Tx, name string, repair bool, report *Report) error {
+	bucket := tx.Bucket([]byte(name))
+	type fix struct {
+		key    []byte
+		value  []byte
+		newKey []byte
+	}
+	fixes := []fix{}
+	problems := []Problem{}
+
+	err := bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		report.Datapoints++
+		doc, parseErr := documents.Parse(v)
+		if parseErr != nil {
+			problems = append(problems, Problem{Kind: UnparsablePayload, Bucket: name, Key: string(k), Detail: parseErr.Error()})
+			fixes = append(fixes, fix{key: clone(k), value: clone(v)})
+			return nil
+		}
+		when, timeErr := time.Parse(time.RFC3339, string(k))
+		if timeErr == nil && when.UTC().Format(time.RFC3339) == string(k) {
+			return nil
+		}
+		expected := doc.GetWhen().UTC().Format(time.RFC3339)
+		problems = append(problems, Problem{Kind: BadKey, Bucket: name, Key: string(k), Detail: fmt.Sprintf("expected %s", expected)})
+		fixes = append(fixes, fix{key: clone(k), value: clone(v), newKey: []byte(expected)})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", name)
+	}
+	if !repair {
+		report.Problems = append(report.Problems, problems...)
+		return nil
+	}
+
+	for i, f := range fixes {
+		if f.newKey != nil && bucket.Get(f.newKey) == nil {
+			if err := bucket.Put(f.newKey, f.value); err != nil {
+				return errors.Wrapf(err, "error re-keying %s/%s", name, f.key)
+			}
+			problems[i].Action = Rekeyed
+		} else {
+			if err := quarantine(tx, name, f.key, f.value); err != nil {
+				return err
+			}
+			problems[i].Action = Quarantined
+		}
+		if err := bucket.Delete(f.key); err != nil {
+			return errors.Wrapf(err, "error removing %s/%s", name, f.key)
+		}
+	}
+	if len(fixes) > 0 {
+		// tells cached readers the series changed, see documents.PutDatapoint
+		if _, err := bucket.NextSequence(); err != nil {
+			return errors.Wrapf(err, "error bumping %s sequence", name)
+		}
+	}
+	report.Problems = append(report.Problems, problems...)
+	return nil
+}
+
+// clone copies bolt owned slices, those are not safe to use across writes.
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
+
+// quarantine stores the raw payload in documents.QuarantineBucket.
+func quarantine(tx *bolt.Tx, bucketName string, k []byte, v []byte) error {
+	top, err := tx.CreateBucketIfNotExists([]byte(documents.QuarantineBucket))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket", documents.QuarantineBucket)
+	}
+	nested, err := top.CreateBucketIfNotExists([]byte(bucketName))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket in %s", bucketName, documents.QuarantineBucket)
+	}
+	if err := nested.Put(k, v); err != nil {
+		return errors.Wrapf(err, "error quarantining %s/%s", bucketName, k)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package fsck
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	goodKey     = "2020-06-01T08:07:21Z"
+	goodPayload = `{"name":"Ukraine","when":"2020-06-01T08:07:21Z","total_cases":22409,"total_deaths":633,"total_tests":182986}`
+)
+
+func put(t *testing.T, db *bolt.DB, bucket string, k string, v string) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(k), []byte(v))
+	})
+	require.NoError(t, err)
+}
+
+func kinds(report Report) map[Kind]int {
+	res := map[Kind]int{}
+	for _, p := range report.Problems {
+		res[p.Kind]++
+	}
+	return res
+}
+
+func TestCheckAndRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsck")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	put(t, db, documents.CountryCollection, "ukraine", "ukraine")
+	put(t, db, documents.CountryCollection, "atlantis", "atlantis")
+	put(t, db, "ukraine", goodKey, goodPayload)
+	put(t, db, "ukraine", "2020-06-02T08:07:21Z", `{"name":"Ukraine"}`)
+	put(t, db, "ukraine", "2020-06-01 08:07:21", `{"name":"Ukraine","when":"2020-06-01T09:07:21Z","total_cases":22410}`)
+	put(t, db, "narnia", goodKey, goodPayload)
+
+	report, err := Check(db, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[Kind]int{DanglingIndex: 1, OrphanBucket: 1, UnparsablePayload: 1, BadKey: 1}, kinds(report))
+	assert.Equal(t, 4, report.Unrepaired())
+	assert.Equal(t, 2, report.Buckets)
+	assert.Equal(t, 3, report.Datapoints)
+
+	report, err = Check(db, true)
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(report.Problems))
+	assert.Equal(t, 0, report.Unrepaired())
+
+	report, err = Check(db, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		ukraine := tx.Bucket([]byte("ukraine"))
+		assert.NotNil(t, ukraine.Get([]byte(goodKey)))
+		assert.NotNil(t, ukraine.Get([]byte("2020-06-01T09:07:21Z")), "re-keyed")
+		assert.Nil(t, tx.Bucket([]byte("narnia")))
+		assert.Nil(t, tx.Bucket([]byte(documents.CountryCollection)).Get([]byte("atlantis")))
+
+		quarantine := tx.Bucket([]byte(documents.QuarantineBucket))
+		assert.NotNil(t, quarantine.Bucket([]byte("narnia")).Get([]byte(goodKey)))
+		assert.NotNil(t, quarantine.Bucket([]byte("ukraine")).Get([]byte("2020-06-02T08:07:21Z")))
+		return nil
+	})
+	require.NoError(t, err)
+}
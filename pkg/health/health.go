@@ -0,0 +1,67 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subsystems reported on /healthz and /readyz.
+const (
+	Countries = "countries_scraper"
+	States    = "states_scraper"
+	Backup    = "s3_backup"
+	Snapshots = "snapshots"
+)
+
+// State last known outcome of a subsystem.
+type State struct {
+	LastSuccess time.Time
+	LastError   string
+	LastErrorAt time.Time
+}
+
+// Tracker remembers the last outcome per subsystem.
+type Tracker struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{states: map[string]State{}}
+}
+
+// Record stores the outcome of a subsystem run: success when err is nil.
+func (t *Tracker) Record(subsystem string, at time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.states[subsystem]
+	if err != nil {
+		s.LastError = err.Error()
+		s.LastErrorAt = at
+	} else {
+		s.LastSuccess = at
+	}
+	t.states[subsystem] = s
+}
+
+// Get returns the state of a subsystem, false if nothing was recorded yet.
+func (t *Tracker) Get(subsystem string) (State, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.states[subsystem]
+	return s, ok
+}
+
+// Subsystems names of all subsystems recorded so far, sorted.
+func (t *Tracker) Subsystems() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make([]string, 0, len(t.states))
+	for k := range t.states {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
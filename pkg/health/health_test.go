@@ -0,0 +1,26 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	_, ok := tracker.Get(Countries)
+	assert.False(t, ok)
+
+	t1 := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	tracker.Record(Countries, t1, nil)
+	tracker.Record(Countries, t2, errors.New("boom"))
+	tracker.Record(Backup, t1, nil)
+
+	s, ok := tracker.Get(Countries)
+	assert.True(t, ok)
+	assert.Equal(t, State{LastSuccess: t1, LastError: "boom", LastErrorAt: t2}, s)
+	assert.Equal(t, []string{Countries, Backup}, tracker.Subsystems())
+}
@@ -2,8 +2,11 @@ package httpclient
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-pkgz/repeater"
@@ -17,9 +20,31 @@ const (
 	tlsHandshakeTimeout = 5 * time.Second
 	repeaterFactor      = 2
 	repeatTimes         = 10
+	maxErrorBody        = 4096
 )
 
-var client *http.Client
+// StatusError response with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+	Body       string // beginning of the response body
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// finalClientError client errors other than timeouts and rate limits, another try gets the same answer.
+func finalClientError(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 && statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+}
+
+var (
+	client       *http.Client
+	uploadClient *http.Client
+)
 
 func init() {
 	var httpTransport *http.Transport
@@ -43,6 +68,9 @@ func init() {
 		Timeout:   httpTimeout,
 		Transport: httpTransport,
 	}
+	uploadClient = &http.Client{
+		Transport: httpTransport,
+	}
 }
 
 // HTTPClient common interface for HTTP clients.
@@ -50,6 +78,17 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// Default returns HTTP client with sane defaults, that makes a single attempt per call.
+func Default() HTTPClient {
+	return client
+}
+
+// Uploads returns HTTP client for large request bodies: no total timeout and no retries.
+// Bound the call with a context deadline instead.
+func Uploads() HTTPClient {
+	return uploadClient
+}
+
 // Retryable returns HTTP client with sane defaults, that can retry HTTP calls.
 // Use `MakeRetryable` if you want to use your own HTTP Client.
 func Retryable() HTTPClient {
@@ -61,20 +100,47 @@ func MakeRetryable(c HTTPClient) HTTPClient {
 	return &retryableClient{Client: c}
 }
 
+// RetryableAPI is Retryable that gives up on client errors other than 408 and 429 right away.
+// Meant for our own API, where e.g. 404 or 400 are final answers rather than hiccups of a scraped site.
+func RetryableAPI() HTTPClient {
+	return &retryableClient{Client: client, final: finalClientError}
+}
+
 type retryableClient struct {
 	Client HTTPClient
+	final  func(statusCode int) bool // responses not worth another try, nil retries all of them
 }
 
-// Do makes retryable HTTP requests with predefined timeouts
+// errPermanent stops the repeater, the actual error is kept aside.
+var errPermanent = errors.New("permanent HTTP error")
+
+// Do makes retryable HTTP requests with predefined timeouts. Non-2xx responses are returned as *StatusError.
 func (r *retryableClient) Do(req *http.Request) (res *http.Response, err error) {
+	attempt := 0
+	var permanent error
 	f := func() error {
-		resp, ferr := client.Do(req)
+		if attempt > 0 && req.GetBody != nil {
+			// the previous attempt consumed the body
+			body, berr := req.GetBody()
+			if berr != nil {
+				return errors.Wrap(berr, "Error rewinding request body")
+			}
+			req.Body = body
+		}
+		attempt++
+		resp, ferr := r.Client.Do(req)
 		if ferr != nil {
 			return errors.Wrap(ferr, "Error making HTTP request")
 		}
 		if resp.StatusCode < 200 || resp.StatusCode > 299 {
 			defer resp.Body.Close()
-			return errors.New(fmt.Sprintf("HTTP %d", resp.StatusCode))
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+			statusErr := &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+			if r.final != nil && r.final(resp.StatusCode) {
+				permanent = statusErr
+				return errPermanent
+			}
+			return statusErr
 		}
 		res = resp
 		return nil
@@ -85,7 +151,10 @@ func (r *retryableClient) Do(req *http.Request) (res *http.Response, err error)
 		Factor:  repeaterFactor,
 		Jitter:  true,
 	})
-	if err := rp.Do(req.Context(), f); err != nil {
+	if err := rp.Do(req.Context(), f, errPermanent); err != nil {
+		if permanent != nil {
+			return nil, permanent
+		}
 		return nil, errors.Wrap(err, "repeater tried hard, but no luck")
 	}
 
@@ -0,0 +1,50 @@
+package httpclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryable(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/missing":
+			http.Error(w, "not here", http.StatusNotFound)
+		case n == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write(body)
+		}
+	}))
+	defer srv.Close()
+	c := &retryableClient{Client: srv.Client(), final: finalClientError}
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/echo", strings.NewReader("payload"))
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "payload", string(body), "body is rewound on retries")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	req, err = http.NewRequest(http.MethodGet, srv.URL+"/missing", nil)
+	require.NoError(t, err)
+	_, err = c.Do(req)
+	statusErr := &StatusError{}
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, "not here", statusErr.Body)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "client errors are not retried")
+}
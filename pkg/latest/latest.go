@@ -0,0 +1,137 @@
+package latest
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+var collections = []string{documents.CountryCollection, documents.StateCollection}
+
+// Entry the newest datapoint of a single entity.
+type Entry struct {
+	Key string `json:"key"`
+	documents.DataEntry
+}
+
+// Cache keeps the newest datapoint per entity of each collection in memory.
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]map[string]Entry // collection -> bucket key -> entry
+}
+
+// New creates an empty Cache.
+func New() *Cache {
+	c := &Cache{entries: map[string]map[string]Entry{}}
+	for _, collection := range collections {
+		c.entries[collection] = map[string]Entry{}
+	}
+	return c
+}
+
+// readLast reads the newest datapoint stored in the bucket.
+func readLast(tx *bolt.Tx, bucketKey string) (Entry, bool, error) {
+	doc, ok, err := documents.ReadLast(tx, bucketKey)
+	return Entry{Key: bucketKey, DataEntry: doc}, ok, err
+}
+
+// Load rebuilds the cache from the DB.
+func (c *Cache) Load(db *bolt.DB) error {
+	entries := map[string]map[string]Entry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, collection := range collections {
+			entries[collection] = map[string]Entry{}
+			masterCollectionBucket := tx.Bucket([]byte(collection))
+			if masterCollectionBucket == nil {
+				continue
+			}
+			err := masterCollectionBucket.ForEach(func(k, v []byte) error {
+				entry, ok, err := readLast(tx, string(v))
+				if ok {
+					entries[collection][entry.Key] = entry
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error loading latest values")
+	}
+	c.mu.Lock()
+	c.entries = entries
+	c.mu.Unlock()
+	return nil
+}
+
+// Refresh re-reads the newest datapoints of the given documents' series, call it after saving them.
+// Reading back from the DB keeps the cache right about aliases, rejected and out of order datapoints.
+func (c *Cache) Refresh(db *bolt.DB, docs []documents.CollectionEntry) error {
+	updates := map[string][]Entry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		seen := map[string]bool{}
+		for _, doc := range docs {
+			bucketKey := documents.ResolveAlias(tx, documents.Key(doc.GetName()))
+			if bucketKey == "" || seen[bucketKey] {
+				continue
+			}
+			seen[bucketKey] = true
+			entry, ok, err := readLast(tx, bucketKey)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			for _, collection := range collections {
+				if master := tx.Bucket([]byte(collection)); master != nil && master.Get([]byte(bucketKey)) != nil {
+					updates[collection] = append(updates[collection], entry)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error refreshing latest values")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for collection, entries := range updates {
+		for _, entry := range entries {
+			c.entries[collection][entry.Key] = entry
+		}
+	}
+	return nil
+}
+
+// Get returns the newest datapoint per entity of the collection, most cases first.
+func (c *Cache) Get(collection string) []Entry {
+	c.mu.RLock()
+	res := make([]Entry, 0, len(c.entries[collection]))
+	for _, entry := range c.entries[collection] {
+		res = append(res, entry)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Cases != res[j].Cases {
+			return res[i].Cases > res[j].Cases
+		}
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+// Lookup returns the newest datapoint of a single entity.
+func (c *Cache) Lookup(collection string, bucketKey string) (Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[collection][bucketKey]
+	return entry, ok
+}
@@ -0,0 +1,58 @@
+package latest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entry(name string, day int, cases uint64) documents.DataEntry {
+	return documents.DataEntry{Name: name, When: time.Date(2020, 6, day, 0, 0, 0, 0, time.UTC), Cases: cases}
+}
+
+func TestLoadAndRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "latest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, []documents.CollectionEntry{entry("USA", 1, 10), entry("USA", 2, 20), entry("S. Korea", 1, 5)}, nil))
+	require.NoError(t, documents.BulkSave(db, documents.StateCollection, []documents.CollectionEntry{entry("California", 1, 7)}, nil))
+
+	cache := New()
+	require.NoError(t, cache.Load(db))
+	countries := cache.Get(documents.CountryCollection)
+	require.Len(t, countries, 2)
+	assert.Equal(t, "usa", countries[0].Key)
+	assert.Equal(t, uint64(20), countries[0].Cases)
+	assert.Len(t, cache.Get(documents.StateCollection), 1)
+
+	_, err = documents.Rename(db, documents.CountryCollection, "S. Korea", "South Korea")
+	require.NoError(t, err)
+	require.NoError(t, cache.Load(db))
+
+	// out of order datapoint does not replace the newest one
+	docs := []documents.CollectionEntry{entry("S. Korea", 3, 50), entry("USA", 0, 1), entry("California", 2, 8)}
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs[:2], nil))
+	require.NoError(t, documents.BulkSave(db, documents.StateCollection, docs[2:], nil))
+	require.NoError(t, cache.Refresh(db, docs))
+
+	korea, ok := cache.Lookup(documents.CountryCollection, "south_korea")
+	require.True(t, ok)
+	assert.Equal(t, uint64(50), korea.Cases)
+	usa, _ := cache.Lookup(documents.CountryCollection, "usa")
+	assert.Equal(t, uint64(20), usa.Cases)
+	california, _ := cache.Lookup(documents.StateCollection, "california")
+	assert.Equal(t, uint64(8), california.Cases)
+	_, ok = cache.Lookup(documents.CountryCollection, "california")
+	assert.False(t, ok)
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Config SMTP server settings.
+type Config struct {
+	Addr     string // host:port
+	From     string
+	Username string // optional, PLAIN auth is used when set
+	Password string
+}
+
+// FromConfig reads COVIDDY_SMTP_* settings.
+func FromConfig(cfg config.Config) Config {
+	return Config{Addr: cfg.SMTPAddr, From: cfg.SMTPFrom, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+}
+
+// Message email with a plain text and an optional HTML body.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+func writePart(w *multipart.Writer, contentType string, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// Bytes encodes the message, multipart/alternative when there is an HTML body.
+func (m Message) Bytes(from string, date time.Time) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		fmt.Fprintf(buf, "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(buf)
+		if _, err := qp.Write([]byte(m.Text)); err != nil {
+			return nil, errors.Wrap(err, "error encoding email body")
+		}
+		if err := qp.Close(); err != nil {
+			return nil, errors.Wrap(err, "error encoding email body")
+		}
+		return buf.Bytes(), nil
+	}
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	if err := writePart(w, "text/plain", m.Text); err != nil {
+		return nil, errors.Wrap(err, "error encoding email text")
+	}
+	if err := writePart(w, "text/html", m.HTML); err != nil {
+		return nil, errors.Wrap(err, "error encoding email HTML")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "error encoding email")
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// Send delivers the message through the SMTP server.
+func Send(cfg Config, m Message) error {
+	if cfg.Addr == "" || cfg.From == "" {
+		return errors.New("SMTP address and sender are required to send emails")
+	}
+	if len(m.To) == 0 {
+		return errors.New("no email recipients")
+	}
+	payload, err := m.Bytes(cfg.From, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return errors.Wrapf(err, "invalid SMTP address %s", cfg.Addr)
+		}
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	if err := smtp.SendMail(cfg.Addr, auth, cfg.From, m.To, payload); err != nil {
+		return errors.Wrapf(err, "error sending %q", m.Subject)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBytes(t *testing.T) {
+	m := Message{To: []string{"a@example.com", "b@example.com"}, Subject: "Über alerts", Text: "plain", HTML: "<p>html</p>"}
+	payload, err := m.Bytes("coviddy@example.com", time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(payload))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Über alerts", subject)
+	assert.Equal(t, "a@example.com, b@example.com", msg.Header.Get("To"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for _, expected := range []string{"plain", "<p>html</p>"} {
+		part, err := r.NextPart()
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(body))
+	}
+
+	assert.Error(t, Send(Config{}, m))
+}
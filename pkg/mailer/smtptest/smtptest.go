@@ -0,0 +1,134 @@
+package smtptest
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Message email received by the server.
+type Message struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// Server local SMTP stand-in for tests, it accepts any mail and keeps it in memory.
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts a server on a random local port.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting SMTP stand-in")
+	}
+	s := &Server{listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Messages received so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+// handle speaks just enough SMTP for net/smtp: no TLS, any AUTH PLAIN credentials are accepted.
+func (s *Server) handle(c *textproto.Conn) {
+	if err := c.PrintfLine("220 localhost SMTP stand-in"); err != nil {
+		return
+	}
+	m := Message{}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(line[len(verb):])
+		switch verb {
+		case "EHLO":
+			err = c.PrintfLine("250-localhost\r\n250-8BITMIME\r\n250 AUTH PLAIN")
+		case "HELO":
+			err = c.PrintfLine("250 localhost")
+		case "AUTH":
+			err = c.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			m = Message{From: address(arg)}
+			err = c.PrintfLine("250 OK")
+		case "RCPT":
+			m.To = append(m.To, address(arg))
+			err = c.PrintfLine("250 OK")
+		case "DATA":
+			if err = c.PrintfLine("354 End data with <CR><LF>.<CR><LF>"); err != nil {
+				return
+			}
+			if m.Data, err = c.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, m)
+			s.mu.Unlock()
+			err = c.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			err = c.PrintfLine("250 OK")
+		case "QUIT":
+			_ = c.PrintfLine("221 Bye")
+			return
+		default:
+			err = c.PrintfLine("502 Command not implemented")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// address strips "FROM:<...>" and "TO:<...>" down to the address.
+func address(arg string) string {
+	if i := strings.Index(arg, ":"); i >= 0 {
+		arg = arg[i+1:]
+	}
+	if i := strings.Index(arg, " "); i >= 0 {
+		arg = arg[:i]
+	}
+	return strings.Trim(arg, "<>")
+}
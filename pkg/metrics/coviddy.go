@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+)
+
+// Default registry served on /metrics.
+var Default = &Registry{}
+
+// DefaultBuckets latency buckets, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Scraper results.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+var (
+	// ScrapeDuration time it took to scrape and store a collection.
+	ScrapeDuration = NewHistogram("coviddy_scrape_duration_seconds", "Time it took to scrape and store a collection.", []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120}, "scraper")
+	// Scrapes scrape attempts by result.
+	Scrapes = NewCounter("coviddy_scrapes_total", "Scrape attempts by result.", "scraper", "result")
+	// LastSuccessfulScrape unix time of the last successful scrape.
+	LastSuccessfulScrape = NewGauge("coviddy_last_successful_scrape_timestamp_seconds", "Unix time of the last successful scrape.", "scraper")
+	// BackupUploadErrors failed S3 uploads.
+	BackupUploadErrors = NewCounter("coviddy_backup_upload_errors_total", "Failed S3 uploads of single datapoints.")
+	// HTTPRequests HTTP requests by route, method and status code.
+	HTTPRequests = NewCounter("coviddy_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "code")
+	// HTTPDuration HTTP request latency by route.
+	HTTPDuration = NewHistogram("coviddy_http_request_duration_seconds", "HTTP request latency by route.", DefaultBuckets, "route", "method")
+	// RateLimited requests rejected by rate limits, by route group and kind of client: token, user or anonymous.
+	RateLimited = NewCounter("coviddy_rate_limited_requests_total", "Requests rejected by rate limits by route group and kind of client.", "group", "client")
+)
+
+func init() {
+	Default.Register(ScrapeDuration, Scrapes, LastSuccessfulScrape, BackupUploadErrors, HTTPRequests, HTTPDuration, RateLimited)
+}
+
+// GaugeFunc gauge read at collection time.
+func GaugeFunc(name string, help string, value func() float64) Collector {
+	return CollectorFunc(func(w *Writer) {
+		w.Header(name, "gauge", help)
+		w.Sample(name, value())
+	})
+}
+
+// DBStats bolt statistics.
+func DBStats(db *bolt.DB) Collector {
+	return CollectorFunc(func(w *Writer) {
+		stats := db.Stats()
+		for _, m := range []struct {
+			name, typ, help string
+			value           float64
+		}{
+			{"coviddy_bolt_tx_total", "counter", "Read transactions started.", float64(stats.TxN)},
+			{"coviddy_bolt_open_tx", "gauge", "Currently open read transactions.", float64(stats.OpenTxN)},
+			{"coviddy_bolt_free_pages", "gauge", "Free pages on the freelist.", float64(stats.FreePageN)},
+			{"coviddy_bolt_pending_pages", "gauge", "Pending pages on the freelist.", float64(stats.PendingPageN)},
+			{"coviddy_bolt_free_alloc_bytes", "gauge", "Bytes allocated in free pages.", float64(stats.FreeAlloc)},
+			{"coviddy_bolt_freelist_inuse_bytes", "gauge", "Bytes used by the freelist.", float64(stats.FreelistInuse)},
+			{"coviddy_bolt_page_alloc_bytes_total", "counter", "Bytes allocated for pages.", float64(stats.TxStats.PageAlloc)},
+			{"coviddy_bolt_cursors_total", "counter", "Cursors created.", float64(stats.TxStats.CursorCount)},
+			{"coviddy_bolt_writes_total", "counter", "Page writes.", float64(stats.TxStats.Write)},
+			{"coviddy_bolt_write_seconds_total", "counter", "Time spent writing to disk.", stats.TxStats.WriteTime.Seconds()},
+		} {
+			w.Header(m.name, m.typ, m.help)
+			w.Sample(m.name, m.value)
+		}
+	})
+}
+
+// LatestValues newest cases and deaths per entity, the cardinality is a few hundred series.
+func LatestValues(cache *latest.Cache, collections ...string) Collector {
+	return CollectorFunc(func(w *Writer) {
+		for _, m := range []struct {
+			name, help string
+			value      func(e latest.Entry) uint64
+		}{
+			{"coviddy_latest_cases", "Newest total cases.", func(e latest.Entry) uint64 { return e.Cases }},
+			{"coviddy_latest_deaths", "Newest total deaths.", func(e latest.Entry) uint64 { return e.Deaths }},
+		} {
+			w.Header(m.name, "gauge", m.help)
+			for _, collection := range collections {
+				for _, e := range cache.Get(collection) {
+					w.Sample(m.name, float64(m.value(e)), "collection", strings.ToLower(collection), "code", e.Key)
+				}
+			}
+		}
+	})
+}
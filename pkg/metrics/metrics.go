@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector writes its samples in the Prometheus text exposition format.
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// CollectorFunc turns a function into a Collector, handy for values read at scrape time.
+type CollectorFunc func(w *Writer)
+
+// Collect calls f(w).
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+// Writer writes metric families in the Prometheus text exposition format.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// Header writes HELP and TYPE lines of the metric family.
+func (w *Writer) Header(name string, typ string, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help), name, typ)
+}
+
+// Sample writes a single sample, labels are name, value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// vec values of a metric family by label values.
+type vec struct {
+	name       string
+	help       string
+	labelNames []string
+	mu         sync.Mutex
+	keys       map[string][]string // joined label values -> label values
+}
+
+const labelSeparator = "\xff"
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("%s: expected %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+	k := strings.Join(labelValues, labelSeparator)
+	if _, ok := v.keys[k]; !ok {
+		v.keys[k] = append([]string{}, labelValues...)
+	}
+	return k
+}
+
+// sortedKeys for stable output.
+func (v *vec) sortedKeys() []string {
+	res := make([]string, 0, len(v.keys))
+	for k := range v.keys {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (v *vec) labels(k string, extra ...string) []string {
+	res := []string{}
+	for i, value := range v.keys[k] {
+		res = append(res, v.labelNames[i], value)
+	}
+	return append(res, extra...)
+}
+
+// Counter monotonically increasing value.
+type Counter struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounter creates a counter with the given label names.
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{vec: vec{name: name, help: help, labelNames: labelNames, keys: map[string][]string{}}, values: map[string]float64{}}
+}
+
+// Add increases the counter of the given label values.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(labelValues)] += delta
+}
+
+// Inc increases the counter of the given label values by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Collect implements Collector.
+func (c *Counter) Collect(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header(c.name, "counter", c.help)
+	for _, k := range c.sortedKeys() {
+		w.Sample(c.name, c.values[k], c.labels(k)...)
+	}
+}
+
+// Gauge value that goes up and down.
+type Gauge struct {
+	vec
+	values map[string]float64
+}
+
+// NewGauge creates a gauge with the given label names.
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{vec: vec{name: name, help: help, labelNames: labelNames, keys: map[string][]string{}}, values: map[string]float64{}}
+}
+
+// Set sets the gauge of the given label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[g.key(labelValues)] = value
+}
+
+// Value returns the gauge of the given label values, false if it was never set.
+func (g *Gauge) Value(labelValues ...string) (float64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.values[strings.Join(labelValues, labelSeparator)]
+	return v, ok
+}
+
+// Collect implements Collector.
+func (g *Gauge) Collect(w *Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w.Header(g.name, "gauge", g.help)
+	for _, k := range g.sortedKeys() {
+		w.Sample(g.name, g.values[k], g.labels(k)...)
+	}
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	vec
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+// NewHistogram creates a histogram with the given upper bucket bounds (sorted) and label names.
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{vec: vec{name: name, help: help, labelNames: labelNames, keys: map[string][]string{}}, buckets: buckets, values: map[string]*histogramValue{}}
+}
+
+// Observe records a single observation for the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := h.key(labelValues)
+	v, ok := h.values[k]
+	if !ok {
+		v = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = v
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		v.counts[i]++
+	}
+	v.sum += value
+	v.count++
+}
+
+// Collect implements Collector.
+func (h *Histogram) Collect(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Header(h.name, "histogram", h.help)
+	for _, k := range h.sortedKeys() {
+		v := h.values[k]
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += v.counts[i]
+			w.Sample(h.name+"_bucket", float64(cumulative), h.labels(k, "le", formatValue(bound))...)
+		}
+		w.Sample(h.name+"_bucket", float64(v.count), h.labels(k, "le", "+Inf")...)
+		w.Sample(h.name+"_sum", v.sum, h.labels(k)...)
+		w.Sample(h.name+"_count", float64(v.count), h.labels(k)...)
+	}
+}
+
+// Registry collectors exposed together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// Register adds collectors to the registry.
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Write writes all registered metrics.
+func (r *Registry) Write(out io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	w := &Writer{w: out}
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+	return w.err
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	counter := NewCounter("test_total", "Test counter.", "result")
+	counter.Inc("success")
+	counter.Add(2, "fail\"ure")
+	gauge := NewGauge("test_gauge", "Test gauge.")
+	gauge.Set(1.5)
+	histogram := NewHistogram("test_seconds", "Test histogram.", []float64{1, 5}, "route")
+	histogram.Observe(0.5, "/a")
+	histogram.Observe(3, "/a")
+	histogram.Observe(10, "/a")
+
+	r := &Registry{}
+	r.Register(counter, gauge, histogram)
+	out := &bytes.Buffer{}
+	require.NoError(t, r.Write(out))
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{result="fail\"ure"} 2
+test_total{result="success"} 1
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 1.5
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/a",le="1"} 1
+test_seconds_bucket{route="/a",le="5"} 2
+test_seconds_bucket{route="/a",le="+Inf"} 3
+test_seconds_sum{route="/a"} 13.5
+test_seconds_count{route="/a"} 3
+`, out.String())
+
+	v, ok := gauge.Value()
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, v)
+	_, ok = NewGauge("unset", "Unset.", "scraper").Value("countries")
+	assert.False(t, ok)
+}
@@ -0,0 +1,270 @@
+package quality
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+var collections = []string{documents.CountryCollection, documents.StateCollection}
+
+// Thresholds tell when something is worth reporting.
+type Thresholds struct {
+	Stale       time.Duration // no datapoints for longer than this
+	Gap         time.Duration // holes between datapoints longer than this
+	Flat        time.Duration // values unchanged for longer than this, while other entities changed
+	ScrapeSlack time.Duration // datapoints this close to the newest one belong to the latest scrape
+	MaxGaps     int           // largest gaps listed per entity
+}
+
+// MarshalJSON prints durations human readable.
+func (t Thresholds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"stale":        t.Stale.String(),
+		"gap":          t.Gap.String(),
+		"flat":         t.Flat.String(),
+		"scrape_slack": t.ScrapeSlack.String(),
+		"max_gaps":     t.MaxGaps,
+	})
+}
+
+// ThresholdsFromConfig reads COVIDDY_QUALITY_* settings.
+func ThresholdsFromConfig(cfg config.Config) Thresholds {
+	return Thresholds{
+		Stale:       cfg.QualityStaleAfter,
+		Gap:         cfg.QualityGap,
+		Flat:        cfg.QualityFlatFor,
+		ScrapeSlack: cfg.QualityScrapeSlack,
+		MaxGaps:     cfg.QualityMaxGaps,
+	}
+}
+
+// Period time span with its length.
+type Period struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Duration string    `json:"duration"`
+}
+
+func newPeriod(from time.Time, to time.Time) Period {
+	return Period{From: from, To: to, Duration: to.Sub(from).String()}
+}
+
+// Decrease cumulative value going down between two datapoints.
+type Decrease struct {
+	When   time.Time `json:"when"`
+	Metric string    `json:"metric"`
+	From   uint64    `json:"from"`
+	To     uint64    `json:"to"`
+}
+
+// Entity data quality of a single country or state.
+type Entity struct {
+	Collection  string     `json:"collection"`
+	Code        string     `json:"code"`
+	Name        string     `json:"name"`
+	LastUpdated time.Time  `json:"last_updated"`
+	Stale       bool       `json:"stale"`
+	Disappeared bool       `json:"disappeared"` // missing from the latest scrape
+	Gaps        []Period   `json:"gaps"`
+	Flat        []Period   `json:"flat"`
+	Decreases   []Decrease `json:"decreases"`
+}
+
+// Issues number of problems found.
+func (e Entity) Issues() int {
+	res := len(e.Gaps) + len(e.Flat) + len(e.Decreases)
+	if e.Stale {
+		res++
+	}
+	if e.Disappeared {
+		res++
+	}
+	return res
+}
+
+// String one line summary.
+func (e Entity) String() string {
+	problems := []string{}
+	if e.Stale {
+		problems = append(problems, "stale")
+	}
+	if e.Disappeared {
+		problems = append(problems, "disappeared")
+	}
+	if len(e.Gaps) > 0 {
+		problems = append(problems, fmt.Sprintf("%d gaps (largest %s)", len(e.Gaps), e.Gaps[0].Duration))
+	}
+	if len(e.Flat) > 0 {
+		problems = append(problems, fmt.Sprintf("%d flat periods", len(e.Flat)))
+	}
+	if len(e.Decreases) > 0 {
+		problems = append(problems, fmt.Sprintf("%d decreases", len(e.Decreases)))
+	}
+	if len(problems) == 0 {
+		problems = append(problems, "ok")
+	}
+	return fmt.Sprintf("%s/%s last updated %s: %s", strings.ToLower(e.Collection), e.Code, e.LastUpdated.Format(time.RFC3339), strings.Join(problems, ", "))
+}
+
+// Report data quality of all entities, the ones with most issues first.
+type Report struct {
+	From         time.Time            `json:"from"`
+	To           time.Time            `json:"to"`
+	Thresholds   Thresholds           `json:"thresholds"`
+	LatestScrape map[string]time.Time `json:"latest_scrape"` // per collection
+	Entities     []Entity             `json:"entities"`
+}
+
+type series struct {
+	key  string
+	docs []documents.DataEntry
+}
+
+func sameValues(a documents.DataEntry, b documents.DataEntry) bool {
+	return a.Cases == b.Cases && a.Deaths == b.Deaths && a.Tests == b.Tests
+}
+
+// changes times at which any of the series reported new values, sorted.
+func changes(all []series) []time.Time {
+	res := []time.Time{}
+	for _, s := range all {
+		for i := 1; i < len(s.docs); i++ {
+			if !sameValues(s.docs[i-1], s.docs[i]) {
+				res = append(res, s.docs[i].GetWhen())
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Before(res[j])
+	})
+	return res
+}
+
+// changedWithin tells whether any change happened strictly between from and to.
+func changedWithin(changes []time.Time, from time.Time, to time.Time) bool {
+	i := sort.Search(len(changes), func(i int) bool {
+		return changes[i].After(from)
+	})
+	return i < len(changes) && changes[i].Before(to)
+}
+
+func gaps(docs []documents.DataEntry, t Thresholds) []Period {
+	res := []Period{}
+	for i := 1; i < len(docs); i++ {
+		if docs[i].GetWhen().Sub(docs[i-1].GetWhen()) > t.Gap {
+			res = append(res, newPeriod(docs[i-1].GetWhen(), docs[i].GetWhen()))
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].To.Sub(res[i].From) > res[j].To.Sub(res[j].From)
+	})
+	if t.MaxGaps > 0 && len(res) > t.MaxGaps {
+		res = res[:t.MaxGaps]
+	}
+	return res
+}
+
+// flat periods of unchanged values longer than the threshold, while the rest of the collection kept changing.
+func flat(docs []documents.DataEntry, collectionChanges []time.Time, t Thresholds) []Period {
+	res := []Period{}
+	start := 0
+	for i := 1; i <= len(docs); i++ {
+		if i < len(docs) && sameValues(docs[start], docs[i]) {
+			continue
+		}
+		from, to := docs[start].GetWhen(), docs[i-1].GetWhen()
+		if to.Sub(from) > t.Flat && changedWithin(collectionChanges, from, to) {
+			res = append(res, newPeriod(from, to))
+		}
+		start = i
+	}
+	return res
+}
+
+func decreases(docs []documents.DataEntry) []Decrease {
+	res := []Decrease{}
+	for i := 1; i < len(docs); i++ {
+		prev, cur := docs[i-1], docs[i]
+		for _, m := range []struct {
+			name     string
+			from, to uint64
+		}{{"cases", prev.Cases, cur.Cases}, {"deaths", prev.Deaths, cur.Deaths}, {"tests", prev.Tests, cur.Tests}} {
+			if m.to < m.from {
+				res = append(res, Decrease{When: cur.GetWhen(), Metric: m.name, From: m.from, To: m.to})
+			}
+		}
+	}
+	return res
+}
+
+// Check looks for gaps, stale, flat and decreasing series among datapoints stored between from and to.
+func Check(db *bolt.DB, from time.Time, to time.Time, t Thresholds) (Report, error) {
+	res := Report{From: from, To: to, Thresholds: t, LatestScrape: map[string]time.Time{}, Entities: []Entity{}}
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, collection := range collections {
+			all := []series{}
+			for _, k := range documents.ListKeys(tx, collection) {
+				docs, err := documents.ReadSeries(tx, k, from, to)
+				if errors.Is(err, documents.BucketNotFoundError) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				all = append(all, series{key: k, docs: docs})
+			}
+
+			latestScrape := time.Time{}
+			for _, s := range all {
+				if len(s.docs) > 0 && s.docs[len(s.docs)-1].GetWhen().After(latestScrape) {
+					latestScrape = s.docs[len(s.docs)-1].GetWhen()
+				}
+			}
+			res.LatestScrape[collection] = latestScrape
+			collectionChanges := changes(all)
+
+			for _, s := range all {
+				entity := Entity{Collection: collection, Code: s.key, Gaps: []Period{}, Flat: []Period{}, Decreases: []Decrease{}}
+				if len(s.docs) == 0 {
+					// nothing within the range at all
+					entity.Stale = true
+					entity.Disappeared = !latestScrape.IsZero()
+					res.Entities = append(res.Entities, entity)
+					continue
+				}
+				last := s.docs[len(s.docs)-1]
+				entity.Name = last.Name
+				entity.LastUpdated = last.GetWhen()
+				entity.Stale = to.Sub(entity.LastUpdated) > t.Stale
+				entity.Disappeared = latestScrape.Sub(entity.LastUpdated) > t.ScrapeSlack
+				entity.Gaps = gaps(s.docs, t)
+				entity.Flat = flat(s.docs, collectionChanges, t)
+				entity.Decreases = decreases(s.docs)
+				res.Entities = append(res.Entities, entity)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return res, errors.Wrap(err, "error checking data quality")
+	}
+	sort.SliceStable(res.Entities, func(i, j int) bool {
+		a, b := res.Entities[i], res.Entities[j]
+		if a.Issues() != b.Issues() {
+			return a.Issues() > b.Issues()
+		}
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Code < b.Code
+	})
+	return res, nil
+}
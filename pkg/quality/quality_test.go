@@ -0,0 +1,70 @@
+package quality
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func at(hour int) time.Time {
+	return time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quality")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	docs := []documents.CollectionEntry{}
+	for hour := 0; hour <= 48; hour += 4 {
+		docs = append(docs, documents.DataEntry{Name: "Italy", When: at(hour), Cases: uint64(100 + hour)})
+		if hour < 8 || hour > 24 {
+			// 24h hole, stuck at the same value afterwards
+			docs = append(docs, documents.DataEntry{Name: "Taiwan", When: at(hour), Cases: 10})
+		}
+		if hour <= 36 {
+			cases := uint64(50 + hour)
+			if hour == 20 {
+				cases = 1
+			}
+			docs = append(docs, documents.DataEntry{Name: "Spain", When: at(hour), Cases: cases})
+		}
+	}
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs, nil))
+
+	thresholds := Thresholds{Stale: 8 * time.Hour, Gap: 12 * time.Hour, Flat: 20 * time.Hour, ScrapeSlack: time.Minute, MaxGaps: 5}
+	report, err := Check(db, at(0), at(50), thresholds)
+	require.NoError(t, err)
+	require.Len(t, report.Entities, 3)
+	assert.Equal(t, at(48), report.LatestScrape[documents.CountryCollection])
+
+	byCode := map[string]Entity{}
+	for _, e := range report.Entities {
+		byCode[e.Code] = e
+	}
+	italy := byCode["italy"]
+	assert.Equal(t, 0, italy.Issues())
+	assert.Equal(t, at(48), italy.LastUpdated)
+
+	taiwan := byCode["taiwan"]
+	require.Len(t, taiwan.Gaps, 1)
+	assert.Equal(t, Period{From: at(4), To: at(28), Duration: "24h0m0s"}, taiwan.Gaps[0])
+	require.Len(t, taiwan.Flat, 1, "values did not change from hour 0 to 48 while Italy's did")
+	assert.False(t, taiwan.Stale)
+
+	spain := byCode["spain"]
+	assert.True(t, spain.Stale)
+	assert.True(t, spain.Disappeared)
+	assert.Equal(t, []Decrease{{When: at(20), Metric: "cases", From: 66, To: 1}}, spain.Decreases)
+	assert.Equal(t, "spain", report.Entities[0].Code, "most issues first")
+}
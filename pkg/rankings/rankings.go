@@ -0,0 +1,157 @@
+package rankings
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+const (
+	newPrefix    = "new_"
+	per1MSuffix  = "_per_1m"
+	perMillion   = 1e6
+	metricsUsage = "expected [new_]cases|deaths|tests[_per_1m], e.g. new_cases_per_1m"
+)
+
+// Metric value entities are ranked by.
+type Metric struct {
+	Name     string
+	value    timeseries.Metric
+	increase bool // increase over the window rather than the total
+	per1M    bool // relative to population
+}
+
+// ParseMetric parses metric names such as cases, new_deaths or new_cases_per_1m.
+func ParseMetric(name string) (Metric, error) {
+	res := Metric{Name: name}
+	base := name
+	if strings.HasPrefix(base, newPrefix) {
+		res.increase = true
+		base = strings.TrimPrefix(base, newPrefix)
+	}
+	if strings.HasSuffix(base, per1MSuffix) {
+		res.per1M = true
+		base = strings.TrimSuffix(base, per1MSuffix)
+	}
+	value, err := timeseries.ParseMetric(base)
+	if err != nil {
+		return res, errors.Errorf("unknown metric %s, %s", name, metricsUsage)
+	}
+	res.value = value
+	return res, nil
+}
+
+// PerCapita whether the metric is relative to population, which only countries report.
+func (m Metric) PerCapita() bool {
+	return m.per1M
+}
+
+// Series stored datapoints of a single entity.
+type Series struct {
+	Key  string
+	Docs []documents.DataEntry
+}
+
+// Entry single row of the ranking.
+type Entry struct {
+	Rank          int      `json:"rank"`
+	PreviousRank  *int     `json:"previous_rank,omitempty"`
+	Movement      *int     `json:"movement,omitempty"` // positive when the entity moved up since the previous window
+	Code          string   `json:"code"`
+	Name          string   `json:"name"`
+	Value         float64  `json:"value"`
+	PreviousValue *float64 `json:"previous_value,omitempty"`
+	Population    uint64   `json:"population,omitempty"`
+}
+
+// population the most recently reported population, 0 when unknown.
+func population(docs []documents.DataEntry) uint64 {
+	for i := len(docs) - 1; i >= 0; i-- {
+		if docs[i].Population > 0 {
+			return docs[i].Population
+		}
+	}
+	return 0
+}
+
+// values the metric over the window ending at the given time and over the window before it, NaN when unknown.
+func (m Metric) values(docs []documents.DataEntry, at time.Time, window time.Duration) (float64, float64) {
+	grid := []time.Time{at.Add(-2 * window), at.Add(-window), at}
+	v := timeseries.Resample(timeseries.FromEntries(docs, m.value), grid, timeseries.LOCF)
+	current, previous := v[2], v[1]
+	if m.increase {
+		current, previous = v[2]-v[1], v[1]-v[0]
+	}
+	if m.per1M {
+		p := float64(population(docs))
+		if p == 0 {
+			return math.NaN(), math.NaN()
+		}
+		current, previous = current*perMillion/p, previous*perMillion/p
+	}
+	return current, previous
+}
+
+type ranked struct {
+	index int
+	value float64
+}
+
+// rank returns ranks (starting with 1) by series index, series with unknown values are left out.
+func rank(values []float64, keys []string, desc bool) map[int]int {
+	rows := []ranked{}
+	for i, v := range values {
+		if !math.IsNaN(v) {
+			rows = append(rows, ranked{index: i, value: v})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].value != rows[j].value {
+			return (rows[i].value > rows[j].value) == desc
+		}
+		return keys[rows[i].index] < keys[rows[j].index]
+	})
+	res := map[int]int{}
+	for r, row := range rows {
+		res[row.index] = r + 1
+	}
+	return res
+}
+
+// Rank ranks the series by the metric over the window ending at the given time,
+// along with the ranks they had over the window before.
+func Rank(series []Series, metric Metric, at time.Time, window time.Duration, desc bool) []Entry {
+	keys := make([]string, len(series))
+	current := make([]float64, len(series))
+	previous := make([]float64, len(series))
+	for i, s := range series {
+		keys[i] = s.Key
+		current[i], previous[i] = metric.values(s.Docs, at, window)
+	}
+	currentRanks := rank(current, keys, desc)
+	previousRanks := rank(previous, keys, desc)
+
+	res := make([]Entry, 0, len(currentRanks))
+	for i, r := range currentRanks {
+		s := series[i]
+		entry := Entry{Rank: r, Code: s.Key, Value: current[i], Population: population(s.Docs)}
+		if len(s.Docs) > 0 {
+			entry.Name = s.Docs[len(s.Docs)-1].Name
+		}
+		if prevRank, ok := previousRanks[i]; ok {
+			prevValue := previous[i]
+			movement := prevRank - r
+			entry.PreviousRank, entry.PreviousValue, entry.Movement = &prevRank, &prevValue, &movement
+		}
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Rank < res[j].Rank
+	})
+	return res
+}
@@ -0,0 +1,66 @@
+package rankings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// series with the given cumulative cases on June 1st, 8th and 15th.
+func weekly(name string, population uint64, cases ...uint64) Series {
+	s := Series{Key: documents.Key(name)}
+	for i, c := range cases {
+		s.Docs = append(s.Docs, documents.DataEntry{Name: name, When: time.Date(2020, 6, 1+7*i, 0, 0, 0, 0, time.UTC), Cases: c, Population: population})
+	}
+	return s
+}
+
+func TestParseMetric(t *testing.T) {
+	m, err := ParseMetric("new_cases_per_1m")
+	require.NoError(t, err)
+	assert.True(t, m.increase)
+	assert.True(t, m.per1M)
+
+	m, err = ParseMetric("deaths")
+	require.NoError(t, err)
+	assert.False(t, m.increase || m.per1M)
+
+	_, err = ParseMetric("new_recovered")
+	assert.Error(t, err)
+}
+
+func TestRank(t *testing.T) {
+	series := []Series{
+		weekly("Big", 100000000, 1000, 2000, 2500), // +1000 then +500 per 100M
+		weekly("Small", 1000000, 100, 110, 200),    // +10 then +90 per 1M
+		weekly("Unknown", 0, 50, 60, 70),           // no population
+		{Key: "late", Docs: []documents.DataEntry{{Name: "Late", When: time.Date(2020, 6, 10, 0, 0, 0, 0, time.UTC), Cases: 3000}}}, // no data for the previous window
+	}
+	at := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	metric, err := ParseMetric("new_cases_per_1m")
+	require.NoError(t, err)
+
+	res := Rank(series, metric, at, 7*timeseries.Day, true)
+	require.Len(t, res, 2)
+	assert.Equal(t, "small", res[0].Code)
+	assert.Equal(t, 1, res[0].Rank)
+	assert.InDelta(t, 90, res[0].Value, 1e-9)
+	assert.Equal(t, 1, *res[0].Movement)
+	assert.Equal(t, uint64(1000000), res[0].Population)
+
+	assert.Equal(t, "big", res[1].Code)
+	assert.InDelta(t, 5, res[1].Value, 1e-9)
+	assert.InDelta(t, 10, *res[1].PreviousValue, 1e-9)
+	assert.Equal(t, -1, *res[1].Movement)
+
+	metric, _ = ParseMetric("cases")
+	res = Rank(series, metric, at, 7*timeseries.Day, false)
+	require.Len(t, res, 4)
+	assert.Equal(t, []string{"unknown", "small", "big", "late"}, []string{res[0].Code, res[1].Code, res[2].Code, res[3].Code})
+	assert.Nil(t, res[3].PreviousRank)
+	assert.Equal(t, "Late", res[3].Name)
+}
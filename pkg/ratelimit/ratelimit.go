@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sweepEvery idle buckets are dropped every that many calls, so one-off clients do not pile up.
+const sweepEvery = 1024
+
+// Limit requests allowed per period, as a burst or spread out.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses "<requests>/<period>", e.g. 600/1m.
+func ParseLimit(v string) (Limit, error) {
+	parts := strings.SplitN(strings.TrimSpace(v), "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, errors.Errorf("invalid rate limit %q, expected <requests>/<period>, e.g. 600/1m", v)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 1 {
+		return Limit{}, errors.Errorf("invalid rate limit %q, requests must be a positive number", v)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, errors.Errorf("invalid rate limit %q, period must be a positive duration", v)
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+func (l Limit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// Decision outcome of a single request.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // bucket size
+	Remaining  int           // requests left right away
+	RetryAfter time.Duration // until the next request is allowed, 0 when allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// Limiter token buckets per client key. Buckets start full and refill at Requests per Period.
+type Limiter struct {
+	limit Limit
+	mu    sync.Mutex
+	calls int
+	keys  map[string]*bucket
+}
+
+// New creates a limiter allowing limit.Requests per limit.Period per key.
+func New(limit Limit) *Limiter {
+	return &Limiter{limit: limit, keys: map[string]*bucket{}}
+}
+
+// Limit the limit the limiter enforces.
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+func (l *Limiter) perSecond() float64 {
+	return float64(l.limit.Requests) / l.limit.Period.Seconds()
+}
+
+// refill tokens of the bucket as of now.
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.at).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.limit.Requests), b.tokens+elapsed*l.perSecond())
+		b.at = now
+	}
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for k, b := range l.keys {
+		l.refill(b, now)
+		if b.tokens >= float64(l.limit.Requests) {
+			delete(l.keys, k)
+		}
+	}
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// Allow takes a token from the bucket of the key, if there is one.
+func (l *Limiter) Allow(key string, now time.Time) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.calls++; l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+	b, ok := l.keys[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Requests), at: now}
+		l.keys[key] = b
+	}
+	l.refill(b, now)
+
+	res := Decision{Limit: l.limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / l.perSecond())
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(l.limit.Requests) - b.tokens) / l.perSecond())
+	return res
+}
+
+// Refund gives back a token Allow took, for requests that turned out not to count.
+func (l *Limiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.keys[key]; ok {
+		b.tokens = math.Min(float64(l.limit.Requests), b.tokens+1)
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("600/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 600, Period: time.Minute}, l)
+	assert.Equal(t, "600/1m0s", l.String())
+
+	for _, v := range []string{"", "600", "0/1m", "x/1m", "10/0s", "10/soon"} {
+		_, err := ParseLimit(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	l := New(Limit{Requests: 2, Period: time.Second})
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	d := l.Allow("a", now)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+	assert.Equal(t, 2, d.Limit)
+	assert.True(t, l.Allow("a", now).Allowed)
+
+	d = l.Allow("a", now)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, time.Second, d.Reset)
+
+	assert.True(t, l.Allow("b", now).Allowed, "buckets are per key")
+	assert.True(t, l.Allow("a", now.Add(500*time.Millisecond)).Allowed)
+	assert.False(t, l.Allow("a", now.Add(500*time.Millisecond)).Allowed)
+
+	d = l.Allow("a", now.Add(time.Hour))
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining, "refill stops at the bucket size")
+}
+
+func TestRefund(t *testing.T) {
+	l := New(Limit{Requests: 1, Period: time.Minute})
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, l.Allow("a", now).Allowed)
+	l.Refund("a")
+	assert.True(t, l.Allow("a", now).Allowed)
+	assert.False(t, l.Allow("a", now).Allowed)
+	l.Refund("a")
+	l.Refund("a")
+	assert.Equal(t, 0, l.Allow("a", now).Remaining, "refunds stop at the bucket size")
+}
+
+func TestSweep(t *testing.T) {
+	l := New(Limit{Requests: 1, Period: time.Second})
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < sweepEvery-1; i++ {
+		l.Allow(strconv.Itoa(i), now)
+	}
+	assert.Len(t, l.keys, sweepEvery-1)
+	l.Allow("late", now.Add(time.Minute))
+	assert.Len(t, l.keys, 1)
+}
@@ -0,0 +1,207 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Bucket stores reconciliation records keyed by RFC3339 timestamps.
+	Bucket = "Reconciliation"
+	// USATotalKey bucket key of worldometers' "USA Total" row in the states table.
+	USATotalKey = "usa_total"
+	// USAKey bucket key of the USA row in the countries table.
+	USAKey = "usa"
+)
+
+// ThresholdExceededError the sources disagree by more than the threshold.
+const ThresholdExceededError = sentinelError("US totals do not match")
+
+type sentinelError string
+
+func (e sentinelError) Error() string {
+	return string(e)
+}
+
+// Totals cases, deaths and tests. Signed, so it fits differences as well.
+type Totals struct {
+	Cases  int64 `json:"cases"`
+	Deaths int64 `json:"deaths"`
+	Tests  int64 `json:"tests"`
+}
+
+func totalsOf(doc documents.DataEntry) *Totals {
+	return &Totals{Cases: int64(doc.Cases), Deaths: int64(doc.Deaths), Tests: int64(doc.Tests)}
+}
+
+func diff(a *Totals, b *Totals) *Totals {
+	if a == nil || b == nil {
+		return nil
+	}
+	return &Totals{Cases: a.Cases - b.Cases, Deaths: a.Deaths - b.Deaths, Tests: a.Tests - b.Tests}
+}
+
+// relative difference of cases and deaths, whichever is larger. Tests are counted differently across sources.
+func relative(a *Totals, b *Totals) float64 {
+	if a == nil || b == nil {
+		return 0
+	}
+	res := 0.0
+	for _, pair := range [][2]int64{{a.Cases, b.Cases}, {a.Deaths, b.Deaths}} {
+		if max := math.Max(float64(pair[0]), float64(pair[1])); max > 0 {
+			res = math.Max(res, math.Abs(float64(pair[0]-pair[1]))/max)
+		}
+	}
+	return res
+}
+
+// Record single reconciliation of the states sum, the "USA Total" row and the USA country row.
+type Record struct {
+	When                time.Time `json:"when"`
+	States              Totals    `json:"states"` // sum of the states reported by the latest scrape
+	StatesCount         int       `json:"states_count"`
+	USATotal            *Totals   `json:"usa_total,omitempty"`
+	USA                 *Totals   `json:"usa,omitempty"`
+	StatesMinusUSATotal *Totals   `json:"states_minus_usa_total,omitempty"`
+	StatesMinusUSA      *Totals   `json:"states_minus_usa,omitempty"`
+	USATotalMinusUSA    *Totals   `json:"usa_total_minus_usa,omitempty"`
+	MaxDifference       float64   `json:"max_difference"` // largest relative difference of cases or deaths between any two sources
+	Exceeded            bool      `json:"exceeded"`
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("states sum %+v (%d states), USA Total %+v, USA %+v: %.2f%% apart", r.States, r.StatesCount, r.USATotal, r.USA, 100*r.MaxDifference)
+}
+
+// compare builds the record out of the newest datapoints. States reported more than fresh before the newest one
+// are left out, they are not part of the latest scrape.
+func compare(tx *bolt.Tx, now time.Time, fresh time.Duration) (Record, error) {
+	res := Record{When: now.UTC()}
+	states := []documents.DataEntry{}
+	newest := time.Time{}
+	for _, k := range documents.ListKeys(tx, documents.StateCollection) {
+		doc, ok, err := documents.ReadLast(tx, k)
+		if err != nil {
+			return res, err
+		}
+		if !ok {
+			continue
+		}
+		if k == USATotalKey {
+			res.USATotal = totalsOf(doc)
+			continue
+		}
+		states = append(states, doc)
+		if doc.GetWhen().After(newest) {
+			newest = doc.GetWhen()
+		}
+	}
+	for _, doc := range states {
+		if newest.Sub(doc.GetWhen()) > fresh {
+			continue
+		}
+		res.States.Cases += int64(doc.Cases)
+		res.States.Deaths += int64(doc.Deaths)
+		res.States.Tests += int64(doc.Tests)
+		res.StatesCount++
+	}
+	usa, ok, err := documents.ReadLast(tx, documents.ResolveAlias(tx, USAKey))
+	if err != nil {
+		return res, err
+	}
+	if ok {
+		res.USA = totalsOf(usa)
+	}
+
+	res.StatesMinusUSATotal = diff(&res.States, res.USATotal)
+	res.StatesMinusUSA = diff(&res.States, res.USA)
+	res.USATotalMinusUSA = diff(res.USATotal, res.USA)
+	res.MaxDifference = math.Max(relative(&res.States, res.USATotal), math.Max(relative(&res.States, res.USA), relative(res.USATotal, res.USA)))
+	return res, nil
+}
+
+// previous newest stored record.
+func previous(tx *bolt.Tx) (Record, bool, error) {
+	res := Record{}
+	bucket := tx.Bucket([]byte(Bucket))
+	if bucket == nil {
+		return res, false, nil
+	}
+	_, payload := bucket.Cursor().Last()
+	if payload == nil {
+		return res, false, nil
+	}
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return res, false, errors.Wrap(err, "error decoding reconciliation record")
+	}
+	return res, true, nil
+}
+
+// Run compares the sum of the states, the "USA Total" row and the USA country row, and stores the result.
+// ThresholdExceededError is returned when the difference goes past the threshold, once until it gets back below.
+func Run(db *bolt.DB, now time.Time, fresh time.Duration, threshold float64) (Record, error) {
+	var res Record
+	var alert bool
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if res, err = compare(tx, now, fresh); err != nil {
+			return err
+		}
+		if res.StatesCount == 0 && res.USA == nil {
+			return nil
+		}
+		res.Exceeded = res.MaxDifference > threshold
+		prev, ok, err := previous(tx)
+		if err != nil {
+			return err
+		}
+		alert = res.Exceeded && !(ok && prev.Exceeded)
+
+		payload := &bytes.Buffer{}
+		if err := json.NewEncoder(payload).Encode(res); err != nil {
+			return errors.Wrap(err, "error encoding reconciliation record")
+		}
+		bucket, err := tx.CreateBucketIfNotExists([]byte(Bucket))
+		if err != nil {
+			return errors.Wrapf(err, "error creating %s bucket", Bucket)
+		}
+		return bucket.Put([]byte(res.When.Format(time.RFC3339)), payload.Bytes())
+	})
+	if err != nil {
+		return res, errors.Wrap(err, "error reconciling US totals")
+	}
+	if alert {
+		return res, errors.Wrap(ThresholdExceededError, res.String())
+	}
+	return res, nil
+}
+
+// History reads records stored between from and to (inclusive), oldest first.
+func History(db *bolt.DB, from time.Time, to time.Time) ([]Record, error) {
+	res := []Record{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(Bucket))
+		if bucket == nil {
+			return nil
+		}
+		min := []byte(from.UTC().Format(time.RFC3339))
+		max := []byte(to.UTC().Format(time.RFC3339))
+		c := bucket.Cursor()
+		for k, v := c.Seek(min); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+			record := Record{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return errors.Wrapf(err, "error decoding reconciliation record %s", k)
+			}
+			res = append(res, record)
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,66 @@
+package reconcile
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	scrape := time.Date(2020, 6, 2, 0, 0, 0, 0, time.UTC)
+	state := func(name string, when time.Time, cases uint64) documents.CollectionEntry {
+		return documents.DataEntry{Name: name, When: when, Cases: cases, Deaths: cases / 100}
+	}
+	require.NoError(t, documents.BulkSave(db, documents.StateCollection, []documents.CollectionEntry{
+		state("California", scrape, 1000),
+		state("New York", scrape, 2000),
+		state("Wuhan Repatriated", scrape.Add(-24*time.Hour), 5), // gone from the table
+		state("USA Total", scrape, 3000),
+	}, nil))
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, []documents.CollectionEntry{state("USA", scrape, 3000)}, nil))
+
+	record, err := Run(db, scrape.Add(time.Minute), time.Hour, 0.02)
+	require.NoError(t, err)
+	assert.Equal(t, 2, record.StatesCount)
+	assert.Equal(t, Totals{Cases: 3000, Deaths: 30}, record.States)
+	assert.Equal(t, Totals{}, *record.StatesMinusUSA)
+	assert.False(t, record.Exceeded)
+
+	next := scrape.Add(time.Hour)
+	require.NoError(t, documents.BulkSave(db, documents.StateCollection, []documents.CollectionEntry{
+		state("California", next, 1100),
+		state("New York", next, 2100),
+		state("USA Total", next, 3200),
+	}, nil))
+	record, err = Run(db, next.Add(time.Minute), time.Hour, 0.02)
+	require.True(t, errors.Is(err, ThresholdExceededError))
+	assert.True(t, record.Exceeded)
+	assert.Equal(t, int64(200), record.StatesMinusUSA.Cases)
+	assert.Equal(t, int64(200), record.USATotalMinusUSA.Cases)
+	assert.Equal(t, int64(0), record.StatesMinusUSATotal.Cases)
+
+	// reported once until it gets back below the threshold
+	_, err = Run(db, next.Add(2*time.Minute), time.Hour, 0.02)
+	require.NoError(t, err)
+
+	history, err := History(db, scrape, next.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.False(t, history[0].Exceeded)
+	assert.True(t, history[2].Exceeded)
+}
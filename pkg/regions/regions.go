@@ -0,0 +1,210 @@
+package regions
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+)
+
+// World pseudo-region every country belongs to.
+const World = "World"
+
+// worldometers lists per continent and world totals in the countries table, these end up stored as countries.
+// Same for the USA total in the states table.
+var totals = map[string]bool{
+	"africa":            true,
+	"asia":              true,
+	"australia/oceania": true,
+	"europe":            true,
+	"north_america":     true,
+	"south_america":     true,
+	"world":             true,
+	"usa_total":         true,
+}
+
+// IsTotal tells worldometers' own total rows from actual countries and states.
+func IsTotal(bucketKey string) bool {
+	return totals[bucketKey]
+}
+
+// Code URL friendly region identifier, e.g. australia_oceania.
+func Code(name string) string {
+	return strings.ReplaceAll(documents.Key(name), "/", "_")
+}
+
+// Region countries grouped by the region worldometers puts them in.
+type Region struct {
+	Name    string   `json:"name"`
+	Code    string   `json:"code"`
+	Members []string `json:"members"` // country bucket keys
+}
+
+// TotalKey bucket key of worldometers' own total row for the region.
+func (r Region) TotalKey() string {
+	return documents.Key(r.Name)
+}
+
+// Group builds regions out of the newest country datapoints, World goes last.
+// Countries without a known region only count towards World.
+func Group(countries []latest.Entry) []Region {
+	byName := map[string]*Region{}
+	world := Region{Name: World, Code: Code(World), Members: []string{}}
+	for _, country := range countries {
+		if IsTotal(country.Key) {
+			continue
+		}
+		world.Members = append(world.Members, country.Key)
+		if country.Region == "" {
+			continue
+		}
+		region, ok := byName[country.Region]
+		if !ok {
+			region = &Region{Name: country.Region, Code: Code(country.Region), Members: []string{}}
+			byName[country.Region] = region
+		}
+		region.Members = append(region.Members, country.Key)
+	}
+
+	res := make([]Region, 0, len(byName)+1)
+	for _, region := range byName {
+		sort.Strings(region.Members)
+		res = append(res, *region)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	sort.Strings(world.Members)
+	return append(res, world)
+}
+
+// Find looks the region up by name or code, case insensitive.
+func Find(regions []Region, nameOrCode string) (Region, bool) {
+	code := Code(nameOrCode)
+	for _, region := range regions {
+		if region.Code == code {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// Totals cases, deaths and tests. Signed, so it fits differences as well.
+type Totals struct {
+	Cases  int64 `json:"cases"`
+	Deaths int64 `json:"deaths"`
+	Tests  int64 `json:"tests"`
+}
+
+func (t Totals) minus(other Totals) Totals {
+	return Totals{Cases: t.Cases - other.Cases, Deaths: t.Deaths - other.Deaths, Tests: t.Tests - other.Tests}
+}
+
+func totalsOf(doc documents.DataEntry) Totals {
+	return Totals{Cases: int64(doc.Cases), Deaths: int64(doc.Deaths), Tests: int64(doc.Tests)}
+}
+
+// Summary newest region totals next to what worldometers reports for the region.
+type Summary struct {
+	Region
+	Totals
+	Reported  *Totals   `json:"reported,omitempty"` // worldometers' own total, when there is one
+	Diff      *Totals   `json:"diff,omitempty"`     // sum minus reported, non zero values point at gaps in the countries table
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Summarize sums the newest datapoints of each region's members.
+func Summarize(countries []latest.Entry) []Summary {
+	byKey := map[string]latest.Entry{}
+	for _, country := range countries {
+		byKey[country.Key] = country
+	}
+	res := []Summary{}
+	for _, region := range Group(countries) {
+		summary := Summary{Region: region}
+		for _, key := range region.Members {
+			member := byKey[key]
+			summary.Cases += int64(member.Cases)
+			summary.Deaths += int64(member.Deaths)
+			summary.Tests += int64(member.Tests)
+			if member.GetWhen().After(summary.UpdatedAt) {
+				summary.UpdatedAt = member.GetWhen()
+			}
+		}
+		if total, ok := byKey[region.TotalKey()]; ok {
+			reported := totalsOf(total.DataEntry)
+			diff := summary.Totals.minus(reported)
+			summary.Reported = &reported
+			summary.Diff = &diff
+		}
+		res = append(res, summary)
+	}
+	return res
+}
+
+// Point region totals at a single grid time.
+type Point struct {
+	When time.Time `json:"when"`
+	Totals
+	Reporting int     `json:"reporting"` // members with data at that time
+	Reported  *Totals `json:"reported,omitempty"`
+	Diff      *Totals `json:"diff,omitempty"`
+}
+
+var metrics = []struct {
+	value func(documents.DataEntry) float64
+	add   func(t *Totals, v int64)
+}{
+	{func(d documents.DataEntry) float64 { return float64(d.Cases) }, func(t *Totals, v int64) { t.Cases += v }},
+	{func(d documents.DataEntry) float64 { return float64(d.Deaths) }, func(t *Totals, v int64) { t.Deaths += v }},
+	{func(d documents.DataEntry) float64 { return float64(d.Tests) }, func(t *Totals, v int64) { t.Tests += v }},
+}
+
+// Rollup sums member series on the grid, carrying each member's last observation forward.
+// total is worldometers' own series for the region, nil if there is none.
+func Rollup(members map[string][]documents.DataEntry, total []documents.DataEntry, grid []time.Time) []Point {
+	res := make([]Point, len(grid))
+	for i := range grid {
+		res[i].When = grid[i]
+	}
+	for _, docs := range members {
+		for m, metric := range metrics {
+			values := timeseries.Resample(timeseries.FromEntries(docs, metric.value), grid, timeseries.LOCF)
+			for i, v := range values {
+				if math.IsNaN(v) {
+					continue
+				}
+				metric.add(&res[i].Totals, int64(v))
+				if m == 0 {
+					res[i].Reporting++
+				}
+			}
+		}
+	}
+	if len(total) == 0 {
+		return res
+	}
+	reported := make([]Totals, len(grid))
+	known := make([]bool, len(grid))
+	for _, metric := range metrics {
+		values := timeseries.Resample(timeseries.FromEntries(total, metric.value), grid, timeseries.LOCF)
+		for i, v := range values {
+			if !math.IsNaN(v) {
+				metric.add(&reported[i], int64(v))
+				known[i] = true
+			}
+		}
+	}
+	for i := range res {
+		if known[i] {
+			diff := res[i].Totals.minus(reported[i])
+			res[i].Reported = &reported[i]
+			res[i].Diff = &diff
+		}
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+package regions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entry(name string, region string, day int, cases uint64) documents.DataEntry {
+	return documents.DataEntry{Name: name, Region: region, When: time.Date(2020, 6, day, 0, 0, 0, 0, time.UTC), Cases: cases, Deaths: cases / 10}
+}
+
+func latestEntry(doc documents.DataEntry) latest.Entry {
+	return latest.Entry{Key: documents.Key(doc.Name), DataEntry: doc}
+}
+
+func TestSummarize(t *testing.T) {
+	countries := []latest.Entry{
+		latestEntry(entry("Ukraine", "Europe", 2, 100)),
+		latestEntry(entry("Italy", "Europe", 3, 300)),
+		latestEntry(entry("Australia", "Australia/Oceania", 3, 50)),
+		latestEntry(entry("Diamond Princess", "", 1, 10)),
+		latestEntry(entry("Europe", "Europe", 3, 450)),
+		latestEntry(entry("World", "All", 3, 500)),
+	}
+	summaries := Summarize(countries)
+	require.Len(t, summaries, 3)
+
+	assert.Equal(t, "australia_oceania", summaries[0].Code)
+	assert.Nil(t, summaries[0].Reported)
+
+	europe := summaries[1]
+	assert.Equal(t, []string{"italy", "ukraine"}, europe.Members)
+	assert.Equal(t, Totals{Cases: 400, Deaths: 40}, europe.Totals)
+	assert.Equal(t, Totals{Cases: -50, Deaths: -5}, *europe.Diff)
+	assert.Equal(t, time.Date(2020, 6, 3, 0, 0, 0, 0, time.UTC), europe.UpdatedAt)
+
+	world := summaries[2]
+	assert.Len(t, world.Members, 4)
+	assert.Equal(t, int64(460), world.Cases)
+	assert.Equal(t, int64(-40), world.Diff.Cases)
+
+	region, ok := Find(Group(countries), "Australia/Oceania")
+	require.True(t, ok)
+	assert.Equal(t, "australia/oceania", region.TotalKey())
+	_, ok = Find(Group(countries), "Atlantis")
+	assert.False(t, ok)
+}
+
+func TestRollup(t *testing.T) {
+	members := map[string][]documents.DataEntry{
+		"ukraine": {entry("Ukraine", "Europe", 1, 100), entry("Ukraine", "Europe", 3, 200)},
+		"italy":   {entry("Italy", "Europe", 2, 1000)},
+	}
+	total := []documents.DataEntry{entry("Europe", "Europe", 2, 1100)}
+	grid := []time.Time{
+		time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 6, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 6, 3, 0, 0, 0, 0, time.UTC),
+	}
+	points := Rollup(members, total, grid)
+	require.Len(t, points, 3)
+
+	assert.Equal(t, Totals{Cases: 100, Deaths: 10}, points[0].Totals)
+	assert.Equal(t, 1, points[0].Reporting)
+	assert.Nil(t, points[0].Diff)
+
+	assert.Equal(t, int64(1100), points[1].Cases)
+	assert.Equal(t, 2, points[1].Reporting)
+	assert.Equal(t, Totals{}, *points[1].Diff)
+
+	assert.Equal(t, int64(1200), points[2].Cases)
+	assert.Equal(t, int64(100), points[2].Diff.Cases)
+}
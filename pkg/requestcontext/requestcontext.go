@@ -7,25 +7,37 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/mkorenkov/covid-19/pkg/config"
 	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/mkorenkov/covid-19/pkg/rules"
+	"github.com/mkorenkov/covid-19/pkg/stream"
+	"github.com/mkorenkov/covid-19/pkg/webhooks"
 )
 
 type ctxKey struct{}
 
 // RequestContext holds DB connection and stuff
 type RequestContext struct {
-	Config   config.Config
-	DB       *bolt.DB
-	Errors   chan error
-	UploadS3 chan documents.CollectionEntry
+	Config    config.Config
+	DB        *bolt.DB
+	Errors    chan error
+	UploadS3  chan documents.CollectionEntry
+	Validator documents.Validator
+	Latest    *latest.Cache        // optional, nil disables latest values
+	Health    *health.Tracker      // optional, nil disables health tracking
+	Stream    *stream.Broker       // optional, nil disables publishing new datapoints
+	Webhooks  *webhooks.Dispatcher // optional, nil disables webhooks
+	Rules     *rules.Engine        // optional, nil disables alerting
 }
 
 // New initializes a new RequestContext.
-func New(cfg config.Config, db *bolt.DB, errorChan chan error, s3backup chan documents.CollectionEntry) *RequestContext {
+func New(cfg config.Config, db *bolt.DB, errorChan chan error, s3backup chan documents.CollectionEntry, validator documents.Validator) *RequestContext {
 	return &RequestContext{
-		Config:   cfg,
-		DB:       db,
-		Errors:   errorChan,
-		UploadS3: s3backup,
+		Config:    cfg,
+		DB:        db,
+		Errors:    errorChan,
+		UploadS3:  s3backup,
+		Validator: validator,
 	}
 }
 
@@ -66,6 +78,54 @@ func ToS3(ctx context.Context) chan documents.CollectionEntry {
 	return nil
 }
 
+// Validator returns documents.Validator stored in the context
+func Validator(ctx context.Context) documents.Validator {
+	if r := GetRequestContext(ctx); r != nil {
+		return r.Validator
+	}
+	return nil
+}
+
+// Latest returns latest values cache stored in the context
+func Latest(ctx context.Context) *latest.Cache {
+	if r := GetRequestContext(ctx); r != nil {
+		return r.Latest
+	}
+	return nil
+}
+
+// Health returns subsystems health tracker stored in the context
+func Health(ctx context.Context) *health.Tracker {
+	if r := GetRequestContext(ctx); r != nil {
+		return r.Health
+	}
+	return nil
+}
+
+// Stream returns new datapoints broker stored in the context
+func Stream(ctx context.Context) *stream.Broker {
+	if r := GetRequestContext(ctx); r != nil {
+		return r.Stream
+	}
+	return nil
+}
+
+// Webhooks returns webhooks dispatcher stored in the context
+func Webhooks(ctx context.Context) *webhooks.Dispatcher {
+	if r := GetRequestContext(ctx); r != nil {
+		return r.Webhooks
+	}
+	return nil
+}
+
+// Rules returns alerting rules engine stored in the context
+func Rules(ctx context.Context) *rules.Engine {
+	if r := GetRequestContext(ctx); r != nil {
+		return r.Rules
+	}
+	return nil
+}
+
 // InjectRequestContextMiddleware injects a given request context into HTTP request.
 func InjectRequestContextMiddleware(handler http.Handler, rc *RequestContext) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/mailer"
+	"github.com/mkorenkov/covid-19/pkg/reporter"
+	"github.com/mkorenkov/covid-19/pkg/webhooks"
+	"github.com/pkg/errors"
+)
+
+// Notifier names used in rules.
+const (
+	ReporterNotifier = "reporter"
+	WebhookNotifier  = "webhook"
+	EmailNotifier    = "email"
+)
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(rule Rule, alert Alert) error
+}
+
+// NotifierFunc turns a function into a Notifier.
+type NotifierFunc func(rule Rule, alert Alert) error
+
+// Notify calls f(rule, alert).
+func (f NotifierFunc) Notify(rule Rule, alert Alert) error {
+	return f(rule, alert)
+}
+
+// Reporter reports alerts the same way errors are, to Sentry.
+func Reporter() Notifier {
+	return NotifierFunc(func(rule Rule, alert Alert) error {
+		reporter.Report(errors.New(alert.String()))
+		return nil
+	})
+}
+
+// Webhook sends alerts to webhook subscribers of alert events.
+func Webhook(dispatcher *webhooks.Dispatcher) Notifier {
+	return NotifierFunc(func(rule Rule, alert Alert) error {
+		dispatcher.Emit(webhooks.Event{
+			ID:         webhooks.AlertEvent + "/" + alert.Rule + "/" + alert.Collection + "/" + alert.Code + "/" + alert.When.Format(time.RFC3339),
+			Type:       webhooks.AlertEvent,
+			When:       alert.When,
+			Collection: alert.Collection,
+			Code:       alert.Code,
+			Alert:      alert,
+		})
+		return nil
+	})
+}
+
+// Email sends alerts to the rule's email recipients.
+func Email(cfg mailer.Config) Notifier {
+	return NotifierFunc(func(rule Rule, alert Alert) error {
+		text := &strings.Builder{}
+		fmt.Fprintln(text, alert.String())
+		if alert.Description != "" {
+			fmt.Fprintf(text, "\n%s\n", alert.Description)
+		}
+		fmt.Fprintf(text, "\nFiring since %s, evaluated at %s.\n", alert.Since.Format(time.RFC3339), alert.When.Format(time.RFC3339))
+		return mailer.Send(cfg, mailer.Message{
+			To:      rule.Email,
+			Subject: fmt.Sprintf("[coviddy] %s: %s %s", strings.ToUpper(alert.Status), alert.Rule, alert.Name),
+			Text:    text.String(),
+		})
+	})
+}
+
+// Engine evaluates rules after each scrape and delivers the alerts.
+type Engine struct {
+	db        *bolt.DB
+	rules     []Rule
+	notifiers map[string]Notifier
+}
+
+// New creates the engine, every notifier the rules refer to has to be given.
+func New(db *bolt.DB, rules []Rule, notifiers map[string]Notifier) (*Engine, error) {
+	for _, rule := range rules {
+		for _, name := range rule.Notify {
+			if _, ok := notifiers[name]; !ok {
+				return nil, errors.Errorf("rule %s: unknown or unconfigured notifier %q", rule.Name, name)
+			}
+		}
+	}
+	return &Engine{db: db, rules: rules, notifiers: notifiers}, nil
+}
+
+// Rules the engine evaluates.
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Evaluate runs the rules of the collection, persists their states and delivers the alerts.
+// Delivery failures do not roll the states back, so an alert is never sent twice.
+func (e *Engine) Evaluate(collection string, now time.Time) ([]Alert, error) {
+	alerts, err := evaluate(e.db, e.rules, collection, now)
+	if err != nil {
+		return nil, err
+	}
+	rules := map[string]Rule{}
+	for _, rule := range e.rules {
+		rules[rule.Name] = rule
+	}
+	failures := []string{}
+	for _, alert := range alerts {
+		rule := rules[alert.Rule]
+		for _, name := range rule.Notify {
+			if err := e.notifiers[name].Notify(rule, alert); err != nil {
+				failures = append(failures, fmt.Sprintf("%s via %s: %s", alert.Rule, name, err))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return alerts, errors.Errorf("error delivering alerts: %s", strings.Join(failures, "; "))
+	}
+	return alerts, nil
+}
@@ -0,0 +1,474 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+// Series values of a single entity the expressions are evaluated against.
+type Series interface {
+	// Value returns the metric (cases, deaths or tests) as of ago before the newest datapoint, NaN when unknown.
+	Value(metric string, ago time.Duration) float64
+	// Population of the entity, NaN when unknown.
+	Population() float64
+}
+
+// Expr compiled expression. Comparisons and logical operators evaluate to 1 or 0,
+// anything involving unknown values (NaN) is false.
+type Expr struct {
+	source   string
+	root     node
+	lookback time.Duration
+}
+
+// String source of the expression.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Lookback how far back the expression looks.
+func (e *Expr) Lookback() time.Duration {
+	return e.lookback
+}
+
+// Eval evaluates the expression.
+func (e *Expr) Eval(s Series) float64 {
+	return e.root.eval(s)
+}
+
+// True tells whether the expression holds.
+func (e *Expr) True(s Series) bool {
+	return truthy(e.Eval(s))
+}
+
+// Subject value the expression checks: the left side of the top level comparison, or the whole expression.
+func (e *Expr) Subject(s Series) float64 {
+	if c, ok := e.root.(*binary); ok && c.isComparison() {
+		return c.left.eval(s)
+	}
+	return e.Eval(s)
+}
+
+func truthy(v float64) bool {
+	return !math.IsNaN(v) && v != 0
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type node interface {
+	eval(s Series) float64
+}
+
+type number float64
+
+func (n number) eval(Series) float64 {
+	return float64(n)
+}
+
+// metric value, optionally as of some time ago, e.g. cases[14d].
+type metric struct {
+	name string
+	ago  time.Duration
+}
+
+func (m metric) eval(s Series) float64 {
+	if m.name == "population" {
+		return s.Population()
+	}
+	return s.Value(m.name, m.ago)
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (c call) eval(s Series) float64 {
+	switch c.name {
+	case "per_1m":
+		return c.args[0].eval(s) * 1e6 / s.Population()
+	case "abs":
+		return math.Abs(c.args[0].eval(s))
+	}
+	// delta and ratio take a metric and a duration
+	m := c.args[0].(metric)
+	ago := time.Duration(c.args[1].(number))
+	now, then := m.eval(s), metric{name: m.name, ago: m.ago + ago}.eval(s)
+	if c.name == "delta" {
+		return now - then
+	}
+	if then == 0 {
+		return math.NaN()
+	}
+	return now / then
+}
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (u unary) eval(s Series) float64 {
+	v := u.operand.eval(s)
+	if u.op == "not" {
+		return boolValue(!truthy(v))
+	}
+	return -v
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (b *binary) isComparison() bool {
+	switch b.op {
+	case ">", ">=", "<", "<=", "==", "!=":
+		return true
+	}
+	return false
+}
+
+func (b *binary) eval(s Series) float64 {
+	l := b.left.eval(s)
+	switch b.op {
+	case "and":
+		return boolValue(truthy(l) && truthy(b.right.eval(s)))
+	case "or":
+		return boolValue(truthy(l) || truthy(b.right.eval(s)))
+	}
+	r := b.right.eval(s)
+	if b.isComparison() && (math.IsNaN(l) || math.IsNaN(r)) {
+		return 0
+	}
+	switch b.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return math.NaN()
+		}
+		return l / r
+	case ">":
+		return boolValue(l > r)
+	case ">=":
+		return boolValue(l >= r)
+	case "<":
+		return boolValue(l < r)
+	case "<=":
+		return boolValue(l <= r)
+	case "==":
+		return boolValue(l == r)
+	}
+	return boolValue(l != r)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokDuration
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	res := []token{}
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			kind := tokNumber
+			if i < len(src) && (src[i] == 'd' || src[i] == 'h') {
+				kind = tokDuration
+				i++
+			}
+			res = append(res, token{kind: kind, text: src[start:i], pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			res = append(res, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			op := string(c)
+			if i+1 < len(src) && src[i+1] == '=' && strings.ContainsRune("<>=!", c) {
+				op = src[i : i+2]
+			} else if !strings.ContainsRune("+-*/()[],<>", c) {
+				return nil, errors.Errorf("unexpected %q at %d", op, i)
+			}
+			res = append(res, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(res, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	lookback time.Duration
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokEOF {
+		found = "end of expression"
+	}
+	return errors.Errorf("%s at %d, found %q", fmt.Sprintf(format, args...), t.pos, found)
+}
+
+func (p *parser) binaryLevel(operand func() (node, error), ops ...string) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) or() (node, error) {
+	return p.binaryLevel(p.and, "or")
+}
+
+func (p *parser) and() (node, error) {
+	return p.binaryLevel(p.not, "and")
+}
+
+func (p *parser) not() (node, error) {
+	if _, ok := p.accept("not"); ok {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: "not", operand: operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept(">", ">=", "<", "<=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) sum() (node, error) {
+	return p.binaryLevel(p.product, "+", "-")
+}
+
+func (p *parser) product() (node, error) {
+	return p.binaryLevel(p.unary, "*", "/")
+}
+
+func (p *parser) unary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: "-", operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) duration() (time.Duration, error) {
+	t := p.peek()
+	if t.kind != tokDuration {
+		return 0, p.errorf("expected duration, e.g. 7d or 12h")
+	}
+	p.next()
+	unit := time.Hour
+	if strings.HasSuffix(t.text, "d") {
+		unit = timeseries.Day
+	}
+	v, err := strconv.ParseFloat(t.text[:len(t.text)-1], 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid duration %q at %d", t.text, t.pos)
+	}
+	return time.Duration(v * float64(unit)), nil
+}
+
+var metricNames = map[string]bool{"cases": true, "deaths": true, "tests": true, "population": true}
+
+func (p *parser) metric(name string) (metric, error) {
+	m := metric{name: name}
+	if _, ok := p.accept("["); !ok {
+		return m, nil
+	}
+	if name == "population" {
+		return m, p.errorf("population has no history")
+	}
+	ago, err := p.duration()
+	if err != nil {
+		return m, err
+	}
+	m.ago = ago
+	if ago > p.lookback {
+		p.lookback = ago
+	}
+	return m, p.expect("]")
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return number(v), nil
+	case tokIdent:
+		p.next()
+		if metricNames[t.text] {
+			return p.metric(t.text)
+		}
+		return p.call(t)
+	}
+	if _, ok := p.accept("("); ok {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	return nil, p.errorf("expected a number, metric or function")
+}
+
+func (p *parser) call(name token) (node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, errors.Errorf("unknown metric or function %q at %d", name.text, name.pos)
+	}
+	res := call{name: name.text}
+	switch name.text {
+	case "per_1m", "abs":
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		res.args = []node{arg}
+	case "delta", "ratio":
+		t := p.next()
+		if t.kind != tokIdent || !metricNames[t.text] || t.text == "population" {
+			return nil, errors.Errorf("%s expects cases, deaths or tests at %d", name.text, t.pos)
+		}
+		m, err := p.metric(t.text)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		ago, err := p.duration()
+		if err != nil {
+			return nil, err
+		}
+		if m.ago+ago > p.lookback {
+			p.lookback = m.ago + ago
+		}
+		res.args = []node{m, number(ago)}
+	default:
+		return nil, errors.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+	return res, p.expect(")")
+}
+
+// Parse compiles the expression.
+func Parse(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression %q", src)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected trailing input")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression %q", src)
+	}
+	return &Expr{source: src, root: root, lookback: p.lookback}, nil
+}
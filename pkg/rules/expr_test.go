@@ -0,0 +1,59 @@
+package rules
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// daily series, one datapoint per day starting June 1.
+func daily(population uint64, cases ...uint64) series {
+	res := series{}
+	for i, c := range cases {
+		res = append(res, documents.DataEntry{Name: "Italy", When: time.Date(2020, 6, 1+i, 12, 0, 0, 0, time.UTC), Cases: c, Deaths: c / 10, Population: population})
+	}
+	return res
+}
+
+func TestExpr(t *testing.T) {
+	s := daily(2000000, 100, 200, 300, 400, 500, 600, 700, 1500)
+	for _, tc := range []struct {
+		expr  string
+		value float64
+	}{
+		{"cases", 1500},
+		{"cases[1d]", 700},
+		{"cases[12h]", 700},
+		{"delta(cases, 7d)", 1400},
+		{"per_1m(delta(cases, 7d))", 700},
+		{"per_1m(delta(cases, 7d)) > 500", 1},
+		{"ratio(deaths, 2d) >= 2", 1},
+		{"deaths >= 2 * deaths[14d]", 0}, // not enough history
+		{"not deaths >= 2 * deaths[14d]", 1},
+		{"(cases - cases[1d]) / 2 + -1", 399},
+		{"cases > 1000 and population < 1000000 or tests == 0", 1},
+		{"cases / tests", math.NaN()},
+	} {
+		e, err := Parse(tc.expr)
+		require.NoError(t, err, tc.expr)
+		if math.IsNaN(tc.value) {
+			assert.True(t, math.IsNaN(e.Eval(s)), tc.expr)
+			continue
+		}
+		assert.Equal(t, tc.value, e.Eval(s), tc.expr)
+	}
+
+	e, err := Parse("per_1m(delta(cases, 7d)) > 500")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, e.Lookback())
+	assert.Equal(t, 700.0, e.Subject(s))
+
+	for _, bad := range []string{"", "cases >", "cases[7]", "population[1d]", "delta(population, 1d)", "foo(cases)", "cases = 1", "cases)", "bar"} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
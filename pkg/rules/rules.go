@@ -0,0 +1,377 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/regions"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Bucket stores rule states keyed by rule/collection/code.
+const Bucket = "Alerts"
+
+// Alert statuses.
+const (
+	Firing   = "firing"
+	Resolved = "resolved"
+)
+
+// staleSlack how much older than the lookback the newest datapoint may be and still get evaluated.
+const staleSlack = 7 * timeseries.Day
+
+type ruleConfig struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Collection  string   `yaml:"collection"`
+	Regions     []string `yaml:"regions"`
+	Names       []string `yaml:"names"`
+	When        string   `yaml:"when"`
+	Resolve     string   `yaml:"resolve"`
+	For         int      `yaml:"for"`
+	Notify      []string `yaml:"notify"`
+	Email       []string `yaml:"email"`
+}
+
+type fileConfig struct {
+	Rules []ruleConfig `yaml:"rules"`
+}
+
+// Rule fires when When holds for For evaluations in a row and resolves once Resolve holds
+// (or When no longer does, if there is no Resolve). A Resolve stricter than When gives hysteresis.
+type Rule struct {
+	Name        string
+	Description string
+	Collection  string
+	Regions     map[string]bool // region codes, empty matches all
+	Names       map[string]bool // bucket keys, empty matches all
+	When        *Expr
+	Resolve     *Expr // optional
+	For         int
+	Notify      []string // reporter, webhook or email
+	Email       []string
+}
+
+func (r Rule) lookback() time.Duration {
+	if r.Resolve != nil && r.Resolve.Lookback() > r.When.Lookback() {
+		return r.Resolve.Lookback()
+	}
+	return r.When.Lookback()
+}
+
+func toSet(values []string, normalize func(string) string) map[string]bool {
+	res := map[string]bool{}
+	for _, v := range values {
+		res[normalize(v)] = true
+	}
+	return res
+}
+
+func compile(c ruleConfig) (Rule, error) {
+	res := Rule{
+		Name:        c.Name,
+		Description: c.Description,
+		Regions:     toSet(c.Regions, regions.Code),
+		Names:       toSet(c.Names, documents.Key),
+		For:         c.For,
+		Notify:      c.Notify,
+		Email:       c.Email,
+	}
+	if c.Name == "" {
+		return res, errors.New("rule name is required")
+	}
+	var err error
+	if res.Collection, err = documents.ParseCollection(c.Collection); err != nil {
+		return res, err
+	}
+	if res.When, err = Parse(c.When); err != nil {
+		return res, err
+	}
+	if c.Resolve != "" {
+		if res.Resolve, err = Parse(c.Resolve); err != nil {
+			return res, err
+		}
+	}
+	if res.For < 1 {
+		res.For = 1
+	}
+	if len(res.Notify) == 0 {
+		res.Notify = []string{ReporterNotifier}
+	}
+	for _, n := range res.Notify {
+		if n == EmailNotifier && len(res.Email) == 0 {
+			return res, errors.New("email notifications need email recipients")
+		}
+	}
+	return res, nil
+}
+
+// ParseRules reads rules from YAML.
+func ParseRules(data []byte) ([]Rule, error) {
+	cfg := fileConfig{}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "error parsing rules")
+	}
+	res := []Rule{}
+	seen := map[string]bool{}
+	for i, c := range cfg.Rules {
+		rule, err := compile(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule #%d %s", i+1, c.Name)
+		}
+		if seen[rule.Name] {
+			return nil, errors.Errorf("duplicate rule name %s", rule.Name)
+		}
+		seen[rule.Name] = true
+		res = append(res, rule)
+	}
+	return res, nil
+}
+
+// Load reads rules from the YAML file.
+func Load(path string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading rules file %s", path)
+	}
+	return ParseRules(data)
+}
+
+// series datapoints of a single entity, oldest first.
+type series []documents.DataEntry
+
+// Value implements Series: last observation carried forward as of ago before the newest datapoint.
+func (s series) Value(metric string, ago time.Duration) float64 {
+	if len(s) == 0 {
+		return math.NaN()
+	}
+	at := s[len(s)-1].GetWhen().Add(-ago)
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].GetWhen().After(at)
+	})
+	if i == 0 {
+		return math.NaN()
+	}
+	m, err := timeseries.ParseMetric(metric)
+	if err != nil {
+		return math.NaN()
+	}
+	return m(s[i-1])
+}
+
+// Population implements Series.
+func (s series) Population() float64 {
+	if len(s) == 0 || s[len(s)-1].Population == 0 {
+		return math.NaN()
+	}
+	return float64(s[len(s)-1].Population)
+}
+
+// State of a rule for a single entity.
+type State struct {
+	Rule          string    `json:"rule"`
+	Collection    string    `json:"collection"` // lower case
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Firing        bool      `json:"firing"`
+	Pending       int       `json:"pending"` // evaluations in a row When held, while not firing yet
+	Since         time.Time `json:"since,omitempty"`
+	Value         *float64  `json:"value,omitempty"`
+	LastEvaluated time.Time `json:"last_evaluated"`
+}
+
+func (s State) key() []byte {
+	return []byte(s.Rule + "/" + s.Collection + "/" + s.Code)
+}
+
+// Alert rule that started firing or got resolved.
+type Alert struct {
+	Rule        string    `json:"rule"`
+	Description string    `json:"description,omitempty"`
+	Expr        string    `json:"expr"`
+	Status      string    `json:"status"`
+	Collection  string    `json:"collection"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Value       *float64  `json:"value,omitempty"`
+	Since       time.Time `json:"since"`
+	When        time.Time `json:"when"`
+}
+
+func (a Alert) String() string {
+	value := "unknown"
+	if a.Value != nil {
+		value = fmt.Sprintf("%.4g", *a.Value)
+	}
+	return fmt.Sprintf("[%s] %s %s/%s (%s): %s, value %s", strings.ToUpper(a.Status), a.Rule, a.Collection, a.Code, a.Name, a.Expr, value)
+}
+
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// step advances the state by one evaluation, returns the alert on transitions.
+func step(rule Rule, state *State, s series, now time.Time) *Alert {
+	holds := rule.When.True(s)
+	state.Value = finite(rule.When.Subject(s))
+	state.LastEvaluated = now.UTC()
+
+	status := ""
+	switch {
+	case !state.Firing && holds:
+		state.Pending++
+		if state.Pending >= rule.For {
+			state.Firing = true
+			state.Pending = 0
+			state.Since = now.UTC()
+			status = Firing
+		}
+	case !state.Firing:
+		state.Pending = 0
+	default:
+		resolved := !holds
+		if rule.Resolve != nil {
+			resolved = rule.Resolve.True(s)
+		}
+		if resolved {
+			state.Firing = false
+			status = Resolved
+		}
+	}
+	if status == "" {
+		return nil
+	}
+	return &Alert{
+		Rule:        rule.Name,
+		Description: rule.Description,
+		Expr:        rule.When.String(),
+		Status:      status,
+		Collection:  state.Collection,
+		Code:        state.Code,
+		Name:        state.Name,
+		Value:       state.Value,
+		Since:       state.Since,
+		When:        now.UTC(),
+	}
+}
+
+func readState(bucket *bolt.Bucket, key []byte, state *State) error {
+	if v := bucket.Get(key); v != nil {
+		if err := json.Unmarshal(v, state); err != nil {
+			return errors.Wrapf(err, "error decoding rule state %s", key)
+		}
+	}
+	return nil
+}
+
+// writeState stores the state, idle states are removed to keep the bucket small.
+func writeState(bucket *bolt.Bucket, state State) error {
+	if !state.Firing && state.Pending == 0 {
+		return bucket.Delete(state.key())
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "error encoding rule state")
+	}
+	return bucket.Put(state.key(), payload)
+}
+
+// evaluate runs the rules of the collection against the stored series and persists their states.
+func evaluate(db *bolt.DB, rules []Rule, collection string, now time.Time) ([]Alert, error) {
+	res := []Alert{}
+	active := []Rule{}
+	lookback := time.Duration(0)
+	for _, rule := range rules {
+		if rule.Collection == collection {
+			active = append(active, rule)
+			if rule.lookback() > lookback {
+				lookback = rule.lookback()
+			}
+		}
+	}
+	if len(active) == 0 {
+		return res, nil
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(Bucket))
+		if err != nil {
+			return errors.Wrapf(err, "error creating %s bucket", Bucket)
+		}
+		for _, k := range documents.ListKeys(tx, collection) {
+			if regions.IsTotal(k) {
+				continue
+			}
+			docs, err := documents.ReadSeries(tx, k, now.Add(-lookback-staleSlack), now)
+			if errors.Is(err, documents.BucketNotFoundError) {
+				// dangling index entry, no data for this country or state
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if len(docs) == 0 {
+				continue
+			}
+			last := docs[len(docs)-1]
+			for _, rule := range active {
+				if len(rule.Names) > 0 && !rule.Names[k] {
+					continue
+				}
+				if len(rule.Regions) > 0 && !rule.Regions[regions.Code(last.Region)] {
+					continue
+				}
+				state := State{Rule: rule.Name, Collection: strings.ToLower(collection), Code: k}
+				if err := readState(bucket, state.key(), &state); err != nil {
+					return err
+				}
+				state.Name = last.Name
+				if alert := step(rule, &state, series(docs), now); alert != nil {
+					res = append(res, *alert)
+				}
+				if err := writeState(bucket, state); err != nil {
+					return errors.Wrapf(err, "error saving rule state %s", state.key())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error evaluating %s rules", collection)
+	}
+	return res, nil
+}
+
+// States reads persisted rule states, the firing ones first.
+func States(db *bolt.DB) ([]State, error) {
+	res := []State{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(Bucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			state := State{}
+			if err := json.Unmarshal(v, &state); err != nil {
+				return errors.Wrapf(err, "error decoding rule state %s", k)
+			}
+			res = append(res, state)
+			return nil
+		})
+	})
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Firing && !res[j].Firing
+	})
+	return res, err
+}
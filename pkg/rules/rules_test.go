@@ -0,0 +1,115 @@
+package rules
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+rules:
+  - name: weekly_cases
+    description: 7-day new cases per 1M
+    collection: countries
+    regions: [Europe]
+    when: per_1m(delta(cases, 7d)) > 500
+    resolve: per_1m(delta(cases, 7d)) < 400
+    notify: [webhook]
+`
+
+func TestParseRules(t *testing.T) {
+	all, err := ParseRules([]byte(testRules))
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, documents.CountryCollection, all[0].Collection)
+	assert.True(t, all[0].Regions["europe"])
+	assert.Equal(t, 1, all[0].For)
+
+	for _, bad := range []string{
+		"rules:\n  - name: a\n    collection: cities\n    when: cases > 1\n",
+		"rules:\n  - name: a\n    collection: states\n    when: cases >\n",
+		"rules:\n  - name: a\n    collection: states\n    when: cases > 1\n    notify: [email]\n",
+		"rules:\n  - name: a\n    collection: states\n    when: cases > 1\n    typo: 1\n",
+		"rules:\n  - name: a\n    collection: states\n    when: cases > 1\n  - name: a\n    collection: states\n    when: cases > 2\n",
+	} {
+		_, err := ParseRules([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestEvaluateHysteresis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	all, err := ParseRules([]byte(testRules))
+	require.NoError(t, err)
+	sent := []Alert{}
+	notifiers := map[string]Notifier{WebhookNotifier: NotifierFunc(func(rule Rule, alert Alert) error {
+		sent = append(sent, alert)
+		return nil
+	})}
+	engine, err := New(db, all, notifiers)
+	require.NoError(t, err)
+	_, err = New(db, all, map[string]Notifier{})
+	assert.Error(t, err)
+
+	// an index entry without its bucket is skipped rather than failing the whole evaluation
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		master, err := tx.CreateBucketIfNotExists([]byte(documents.CountryCollection))
+		if err != nil {
+			return err
+		}
+		return master.Put([]byte("Atlantis"), []byte("atlantis"))
+	}))
+
+	// 1M people, so weekly new cases equal new cases per 1M
+	day := 0
+	cases := uint64(0)
+	scrape := func(newCases uint64) []Alert {
+		day++
+		cases += newCases
+		docs := []documents.CollectionEntry{
+			documents.DataEntry{Name: "Italy", When: time.Date(2020, 6, day, 12, 0, 0, 0, time.UTC), Cases: cases, Region: "Europe", Population: 1000000},
+			documents.DataEntry{Name: "Japan", When: time.Date(2020, 6, day, 12, 0, 0, 0, time.UTC), Cases: cases, Region: "Asia", Population: 1000000},
+		}
+		require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs, nil))
+		alerts, err := engine.Evaluate(documents.CountryCollection, time.Date(2020, 6, day, 13, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		return alerts
+	}
+	for i := 0; i < 8; i++ {
+		assert.Empty(t, scrape(50))
+	}
+	assert.Empty(t, scrape(160)) // 6*50+160 = 460 new cases over the last 7 days
+	alerts := scrape(150)        // 5*50+160+150 = 560
+	require.Len(t, alerts, 1)
+	assert.Equal(t, Firing, alerts[0].Status)
+	assert.Equal(t, "italy", alerts[0].Code)
+	assert.Equal(t, 560.0, *alerts[0].Value)
+
+	// a restarted engine picks up the persisted state and does not fire again
+	engine, err = New(db, all, notifiers)
+	require.NoError(t, err)
+	assert.Empty(t, scrape(0)) // 510
+	assert.Empty(t, scrape(0)) // 460: below when, above resolve
+	assert.Empty(t, scrape(0)) // 410
+	alerts = scrape(0)         // 360
+	require.Len(t, alerts, 1)
+	assert.Equal(t, Resolved, alerts[0].Status)
+	assert.Len(t, sent, 2)
+
+	states, err := States(db)
+	require.NoError(t, err)
+	assert.Empty(t, states)
+}
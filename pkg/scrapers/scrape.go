@@ -7,12 +7,68 @@ import (
 	"time"
 
 	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/health"
 	"github.com/mkorenkov/covid-19/pkg/httpclient"
+	"github.com/mkorenkov/covid-19/pkg/metrics"
+	"github.com/mkorenkov/covid-19/pkg/reconcile"
 	"github.com/mkorenkov/covid-19/pkg/requestcontext"
 	"github.com/mkorenkov/covid-19/worldometers"
 	"github.com/pkg/errors"
 )
 
+// scraper names used in metrics.
+const (
+	countriesScraper = "countries"
+	statesScraper    = "states"
+)
+
+// health subsystems of the scrapers.
+var subsystems = map[string]string{
+	countriesScraper: health.Countries,
+	statesScraper:    health.States,
+}
+
+// observe records scrape metrics and health and notifies webhooks of failures, err is the first error of the scrape if any.
+func observe(ctx context.Context, scraper string, start time.Time, err error) {
+	if tracker := requestcontext.Health(ctx); tracker != nil {
+		tracker.Record(subsystems[scraper], time.Now(), err)
+	}
+	metrics.ScrapeDuration.Observe(time.Since(start).Seconds(), scraper)
+	if err != nil {
+		metrics.Scrapes.Inc(scraper, metrics.Failure)
+		if dispatcher := requestcontext.Webhooks(ctx); dispatcher != nil {
+			dispatcher.ScrapeFailed(scraper, err)
+		}
+		return
+	}
+	metrics.Scrapes.Inc(scraper, metrics.Success)
+	metrics.LastSuccessfulScrape.Set(float64(time.Now().Unix()), scraper)
+}
+
+// evaluateRules runs alerting rules against the freshly scraped collection.
+func evaluateRules(ctx context.Context, collection string) {
+	engine := requestcontext.Rules(ctx)
+	if engine == nil {
+		return
+	}
+	alerts, err := engine.Evaluate(collection, time.Now())
+	if err != nil {
+		requestcontext.Errors(ctx) <- err
+	}
+	for _, alert := range alerts {
+		log.Printf("[INFO] %s\n", alert)
+	}
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Countries scrapes countries over some interval.
 func Countries(ctx context.Context, interval time.Duration, backups chan<- documents.CollectionEntry) {
 	ticker := time.NewTicker(interval)
@@ -26,10 +82,13 @@ func Countries(ctx context.Context, interval time.Duration, backups chan<- docum
 	if errorChan == nil {
 		panic(errors.New("Could not retrieve error chan from context"))
 	}
+	validator := requestcontext.Validator(ctx)
 
 	onTicker := func() {
 		log.Println("[DEBUG] Scraping countries")
+		start := time.Now()
 		rawCountries, err := worldometers.Countries(ctx, httpclient.Retryable())
+		scrapeErr := err
 		if err != nil {
 			errorChan <- errors.Wrap(err, "error scraping Countries values")
 		}
@@ -39,13 +98,29 @@ func Countries(ctx context.Context, interval time.Duration, backups chan<- docum
 				continue
 			}
 			countryDoc := documents.FromCountry(*country)
-			backups <- countryDoc
 			countryDocs = append(countryDocs, *countryDoc)
 		}
-		err = documents.BulkSave(db, documents.CountryCollection, countryDocs)
+		accepted, err := documents.BulkSaveAccepted(db, documents.CountryCollection, countryDocs, validator)
+		// rejected and quarantined datapoints are not backed up
+		for _, doc := range accepted {
+			backups <- doc
+		}
 		if err != nil {
 			errorChan <- errors.Wrapf(err, "Error while writing %s data to DB", documents.CountryCollection)
+		} else {
+			if cache := requestcontext.Latest(ctx); cache != nil {
+				if err := cache.Refresh(db, countryDocs); err != nil {
+					errorChan <- err
+				}
+			}
+			if broker := requestcontext.Stream(ctx); broker != nil {
+				if err := broker.PublishSaved(db, countryDocs); err != nil {
+					errorChan <- err
+				}
+			}
+			evaluateRules(ctx, documents.CountryCollection)
 		}
+		observe(ctx, countriesScraper, start, firstError(scrapeErr, err))
 		log.Printf("[INFO] Done scraping countries. Sleeping %s \n", interval)
 	}
 
@@ -74,10 +149,18 @@ func States(ctx context.Context, interval time.Duration, backups chan<- document
 	if errorChan == nil {
 		panic(errors.New("Could not retrieve error chan from context"))
 	}
+	rctx := requestcontext.GetRequestContext(ctx)
+	if rctx == nil {
+		panic(errors.New("Could not retrieve request context from context"))
+	}
+	validator := rctx.Validator
+	threshold := rctx.Config.ReconcileThreshold
 
 	onTicker := func() {
 		log.Println("[DEBUG] Scraping states")
+		start := time.Now()
 		rawStates, err := worldometers.States(ctx, httpclient.Retryable())
+		scrapeErr := err
 		if err != nil {
 			errorChan <- errors.Wrap(err, "error scraping United States values")
 		}
@@ -87,13 +170,32 @@ func States(ctx context.Context, interval time.Duration, backups chan<- document
 				continue
 			}
 			stateDoc := documents.FromState(*state)
-			backups <- stateDoc
 			statesDocs = append(statesDocs, *stateDoc)
 		}
-		err = documents.BulkSave(db, documents.StateCollection, statesDocs)
+		accepted, err := documents.BulkSaveAccepted(db, documents.StateCollection, statesDocs, validator)
+		// rejected and quarantined datapoints are not backed up
+		for _, doc := range accepted {
+			backups <- doc
+		}
 		if err != nil {
 			errorChan <- errors.Wrapf(err, "Error while writing %s data to DB", documents.StateCollection)
+		} else {
+			if cache := requestcontext.Latest(ctx); cache != nil {
+				if err := cache.Refresh(db, statesDocs); err != nil {
+					errorChan <- err
+				}
+			}
+			if broker := requestcontext.Stream(ctx); broker != nil {
+				if err := broker.PublishSaved(db, statesDocs); err != nil {
+					errorChan <- err
+				}
+			}
+			evaluateRules(ctx, documents.StateCollection)
+			if _, err := reconcile.Run(db, time.Now(), interval, threshold); err != nil {
+				errorChan <- err
+			}
 		}
+		observe(ctx, statesScraper, start, firstError(scrapeErr, err))
 		log.Printf("[INFO] Done scraping states. Sleeping %s \n", interval)
 	}
 
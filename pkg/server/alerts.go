@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/rules"
+	"github.com/pkg/errors"
+)
+
+// AlertRule rule as configured.
+type AlertRule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Collection  string   `json:"collection"`
+	When        string   `json:"when"`
+	Resolve     string   `json:"resolve,omitempty"`
+	For         int      `json:"for"`
+	Notify      []string `json:"notify"`
+}
+
+// AlertsResponse configured rules and their states per entity, firing ones first.
+type AlertsResponse struct {
+	Rules  []AlertRule   `json:"rules"`
+	States []rules.State `json:"states"`
+}
+
+// AlertsHandler prints alerting rules and which of them are firing. Optional firing=true leaves pending states out.
+func AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	res := AlertsResponse{Rules: []AlertRule{}, States: []rules.State{}}
+	if engine := requestcontext.Rules(r.Context()); engine != nil {
+		for _, rule := range engine.Rules() {
+			ar := AlertRule{Name: rule.Name, Description: rule.Description, Collection: rule.Collection, When: rule.When.String(), For: rule.For, Notify: rule.Notify}
+			if rule.Resolve != nil {
+				ar.Resolve = rule.Resolve.String()
+			}
+			res.Rules = append(res.Rules, ar)
+		}
+	}
+	states, err := rules.States(db)
+	if err != nil {
+		panic(err)
+	}
+	for _, s := range states {
+		if s.Firing || r.URL.Query().Get("firing") != "true" {
+			res.States = append(res.States, s)
+		}
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/analytics"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+// MetricsResponse epidemiological metrics of a single country or state.
+type MetricsResponse struct {
+	Name           string                   `json:"name"`
+	Code           string                   `json:"code"`
+	SerialInterval analytics.SerialInterval `json:"serial_interval"`
+	Window         int                      `json:"window"`
+	Latest         *analytics.Day           `json:"latest,omitempty"`
+	Data           []analytics.Day          `json:"data"`
+}
+
+func parsePositiveFloat(r *http.Request, param string, defaultValue float64) (float64, error) {
+	v := r.URL.Query().Get(param)
+	if v == "" {
+		return defaultValue, nil
+	}
+	res, err := strconv.ParseFloat(v, 64)
+	if err != nil || res <= 0 {
+		return 0, errors.Errorf("invalid %s %s, expected a positive number", param, v)
+	}
+	return res, nil
+}
+
+func metricsOptions(r *http.Request) (analytics.Options, error) {
+	res := analytics.Options{SerialInterval: analytics.DefaultSerialInterval, Window: analytics.DefaultWindow}
+	if rctx := requestcontext.GetRequestContext(r.Context()); rctx != nil {
+		if si := (analytics.SerialInterval{Mean: rctx.Config.SerialIntervalMean, SD: rctx.Config.SerialIntervalSD}); si.Valid() {
+			res.SerialInterval = si
+		}
+	}
+	var err error
+	if res.SerialInterval.Mean, err = parsePositiveFloat(r, "si_mean", res.SerialInterval.Mean); err != nil {
+		return res, err
+	}
+	if res.SerialInterval.SD, err = parsePositiveFloat(r, "si_sd", res.SerialInterval.SD); err != nil {
+		return res, err
+	}
+	if !res.SerialInterval.Valid() {
+		return res, errors.Errorf("invalid serial interval, si_mean and si_sd must be at most %g days", analytics.MaxSerialInterval)
+	}
+	window, err := parsePositiveFloat(r, "window", float64(res.Window))
+	if err != nil || window != float64(int(window)) || window > 60 {
+		return res, errors.Errorf("invalid window %s, expected whole days up to 60", r.URL.Query().Get("window"))
+	}
+	res.Window = int(window)
+	return res, nil
+}
+
+func writeMetrics(w http.ResponseWriter, r *http.Request, param string) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	name := mux.Vars(r)[param]
+	if name == "" {
+		writeError(w, http.StatusBadRequest, param+" param is required")
+		return
+	}
+	opts, err := metricsOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res := MetricsResponse{SerialInterval: opts.SerialInterval, Window: opts.Window, Data: []analytics.Day{}}
+	var docs []documents.DataEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		res.Code = documents.ResolveAlias(tx, documents.Key(name))
+		var readErr error
+		// metrics look back, so the whole series is needed regardless of the requested range
+		docs, readErr = documents.ReadSeries(tx, res.Code, time.Time{}, time.Now())
+		return readErr
+	})
+	if errors.Is(err, documents.BucketNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	res.Name = displayName(docs)
+	for _, day := range analytics.Compute(docs, opts) {
+		if day.Date.Before(from.Truncate(24*time.Hour)) || day.Date.After(to) {
+			continue
+		}
+		res.Data = append(res.Data, day)
+	}
+	if len(res.Data) > 0 {
+		res.Latest = &res.Data[len(res.Data)-1]
+	}
+	writeJSON(w, res)
+}
+
+// CountryMetricsHandler prints CFR, tests per case, positivity, doubling time and Rt of the country.
+func CountryMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	writeMetrics(w, r, "country")
+}
+
+// StateMetricsHandler prints CFR, tests per case, positivity, doubling time and Rt of the state.
+func StateMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	writeMetrics(w, r, "state")
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/analytics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryMetrics(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/countries/{country}/metrics", CountryMetricsHandler)
+
+	res := MetricsResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/countries/Ukraine/metrics?window=3&si_mean=5&from=2020-06-02", &res))
+	assert.Equal(t, "ukraine", res.Code)
+	assert.Equal(t, analytics.SerialInterval{Mean: 5, SD: analytics.DefaultSerialInterval.SD}, res.SerialInterval)
+	require.Len(t, res.Data, 4)
+	require.NotNil(t, res.Latest)
+	assert.Equal(t, uint64(500), res.Latest.Cases)
+	assert.InDelta(t, 0.01, *res.Latest.CFR, 1e-9)
+	assert.Nil(t, res.Latest.Positivity, "no tests reported")
+
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/metrics?window=2.5", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/metrics?si_sd=-1", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/metrics?si_mean=1e18", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/metrics?si_sd=31", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, rctx, r, "/api/v1/countries/Atlantis/metrics", nil))
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/auth"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+// AuthMiddleware authenticates API tokens and HTTP Basic Auth users.
+type AuthMiddleware struct {
+	users auth.Users
+}
+
+// NewAuthMiddleware creates AuthMiddleware object. Basic auth users have every scope.
+func NewAuthMiddleware(users map[string]string) *AuthMiddleware {
+	return &AuthMiddleware{
+		users: users,
+	}
+}
+
+// authenticate accepts "Authorization: Bearer <token>", or basic auth with a user password or a token as the password.
+func (a *AuthMiddleware) authenticate(r *http.Request) (auth.Principal, error) {
+	token := ""
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	} else if user, password, ok := r.BasicAuth(); ok {
+		if _, known := a.users[user]; known || !strings.HasPrefix(password, "cvd_") {
+			if !a.users.Check(user, password) {
+				return auth.Principal{}, auth.UnauthorizedError
+			}
+			return auth.Principal{Name: user, Scopes: []string{auth.ScopeAdmin}}, nil
+		}
+		token = password
+	}
+	if token == "" {
+		return auth.Principal{}, auth.UnauthorizedError
+	}
+
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	t, err := auth.Authenticate(db, token, time.Now())
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{Name: t.Name, TokenID: t.ID, Scopes: t.Scopes}, nil
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Basic realm="Restricted"`)
+	w.Header().Add("WWW-Authenticate", `Bearer realm="Restricted"`)
+	writeError(w, http.StatusUnauthorized, "missing or invalid credentials")
+}
+
+// Identify authenticates requests that carry credentials, so public routes can be rate limited per token.
+// Requests without credentials go through as they are.
+func (a *AuthMiddleware) Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := a.authenticate(r)
+		if errors.Is(err, auth.UnauthorizedError) {
+			writeUnauthorized(w)
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
+	})
+}
+
+// Require lets through requests authenticated with the scope: 401 without valid credentials, 403 without the scope.
+func (a *AuthMiddleware) Require(scope string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.authenticate(r)
+			if errors.Is(err, auth.UnauthorizedError) {
+				writeUnauthorized(w)
+				return
+			}
+			if err != nil {
+				panic(err)
+			}
+			if !auth.Allows(p.Scopes, scope) {
+				writeError(w, http.StatusForbidden, "the "+scope+" scope is required")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkorenkov/covid-19/pkg/auth"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	hash, err := auth.HashPassword("hashed-secret")
+	require.NoError(t, err)
+	a := NewAuthMiddleware(map[string]string{"admin": "secret", "ops": hash})
+	router := NewRouter(Guards{Require: a.Require, Identify: a.Identify})
+
+	call := func(method string, url string, body string, authorize func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if authorize != nil {
+			authorize(req)
+		}
+		w := httptest.NewRecorder()
+		requestcontext.InjectRequestContextMiddleware(router, rctx).ServeHTTP(w, req)
+		return w
+	}
+	basic := func(user, password string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, password) }
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	w := call("GET", "/api/internal/v1/tokens", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Len(t, w.Header()["Www-Authenticate"], 2)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/internal/v1/tokens", "", basic("admin", "wrong")).Code)
+	assert.Equal(t, http.StatusOK, call("GET", "/api/internal/v1/tokens", "", basic("admin", "secret")).Code)
+	assert.Equal(t, http.StatusOK, call("GET", "/api/internal/v1/tokens", "", basic("ops", "hashed-secret")).Code)
+
+	w = call("POST", "/api/internal/v1/tokens", `{"name":"reader","scopes":["read"],"expires_in":"24h"}`, basic("admin", "secret"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	issued := IssuedToken{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+	assert.NotEmpty(t, issued.Secret)
+	assert.NotNil(t, issued.ExpiresAt)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/api/internal/v1/tokens", `{"name":"x","scopes":["root"]}`, basic("admin", "secret")).Code)
+
+	assert.Equal(t, http.StatusOK, call("GET", "/api/internal/v1/webhooks", "", bearer(issued.Secret)).Code)
+	assert.Equal(t, http.StatusOK, call("GET", "/api/internal/v1/webhooks", "", basic("anyone", issued.Secret)).Code)
+	assert.Equal(t, http.StatusForbidden, call("GET", "/api/internal/v1/tokens", "", bearer(issued.Secret)).Code)
+	assert.Equal(t, http.StatusForbidden, call("POST", "/api/internal/v1/import/country_or_state", "{}", bearer(issued.Secret)).Code)
+
+	tokens := []auth.Token{}
+	w = call("GET", "/api/internal/v1/tokens", "", basic("admin", "secret"))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsed)
+
+	assert.Equal(t, http.StatusNoContent, call("DELETE", "/api/internal/v1/tokens/"+issued.ID, "", basic("admin", "secret")).Code)
+	assert.Equal(t, http.StatusNotFound, call("DELETE", "/api/internal/v1/tokens/"+issued.ID, "", basic("admin", "secret")).Code)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/internal/v1/webhooks", "", bearer(issued.Secret)).Code)
+}
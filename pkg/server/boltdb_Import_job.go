@@ -10,6 +10,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/mkorenkov/covid-19/pkg/documents"
 	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/stream"
 	"github.com/pkg/errors"
 )
 
@@ -33,19 +34,25 @@ func readStates(ctx context.Context, wg *sync.WaitGroup, importDB *bolt.DB, data
 	defer wg.Done()
 	err := importDB.View(func(tx *bolt.Tx) error {
 		masterCollectionBucket := tx.Bucket([]byte(documents.StateCollection))
+		if masterCollectionBucket == nil {
+			return nil
+		}
 		statesCursor := masterCollectionBucket.Cursor()
 
 		for stateBucketKey, stateBucketName := statesCursor.First(); stateBucketKey != nil; stateBucketKey, stateBucketName = statesCursor.Next() {
 			bucket := tx.Bucket([]byte(stateBucketName))
 			if bucket == nil {
-				return errors.Errorf("Bucket %s not found in import", stateBucketName)
+				// keep importing the rest, `coviddy fsck` reports and repairs broken indexes
+				errorChan <- errors.Errorf("Bucket %s not found in import, skipping", stateBucketName)
+				continue
 			}
 
 			c := bucket.Cursor()
 			for key, payload := c.First(); key != nil; key, payload = c.Next() {
 				dataEntry, parseErr := documents.Parse(payload)
 				if parseErr != nil {
-					return errors.Wrap(parseErr, "error decoding state data")
+					errorChan <- errors.Wrapf(parseErr, "error decoding state data %s/%s, skipping", stateBucketName, key)
+					continue
 				}
 				select {
 				case <-ctx.Done():
@@ -66,19 +73,25 @@ func readCountries(ctx context.Context, wg *sync.WaitGroup, importDB *bolt.DB, d
 	defer wg.Done()
 	err := importDB.View(func(tx *bolt.Tx) error {
 		masterCollectionBucket := tx.Bucket([]byte(documents.CountryCollection))
+		if masterCollectionBucket == nil {
+			return nil
+		}
 		countriesCursor := masterCollectionBucket.Cursor()
 
 		for countryBucketKey, countryBucketName := countriesCursor.First(); countryBucketKey != nil; countryBucketKey, countryBucketName = countriesCursor.Next() {
 			bucket := tx.Bucket([]byte(countryBucketName))
 			if bucket == nil {
-				return errors.Errorf("Bucket %s not found in import", countryBucketName)
+				// keep importing the rest, `coviddy fsck` reports and repairs broken indexes
+				errorChan <- errors.Errorf("Bucket %s not found in import, skipping", countryBucketName)
+				continue
 			}
 
 			c := bucket.Cursor()
 			for key, payload := c.First(); key != nil; key, payload = c.Next() {
 				dataEntry, parseErr := documents.Parse(payload)
 				if parseErr != nil {
-					return errors.Wrap(parseErr, "error decoding country data")
+					errorChan <- errors.Wrapf(parseErr, "error decoding country data %s/%s, skipping", countryBucketName, key)
+					continue
 				}
 				select {
 				case <-ctx.Done():
@@ -95,7 +108,18 @@ func readCountries(ctx context.Context, wg *sync.WaitGroup, importDB *bolt.DB, d
 	}
 }
 
-func batchImporter(ctx context.Context, wg *sync.WaitGroup, myDB *bolt.DB, importFromDB *bolt.DB, data <-chan importPayload, errorChan chan<- error) {
+// saveBatch saves an import batch and publishes what made it into the DB.
+func saveBatch(myDB *bolt.DB, validator documents.Validator, broker *stream.Broker, collection string, batch []documents.CollectionEntry) error {
+	if err := documents.BulkSave(myDB, collection, batch, validator); err != nil {
+		return err
+	}
+	if broker == nil {
+		return nil
+	}
+	return broker.PublishSaved(myDB, batch)
+}
+
+func batchImporter(ctx context.Context, wg *sync.WaitGroup, myDB *bolt.DB, validator documents.Validator, broker *stream.Broker, importFromDB *bolt.DB, data <-chan importPayload, errorChan chan<- error) {
 	defer wg.Done()
 
 	statesBatch := make([]documents.CollectionEntry, 0, batchSize)
@@ -115,7 +139,7 @@ BatcherLoop:
 			case documents.StateCollection:
 				statesBatch = append(statesBatch, payload.DataItem)
 				if len(statesBatch) >= batchSize {
-					if iErr := documents.BulkSave(myDB, documents.StateCollection, statesBatch); iErr != nil {
+					if iErr := saveBatch(myDB, validator, broker, documents.StateCollection, statesBatch); iErr != nil {
 						errorChan <- errors.Wrap(iErr, "Failed to import states")
 						return
 					}
@@ -125,7 +149,7 @@ BatcherLoop:
 			case documents.CountryCollection:
 				countriesBatch = append(countriesBatch, payload.DataItem)
 				if len(countriesBatch) >= batchSize {
-					if iErr := documents.BulkSave(myDB, documents.CountryCollection, countriesBatch); iErr != nil {
+					if iErr := saveBatch(myDB, validator, broker, documents.CountryCollection, countriesBatch); iErr != nil {
 						errorChan <- errors.Wrap(iErr, "Failed to import countries")
 						return
 					}
@@ -136,14 +160,14 @@ BatcherLoop:
 		}
 	}
 	if len(statesBatch) >= 0 {
-		if iErr := documents.BulkSave(myDB, documents.StateCollection, statesBatch); iErr != nil {
+		if iErr := saveBatch(myDB, validator, broker, documents.StateCollection, statesBatch); iErr != nil {
 			errorChan <- errors.Wrap(iErr, "Failed to import states")
 			return
 		}
 		log.Printf("[DEBUG] imported %d state entries\n", len(statesBatch))
 	}
 	if len(countriesBatch) >= 0 {
-		if iErr := documents.BulkSave(myDB, documents.CountryCollection, countriesBatch); iErr != nil {
+		if iErr := saveBatch(myDB, validator, broker, documents.CountryCollection, countriesBatch); iErr != nil {
 			errorChan <- errors.Wrap(iErr, "Failed to import countries")
 			return
 		}
@@ -173,7 +197,7 @@ func importBoltDB(ctx context.Context, rctx *requestcontext.RequestContext, impo
 	var writeWG sync.WaitGroup
 	writeWG.Add(1)
 
-	go batchImporter(ctx, &writeWG, rctx.DB, importDB, importDataChan, errorChan)
+	go batchImporter(ctx, &writeWG, rctx.DB, rctx.Validator, rctx.Stream, importDB, importDataChan, errorChan)
 
 	var readerWG sync.WaitGroup
 	readerWG.Add(2)
@@ -186,4 +210,10 @@ func importBoltDB(ctx context.Context, rctx *requestcontext.RequestContext, impo
 	close(importDataChan)
 
 	writeWG.Wait()
+
+	if rctx.Latest != nil {
+		if err := rctx.Latest.Load(rctx.DB); err != nil {
+			errorChan <- err
+		}
+	}
 }
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+// validators ETag and Last-Modified of a response. ETags are weak, compressed and plain bodies share them.
+type validators struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// dbVersion remembers when a DB transaction ID was first seen, bolt does not keep commit times.
+type dbVersion struct {
+	mu   sync.Mutex
+	txID int
+	seen time.Time
+}
+
+var currentDBVersion = &dbVersion{}
+
+// validators changes with every write transaction.
+func (v *dbVersion) validators(db *bolt.DB) (validators, error) {
+	var txID int
+	err := db.View(func(tx *bolt.Tx) error {
+		txID = tx.ID()
+		return nil
+	})
+	if err != nil {
+		return validators{}, errors.Wrap(err, "error reading DB transaction ID")
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen.IsZero() || v.txID != txID {
+		v.txID, v.seen = txID, time.Now().UTC()
+	}
+	return validators{ETag: `W/"tx-` + strconv.Itoa(txID) + `"`, LastModified: v.seen}, nil
+}
+
+// bucketVersions remembers when bucket sequences were first seen, like dbVersion does for the whole DB.
+type bucketVersions struct {
+	mu   sync.Mutex
+	seen map[string]bucketVersion
+}
+
+type bucketVersion struct {
+	sequence uint64
+	seen     time.Time
+}
+
+var currentBucketVersions = &bucketVersions{seen: map[string]bucketVersion{}}
+
+// modified time the bucket got to the sequence, as far as this process knows.
+func (v *bucketVersions) modified(code string, sequence uint64) time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if current, ok := v.seen[code]; ok && current.sequence == sequence {
+		return current.seen
+	}
+	now := time.Now().UTC()
+	v.seen[code] = bucketVersion{sequence: sequence, seen: now}
+	return now
+}
+
+// rangeValidators validators of the datapoints in the bucket between min and max keys, both inclusive:
+// a newer datapoint in the range or any write to the bucket changes them.
+func rangeValidators(bucket *bolt.Bucket, code string, min []byte, max []byte) validators {
+	c := bucket.Cursor()
+	k, _ := c.Seek(max)
+	switch {
+	case k == nil:
+		k, _ = c.Last()
+	case bytes.Compare(k, max) > 0:
+		k, _ = c.Prev()
+	}
+	if k == nil || bytes.Compare(k, min) < 0 {
+		return validators{ETag: `W/"` + code + `"`}
+	}
+	sequence := bucket.Sequence()
+	res := validators{ETag: `W/"` + code + "@" + string(k) + "#" + strconv.FormatUint(sequence, 10) + `"`}
+	if when, err := time.Parse(time.RFC3339, string(k)); err == nil {
+		res.LastModified = when.UTC()
+	}
+	if sequence > 0 {
+		if modified := currentBucketVersions.modified(code, sequence); modified.After(res.LastModified) {
+			res.LastModified = modified
+		}
+	}
+	return res
+}
+
+// cacheMaxAge time left until the next scrape: responses do not change in between.
+func cacheMaxAge(r *http.Request) time.Duration {
+	rc := requestcontext.GetRequestContext(r.Context())
+	if rc == nil || rc.Config.ScrapeInterval <= 0 {
+		return 0
+	}
+	interval := rc.Config.ScrapeInterval
+	var last time.Time
+	if rc.Health != nil {
+		for _, subsystem := range []string{health.Countries, health.States} {
+			if state, ok := rc.Health.Get(subsystem); ok {
+				for _, t := range []time.Time{state.LastSuccess, state.LastErrorAt} {
+					if t.After(last) {
+						last = t
+					}
+				}
+			}
+		}
+	}
+	if last.IsZero() {
+		return interval
+	}
+	left := time.Until(last.Add(interval))
+	switch {
+	case left < 0:
+		return 0
+	case left > interval:
+		return interval
+	}
+	return left
+}
+
+func cacheControl(r *http.Request) string {
+	maxAge := cacheMaxAge(r) / time.Second
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge))
+}
+
+// notModified conditional request check, If-None-Match wins over If-Modified-Since.
+func notModified(r *http.Request, v validators) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, etag := range strings.Split(inm, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag == "*" || strings.TrimPrefix(etag, "W/") == strings.TrimPrefix(v.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !v.LastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !v.LastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+func setValidators(w http.ResponseWriter, r *http.Request, v validators) {
+	w.Header().Set("ETag", v.ETag)
+	if !v.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", cacheControl(r))
+}
+
+// writeValidators sets caching headers, answers 304 and returns true when the client copy is fresh.
+func writeValidators(w http.ResponseWriter, r *http.Request, v validators) bool {
+	setValidators(w, r, v)
+	if notModified(r, v) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// cachingResponseWriter adds DB validators to 200 responses, unless the handler set finer ones.
+type cachingResponseWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	v           validators
+	wroteHeader bool
+}
+
+func (c *cachingResponseWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		if status == http.StatusOK && c.Header().Get("ETag") == "" {
+			setValidators(c.ResponseWriter, c.r, c.v)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cachingResponseWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// CachingMiddleware answers conditional GET requests with 304 while the DB did not change
+// and sets Cache-Control from the scrape interval.
+func CachingMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db := requestcontext.DB(r.Context())
+		if r.Method != http.MethodGet || db == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		v, err := currentDBVersion.validators(db)
+		if err != nil {
+			panic(err)
+		}
+		if notModified(r, v) {
+			writeValidators(w, r, v)
+			return
+		}
+		handler.ServeHTTP(&cachingResponseWriter{ResponseWriter: w, r: r, v: v}, r)
+	})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func request(rctx *requestcontext.RequestContext, url string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router := NewRouter(Guards{})
+	requestcontext.InjectRequestContextMiddleware(router, rctx).ServeHTTP(w, req)
+	return w
+}
+
+func TestCaching(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	rctx.Config.ScrapeInterval = time.Hour
+
+	w := request(rctx, "/api/v2/countries/ukraine", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `W/"ukraine@2020-06-05T12:00:00Z#5"`, etag, "newest key and bucket sequence")
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, lastModified)
+	assert.Equal(t, "public, max-age=3600", w.Header().Get("Cache-Control"))
+
+	w = request(rctx, "/api/v2/countries/ukraine", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	w = request(rctx, "/api/v1/countries/ukraine", map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	bounded := request(rctx, "/api/v2/countries/ukraine?to=2020-06-03", nil)
+	require.Equal(t, http.StatusOK, bounded.Code)
+	list := request(rctx, "/api/v2/countries", nil)
+	require.Equal(t, http.StatusOK, list.Code)
+	assert.Equal(t, http.StatusNotModified, request(rctx, "/api/v2/countries", map[string]string{"If-None-Match": list.Header().Get("ETag")}).Code)
+
+	// overwriting the newest datapoint changes the validators too
+	require.NoError(t, documents.Save(rctx.DB, documents.CountryCollection, documents.DataEntry{Name: "Ukraine", When: time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC), Cases: 550}))
+	w = request(rctx, "/api/v2/countries/ukraine", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `W/"ukraine@2020-06-05T12:00:00Z#6"`, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, request(rctx, "/api/v2/countries/ukraine?to=2020-06-03", map[string]string{"If-None-Match": bounded.Header().Get("ETag")}).Code)
+	etag = w.Header().Get("ETag")
+
+	require.NoError(t, documents.Save(rctx.DB, documents.CountryCollection, documents.DataEntry{Name: "Ukraine", When: time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC), Cases: 600}))
+	assert.Equal(t, http.StatusOK, request(rctx, "/api/v2/countries/ukraine", map[string]string{"If-None-Match": etag}).Code)
+	assert.Equal(t, http.StatusOK, request(rctx, "/api/v2/countries", map[string]string{"If-None-Match": list.Header().Get("ETag")}).Code)
+
+	notFound := request(rctx, "/api/v2/countries/atlantis", nil)
+	assert.Equal(t, http.StatusNotFound, notFound.Code)
+	assert.Empty(t, notFound.Header().Get("ETag"))
+}
+
+func TestCompression(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+
+	for encoding, reader := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+	} {
+		w := request(rctx, "/api/v2/countries/ukraine", map[string]string{"Accept-Encoding": encoding})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		body, err := reader(w.Body)
+		require.NoError(t, err)
+		series := SeriesV2{}
+		require.NoError(t, json.NewDecoder(body).Decode(&series))
+		assert.Len(t, series.Data, 5)
+	}
+
+	w := request(rctx, "/api/v2/countries/ukraine", nil)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Body.String(), `"name": "Ukraine"`)
+
+	w = request(rctx, "/api/v2/countries/ukraine", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": w.Header().Get("ETag")})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+
+	// errors are compressed too, so they need an explicit content type
+	w = request(rctx, "/api/v2/countries/ukraine?from=yesterday", map[string]string{"Accept-Encoding": "gzip"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	body, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	msg := map[string]string{}
+	require.NoError(t, json.NewDecoder(body).Decode(&msg))
+	assert.Contains(t, msg["message"], "yesterday")
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	for header, expected := range map[string]string{
+		"":                          "",
+		"identity":                  "",
+		"gzip, deflate, br":         "gzip",
+		"deflate":                   "deflate",
+		"gzip;q=0, deflate":         "deflate",
+		"GZIP;q=0.5":                "gzip",
+		"*":                         "gzip",
+		"*, gzip;q=0":               "deflate",
+		"br, gzip;q=0, deflate;q=0": "",
+	} {
+		assert.Equal(t, expected, acceptedEncoding(header), header)
+	}
+}
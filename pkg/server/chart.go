@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/analytics"
+	"github.com/mkorenkov/covid-19/pkg/chart"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+const (
+	dailyChart      = "daily"
+	cumulativeChart = "cumulative"
+	maxChartSeries  = 10
+)
+
+// chartParams parsed chart query params.
+type chartParams struct {
+	metricName string
+	metric     timeseries.Metric
+	kind       string // daily or cumulative
+	average    int    // rolling average window in days, 0 for none
+	from       time.Time
+	to         time.Time
+	chart      chart.Chart
+}
+
+func parseChartParams(r *http.Request) (chartParams, error) {
+	q := r.URL.Query()
+	res := chartParams{metricName: q.Get("metric"), kind: q.Get("type")}
+	if res.metricName == "" {
+		res.metricName = "cases"
+	}
+	var err error
+	if res.metric, err = timeseries.ParseMetric(res.metricName); err != nil {
+		return res, err
+	}
+	switch res.kind {
+	case "":
+		res.kind = dailyChart
+	case dailyChart, cumulativeChart:
+	default:
+		return res, errors.Errorf("invalid type %s, expected %s or %s", res.kind, dailyChart, cumulativeChart)
+	}
+	if res.average, err = parseIntParam(r, "average", 7, 0, 60); err != nil {
+		return res, err
+	}
+	if res.from, res.to, err = timeRange(r); err != nil {
+		return res, err
+	}
+	if v := q.Get("range"); v != "" {
+		length, err := timeseries.ParseStep(v)
+		if err != nil {
+			return res, errors.Errorf("invalid range %s, expected e.g. 90d", v)
+		}
+		res.from = res.to.Add(-length)
+	}
+	if res.chart.Width, err = parseIntParam(r, "width", 800, 200, 4000); err != nil {
+		return res, err
+	}
+	if res.chart.Height, err = parseIntParam(r, "height", 400, 150, 4000); err != nil {
+		return res, err
+	}
+	if res.chart.Theme, err = chart.ParseTheme(q.Get("theme")); err != nil {
+		return res, err
+	}
+	res.chart.Log = q.Get("log") == "true"
+	return res, nil
+}
+
+// series daily values of the stored datapoints within the requested range, along with the rolling average.
+// The whole series is passed in, daily increases and averages look back.
+func (p chartParams) series(docs []documents.DataEntry) ([]time.Time, []float64, []float64) {
+	dates, values := timeseries.Daily(docs, p.metric)
+	if p.kind == dailyChart {
+		values = analytics.Daily(values)
+	}
+	var average []float64
+	if p.average > 0 {
+		average = analytics.RollingAverage(values, p.average)
+	}
+	first := 0
+	for first < len(dates) && dates[first].Before(p.from.Truncate(timeseries.Day)) {
+		first++
+	}
+	last := first
+	for last < len(dates) && !dates[last].After(p.to) {
+		last++
+	}
+	if average != nil {
+		average = average[first:last]
+	}
+	return dates[first:last], values[first:last], average
+}
+
+func (p chartParams) title(names ...string) string {
+	kind := "Daily new " + p.metricName
+	if p.kind == cumulativeChart {
+		kind = "Total " + p.metricName
+	}
+	if p.average > 0 {
+		kind += ", " + strconv.Itoa(p.average) + "-day average"
+	}
+	return strings.Join(names, ", ") + ": " + kind
+}
+
+func writeChart(w http.ResponseWriter, c chart.Chart) {
+	buf := &bytes.Buffer{}
+	if err := c.Render(buf); err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		panic(err)
+	}
+}
+
+// readCharted reads whole series of the entities, resolving aliases.
+func readCharted(db *bolt.DB, keys []string, to time.Time) ([]string, map[string][]documents.DataEntry, error) {
+	resolved := make([]string, len(keys))
+	entries := map[string][]documents.DataEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		for i, k := range keys {
+			resolved[i] = documents.ResolveAlias(tx, k)
+			docs, readErr := documents.ReadSeries(tx, resolved[i], time.Time{}, to)
+			if readErr != nil {
+				return readErr
+			}
+			entries[resolved[i]] = docs
+		}
+		return nil
+	})
+	return resolved, entries, err
+}
+
+func writeEntityChart(w http.ResponseWriter, r *http.Request, param string) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	name := mux.Vars(r)[param]
+	if name == "" {
+		writeError(w, http.StatusBadRequest, param+" param is required")
+		return
+	}
+	p, err := parseChartParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	keys, entries, err := readCharted(db, []string{documents.Key(name)}, p.to)
+	if errors.Is(err, documents.BucketNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	docs := entries[keys[0]]
+	dates, values, average := p.series(docs)
+	c := p.chart
+	c.Title = p.title(displayName(docs))
+	c.Dates = dates
+	c.Series = []chart.Series{{Name: p.metricName, Values: values, Average: average, Bars: p.kind == dailyChart}}
+	writeChart(w, c)
+}
+
+// CountryChartHandler renders daily or cumulative values of the country as SVG.
+func CountryChartHandler(w http.ResponseWriter, r *http.Request) {
+	writeEntityChart(w, r, "country")
+}
+
+// StateChartHandler renders daily or cumulative values of the state as SVG.
+func StateChartHandler(w http.ResponseWriter, r *http.Request) {
+	writeEntityChart(w, r, "state")
+}
+
+// CompareChartHandler renders several countries or states on a single SVG chart.
+// Only the rolling averages are drawn when they are on, the raw values get too busy.
+func CompareChartHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	names, err := entityNames(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(names) > maxChartSeries {
+		writeError(w, http.StatusBadRequest, "too many series, at most "+strconv.Itoa(maxChartSeries)+" fit a chart")
+		return
+	}
+	p, err := parseChartParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	keys, entries, err := readCharted(db, names, p.to)
+	if errors.Is(err, documents.BucketNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	dates := make([][]time.Time, len(keys))
+	values := make([][]float64, len(keys))
+	titles := make([]string, len(keys))
+	for i, k := range keys {
+		var average []float64
+		dates[i], values[i], average = p.series(entries[k])
+		if average != nil {
+			values[i] = average
+		}
+		titles[i] = displayName(entries[k])
+	}
+	c := p.chart
+	c.Title = p.title(titles...)
+	var aligned [][]float64
+	c.Dates, aligned = chart.Align(dates, values)
+	for i := range keys {
+		c.Series = append(c.Series, chart.Series{Name: titles[i], Values: aligned[i]})
+	}
+	writeChart(w, c)
+}
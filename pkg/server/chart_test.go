@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCharts(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/countries/{country}/chart.svg", CountryChartHandler)
+	r.HandleFunc("/api/v1/compare/chart.svg", CompareChartHandler)
+
+	svg := func(url string) (int, string) {
+		w := httptest.NewRecorder()
+		requestcontext.InjectRequestContextMiddleware(r, rctx).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := svg("/api/v1/countries/Ukraine/chart.svg?average=3&from=2020-06-02&theme=dark&width=600&height=300")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, strings.HasPrefix(body, `<svg xmlns="http://www.w3.org/2000/svg" width="600" height="300"`))
+	assert.Contains(t, body, "Ukraine: Daily new cases, 3-day average")
+	assert.Contains(t, body, ">Jun 2<")
+	assert.NotContains(t, body, ">Jun 1<")
+
+	code, body = svg("/api/v1/countries/Ukraine/chart.svg?type=cumulative&metric=deaths&log=true&average=0")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Ukraine: Total deaths<")
+
+	code, body = svg("/api/v1/compare/chart.svg?countries=Ukraine,ukraine&average=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, strings.Count(body, "<path"))
+
+	for url, expected := range map[string]int{
+		"/api/v1/countries/Ukraine/chart.svg?theme=pink":  http.StatusBadRequest,
+		"/api/v1/countries/Ukraine/chart.svg?type=weekly": http.StatusBadRequest,
+		"/api/v1/countries/Ukraine/chart.svg?width=10":    http.StatusBadRequest,
+		"/api/v1/countries/Atlantis/chart.svg":            http.StatusNotFound,
+		"/api/v1/compare/chart.svg":                       http.StatusBadRequest,
+	} {
+		code, _ := svg(url)
+		assert.Equal(t, expected, code, url)
+	}
+}
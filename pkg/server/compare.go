@@ -0,0 +1,207 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+const maxGridSize = 5000
+
+// CompareSeries single row of the comparison matrix.
+type CompareSeries struct {
+	Code   string     `json:"code"`
+	Name   string     `json:"name"`
+	Start  *time.Time `json:"start,omitempty"` // aligned comparisons only: when the series reached the threshold
+	Values []*float64 `json:"values"`
+}
+
+// CompareResponse series resampled onto a shared grid. Grid holds timestamps, or step offsets for aligned comparisons.
+type CompareResponse struct {
+	Metric  string          `json:"metric"`
+	Step    string          `json:"step"`
+	Mode    timeseries.Mode `json:"mode"`
+	Align   string          `json:"align,omitempty"`
+	Grid    []time.Time     `json:"grid,omitempty"`
+	Offsets []int           `json:"offsets,omitempty"`
+	Series  []CompareSeries `json:"series"`
+}
+
+// alignment parsed align=first_n_<metric>:<threshold> param.
+type alignment struct {
+	metric    timeseries.Metric
+	threshold float64
+}
+
+func parseAlign(v string) (*alignment, error) {
+	if v == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(v, ":", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "first_n_") {
+		return nil, errors.Errorf("invalid align %s, expected e.g. first_n_cases:100", v)
+	}
+	metric, err := timeseries.ParseMetric(strings.TrimPrefix(parts[0], "first_n_"))
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || threshold <= 0 {
+		return nil, errors.Errorf("invalid align threshold %s", parts[1])
+	}
+	return &alignment{metric: metric, threshold: threshold}, nil
+}
+
+// entityNames reads comma separated countries= or states= param.
+func entityNames(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("countries")
+	if v == "" {
+		v = r.URL.Query().Get("states")
+	}
+	if v == "" {
+		return nil, errors.New("countries or states param is required")
+	}
+	res := []string{}
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, documents.Key(name))
+		}
+	}
+	return res, nil
+}
+
+// CompareHandler resamples several series onto a common time grid and returns them as a matrix.
+func CompareHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	q := r.URL.Query()
+	keys, err := entityNames(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	metricName := q.Get("metric")
+	if metricName == "" {
+		metricName = "cases"
+	}
+	metric, err := timeseries.ParseMetric(metricName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	step, err := timeseries.ParseStep(q.Get("step"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mode, err := timeseries.ParseMode(q.Get("mode"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	align, err := parseAlign(q.Get("align"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries := map[string][]documents.DataEntry{}
+	err = db.View(func(tx *bolt.Tx) error {
+		for i, k := range keys {
+			// report renamed series under their current code
+			keys[i] = documents.ResolveAlias(tx, k)
+			docs, readErr := documents.ReadSeries(tx, keys[i], from, to)
+			if readErr != nil {
+				return readErr
+			}
+			entries[keys[i]] = docs
+		}
+		return nil
+	})
+	if errors.Is(err, documents.BucketNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	res := CompareResponse{Metric: metricName, Step: step.String(), Mode: mode, Align: q.Get("align"), Series: []CompareSeries{}}
+	if align == nil {
+		start := from
+		if start.IsZero() {
+			start = earliest(entries)
+		}
+		if timeseries.GridSize(start, to, step) > maxGridSize {
+			writeError(w, http.StatusBadRequest, "too many grid points, use a larger step or a shorter range")
+			return
+		}
+		res.Grid = timeseries.Grid(start, to, step)
+		for _, k := range keys {
+			values := timeseries.Resample(timeseries.FromEntries(entries[k], metric), res.Grid, mode)
+			res.Series = append(res.Series, CompareSeries{Code: k, Name: displayName(entries[k]), Values: timeseries.Nullable(values)})
+		}
+		writeJSON(w, res)
+		return
+	}
+
+	longest := 0
+	for _, k := range keys {
+		row := CompareSeries{Code: k, Name: displayName(entries[k]), Values: []*float64{}}
+		if start, ok := timeseries.FirstReaching(timeseries.FromEntries(entries[k], align.metric), align.threshold); ok {
+			row.Start = &start
+			grid := []time.Time{}
+			for t := start; !t.After(to) && len(grid) < maxGridSize; t = t.Add(step) {
+				grid = append(grid, t)
+			}
+			values := timeseries.Resample(timeseries.FromEntries(entries[k], metric), grid, mode)
+			row.Values = timeseries.Nullable(values)
+		}
+		if len(row.Values) > longest {
+			longest = len(row.Values)
+		}
+		res.Series = append(res.Series, row)
+	}
+	res.Offsets = make([]int, longest)
+	for i := range res.Offsets {
+		res.Offsets[i] = i
+	}
+	for i := range res.Series {
+		for len(res.Series[i].Values) < longest {
+			res.Series[i].Values = append(res.Series[i].Values, nil)
+		}
+	}
+	writeJSON(w, res)
+}
+
+func earliest(entries map[string][]documents.DataEntry) time.Time {
+	res := time.Now().UTC()
+	for _, docs := range entries {
+		if len(docs) > 0 && docs[0].GetWhen().Before(res) {
+			res = docs[0].GetWhen()
+		}
+	}
+	return res
+}
+
+func displayName(docs []documents.DataEntry) string {
+	if len(docs) == 0 {
+		return ""
+	}
+	return docs[len(docs)-1].Name
+}
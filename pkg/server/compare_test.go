@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/compare", CompareHandler)
+
+	res := CompareResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/compare?countries=ukraine&from=2020-06-01&to=2020-06-04&step=1d", &res))
+	require.Len(t, res.Grid, 4)
+	require.Len(t, res.Series, 1)
+	assert.Nil(t, res.Series[0].Values[0], "no data before the first noon")
+	assert.Equal(t, 100.0, *res.Series[0].Values[1])
+	assert.Equal(t, 300.0, *res.Series[0].Values[3])
+
+	aligned := CompareResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/compare?countries=ukraine&metric=deaths&align=first_n_cases:300&to=2020-06-05", &aligned))
+	assert.Equal(t, []int{0, 1, 2}, aligned.Offsets)
+	assert.Equal(t, 3.0, *aligned.Series[0].Values[0])
+	assert.Equal(t, 5.0, *aligned.Series[0].Values[2])
+
+	_, err := documents.Rename(rctx.DB, documents.CountryCollection, "Ukraine", "Ukraina")
+	require.NoError(t, err)
+	renamed := CompareResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/compare?countries=ukraine&to=2020-06-05", &renamed))
+	require.Len(t, renamed.Series, 1)
+	assert.Equal(t, "ukraina", renamed.Series[0].Code, "the alias is resolved")
+
+	assert.Equal(t, http.StatusNotFound, get(t, rctx, r, "/api/v1/compare?countries=ukraine,atlantis", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/compare?countries=ukraine&align=first_100", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/compare?countries=ukraine&from=2000-01-01&to=2020-06-05&step=1h", nil))
+}
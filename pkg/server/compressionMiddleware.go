@@ -0,0 +1,113 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// encodings supported response encodings, most preferred first.
+var encodings = []string{"gzip", "deflate"}
+
+// acceptedEncoding picks the response encoding from Accept-Encoding, empty when the body goes as is.
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if parsed, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if name != "" {
+			accepted[name] = q > 0
+		}
+	}
+	for _, encoding := range encodings {
+		if ok, found := accepted[encoding]; ok || (!found && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressResponseWriter decides on the first write whether the response is worth compressing.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	compressor  io.WriteCloser // nil while the body goes as is
+	wroteHeader bool
+}
+
+func (c *compressResponseWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	h := c.Header()
+	compressible := status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && !strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+	if compressible {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		if c.encoding == "gzip" {
+			c.compressor = gzip.NewWriter(c.ResponseWriter)
+		} else {
+			c.compressor = zlib.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressResponseWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		if c.Header().Get("Content-Type") == "" {
+			// keep the content type sniffed from the plain body
+			c.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.compressor == nil {
+		return c.ResponseWriter.Write(p)
+	}
+	return c.compressor.Write(p)
+}
+
+// Flush lets streaming handlers flush through the compressor.
+func (c *compressResponseWriter) Flush() {
+	if flusher, ok := c.compressor.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressResponseWriter) close() error {
+	if c.compressor == nil {
+		return nil
+	}
+	return c.compressor.Close()
+}
+
+// CompressionMiddleware gzip or deflate compresses responses for clients accepting it.
+func CompressionMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		wrapper := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer wrapper.close()
+		handler.ServeHTTP(wrapper, r)
+	})
+}
@@ -3,7 +3,6 @@ package server
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -21,8 +20,10 @@ const (
 )
 
 func writeError(w http.ResponseWriter, httpStatus int, msg string) {
+	// set before WriteHeader, compressed bodies are not sniffed
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpStatus)
-	w.Write([]byte(fmt.Sprintf(`{"message": "%s"}`, msg)))
+	json.NewEncoder(w).Encode(map[string]string{"message": msg})
 }
 
 // ListCountriesHandler prints per country data.
@@ -74,12 +75,17 @@ func CountryDatapointsHandler(w http.ResponseWriter, r *http.Request) {
 		max = time.Now().Format(time.RFC3339)
 	}
 
+	fresh := false
 	err := db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(strings.ToLower(country)))
+		code := documents.ResolveAlias(tx, strings.ToLower(country))
+		bucket := tx.Bucket([]byte(code))
 		if bucket == nil {
 			writeError(w, http.StatusNotFound, "country not found")
 			return nil
 		}
+		if fresh = writeValidators(w, r, rangeValidators(bucket, code, []byte(min), []byte(max))); fresh {
+			return nil
+		}
 
 		c := bucket.Cursor()
 		for k, v := c.Seek([]byte(min)); k != nil && bytes.Compare(k, []byte(max)) <= 0; k, v = c.Next() {
@@ -94,6 +100,9 @@ func CountryDatapointsHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
+	if fresh {
+		return
+	}
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	if err = enc.Encode(res); err != nil {
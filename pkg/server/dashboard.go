@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/analytics"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultChartRange = "90d"
+	allTime           = "all"
+	recentDays        = 14
+)
+
+var chartRanges = []string{"30d", defaultChartRange, "180d", allTime}
+
+// asset static file served under /assets/.
+type asset struct {
+	contentType string
+	body        string
+}
+
+var assets = map[string]asset{
+	"dashboard.css": {contentType: "text/css; charset=utf-8", body: dashboardCSS},
+	"dashboard.js":  {contentType: "application/javascript; charset=utf-8", body: dashboardJS},
+}
+
+// formatNumber groups thousands: 1,234,567.
+func formatNumber(v uint64) string {
+	digits := strconv.FormatUint(v, 10)
+	groups := []string{}
+	for len(digits) > 3 {
+		groups = append([]string{digits[len(digits)-3:]}, groups...)
+		digits = digits[:len(digits)-3]
+	}
+	return strings.Join(append([]string{digits}, groups...), ",")
+}
+
+// formatAgo rough age of the time: just now, 5m ago, 3h ago, 2d ago.
+func formatAgo(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return strconv.Itoa(int(age/time.Minute)) + "m ago"
+	case age < 48*time.Hour:
+		return strconv.Itoa(int(age/time.Hour)) + "h ago"
+	}
+	return strconv.Itoa(int(age/(24*time.Hour))) + "d ago"
+}
+
+var dashboard = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"number": formatNumber,
+	"ago":    formatAgo,
+	"time":   func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}).Parse(dashboardTemplates))
+
+// dashboardPage fields every page has.
+type dashboardPage struct {
+	Title string
+	Now   time.Time
+}
+
+func newDashboardPage(title string) dashboardPage {
+	return dashboardPage{Title: title, Now: time.Now().UTC()}
+}
+
+// renderDashboard renders the page to a buffer first, so template errors do not end up in half written pages.
+func renderDashboard(w http.ResponseWriter, name string, page interface{}) {
+	buf := &bytes.Buffer{}
+	if err := dashboard.ExecuteTemplate(buf, name, page); err != nil {
+		panic(errors.Wrapf(err, "error rendering %s page", name))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		panic(err)
+	}
+}
+
+// AssetHandler serves dashboard CSS and JS.
+func AssetHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := assets[mux.Vars(r)["name"]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if _, err := w.Write([]byte(a.body)); err != nil {
+		panic(err)
+	}
+}
+
+type entityPage struct {
+	dashboardPage
+	Path   string
+	Code   string
+	Latest documents.DataEntry
+	Range  string
+	Ranges []string
+	Charts []string
+	Days   []analytics.Day // newest first
+}
+
+// chartURLs daily cases, daily deaths and total cases on a log scale.
+func chartURLs(path string, code string, chartRange string) []string {
+	res := []string{}
+	for _, params := range []url.Values{
+		{"metric": {"cases"}},
+		{"metric": {"deaths"}},
+		{"metric": {"cases"}, "type": {cumulativeChart}, "log": {"true"}, "average": {"0"}},
+	} {
+		if chartRange != allTime {
+			params.Set("range", chartRange)
+		}
+		res = append(res, "/api/v1/"+path+"/"+url.PathEscape(code)+"/chart.svg?"+params.Encode())
+	}
+	return res
+}
+
+func writeEntityPage(w http.ResponseWriter, r *http.Request, collection string, param string) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	page := entityPage{Path: strings.ToLower(collection), Range: r.URL.Query().Get("range"), Ranges: chartRanges}
+	if page.Range == "" {
+		page.Range = defaultChartRange
+	}
+	known := false
+	for _, v := range chartRanges {
+		known = known || v == page.Range
+	}
+	if !known {
+		http.Error(w, "invalid range "+page.Range+", expected one of "+strings.Join(chartRanges, ", "), http.StatusBadRequest)
+		return
+	}
+
+	var docs []documents.DataEntry
+	err := db.View(func(tx *bolt.Tx) error {
+		page.Code = documents.ResolveAlias(tx, documents.Key(mux.Vars(r)[param]))
+		var readErr error
+		docs, readErr = documents.ReadSeries(tx, page.Code, time.Time{}, time.Now())
+		return readErr
+	})
+	if errors.Is(err, documents.BucketNotFoundError) || (err == nil && len(docs) == 0) {
+		http.Error(w, mux.Vars(r)[param]+" not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	page.Latest = docs[len(docs)-1]
+	page.dashboardPage = newDashboardPage(page.Latest.Name)
+	page.Charts = chartURLs(page.Path, page.Code, page.Range)
+	days := analytics.Compute(docs, analytics.Options{SerialInterval: analytics.DefaultSerialInterval, Window: analytics.DefaultWindow})
+	for i := len(days) - 1; i >= 0 && len(page.Days) < recentDays; i-- {
+		page.Days = append(page.Days, days[i])
+	}
+	renderDashboard(w, "entity", page)
+}
+
+// CountryPageHandler dashboard page of a single country.
+func CountryPageHandler(w http.ResponseWriter, r *http.Request) {
+	writeEntityPage(w, r, documents.CountryCollection, "country")
+}
+
+// StatePageHandler dashboard page of a single state.
+func StatePageHandler(w http.ResponseWriter, r *http.Request) {
+	writeEntityPage(w, r, documents.StateCollection, "state")
+}
@@ -0,0 +1,154 @@
+package server
+
+// Dashboard templates and assets live in constants, so the binary is all it takes to serve them.
+
+const dashboardCSS = `
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; background: #fafafa; }
+header { background: #1f3b57; color: #fff; padding: 12px 24px; }
+header a { color: #fff; text-decoration: none; font-weight: bold; font-size: 18px; }
+header nav { display: inline; margin-left: 24px; }
+header nav a { font-weight: normal; font-size: 14px; margin-right: 16px; }
+main { padding: 16px 24px; max-width: 1200px; }
+h2 { margin-top: 28px; }
+.status { display: flex; flex-wrap: wrap; gap: 12px; }
+.card { background: #fff; border: 1px solid #ddd; border-radius: 4px; padding: 10px 14px; min-width: 220px; }
+.card .label { color: #666; font-size: 12px; text-transform: uppercase; }
+.card .value { font-size: 20px; margin-top: 4px; }
+.ok { color: #2a7d2a; }
+.fail { color: #b22222; }
+.muted { color: #777; font-size: 13px; }
+table { border-collapse: collapse; background: #fff; width: 100%; font-size: 14px; }
+th, td { border-bottom: 1px solid #eee; padding: 6px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { cursor: pointer; user-select: none; background: #f0f0f0; position: sticky; top: 0; }
+th.sorted-asc::after { content: " \25B2"; }
+th.sorted-desc::after { content: " \25BC"; }
+tr:hover td { background: #f6f9fc; }
+input.filter { padding: 6px 8px; margin-bottom: 8px; width: 240px; }
+.charts img { max-width: 100%; display: block; margin-bottom: 16px; border: 1px solid #ddd; }
+.ranges a { margin-right: 12px; }
+.ranges a.active { font-weight: bold; text-decoration: none; color: #222; }
+`
+
+// dashboardJS sorts tables by clicking headers and filters rows by name, cells sort by their data-value.
+const dashboardJS = `
+(function () {
+  function value(row, i) {
+    var cell = row.cells[i];
+    var v = cell.getAttribute("data-value");
+    return v === null ? cell.textContent.trim().toLowerCase() : parseFloat(v);
+  }
+  document.querySelectorAll("table.sortable").forEach(function (table) {
+    var headers = table.tHead.rows[0].cells;
+    Array.prototype.forEach.call(headers, function (th, i) {
+      th.addEventListener("click", function () {
+        var desc = !th.classList.contains("sorted-desc");
+        Array.prototype.forEach.call(headers, function (h) { h.classList.remove("sorted-asc", "sorted-desc"); });
+        th.classList.add(desc ? "sorted-desc" : "sorted-asc");
+        var body = table.tBodies[0];
+        var rows = Array.prototype.slice.call(body.rows);
+        rows.sort(function (a, b) {
+          var x = value(a, i), y = value(b, i);
+          if (x === y) { return 0; }
+          return (x < y ? -1 : 1) * (desc ? -1 : 1);
+        });
+        rows.forEach(function (r) { body.appendChild(r); });
+      });
+    });
+  });
+  document.querySelectorAll("input.filter").forEach(function (input) {
+    var table = document.getElementById(input.getAttribute("data-table"));
+    input.addEventListener("input", function () {
+      var q = input.value.trim().toLowerCase();
+      Array.prototype.forEach.call(table.tBodies[0].rows, function (r) {
+        r.style.display = r.cells[0].textContent.toLowerCase().indexOf(q) >= 0 ? "" : "none";
+      });
+    });
+  });
+})();
+`
+
+const dashboardTemplates = `
+{{ define "header" }}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }} - coviddy</title>
+<link rel="stylesheet" href="/assets/dashboard.css">
+</head>
+<body>
+<header><a href="/">coviddy</a><nav><a href="/#countries">Countries</a><a href="/#states">States</a><a href="/api/v1/alerts">Alerts</a></nav></header>
+<main>
+{{ end }}
+
+{{ define "footer" }}
+<p class="muted">Rendered at {{ time .Now }}.</p>
+</main>
+<script src="/assets/dashboard.js"></script>
+</body>
+</html>
+{{ end }}
+
+{{ define "home" }}{{ template "header" . }}
+<h2>Scrapers</h2>
+<div class="status">
+{{- range .Scrapers }}
+<div class="card">
+  <div class="label">{{ .Name }}</div>
+  {{ if .OK }}<div class="value ok">OK</div>{{ else }}<div class="value fail">{{ if .LastSuccess.IsZero }}No data yet{{ else }}Failing{{ end }}</div>{{ end }}
+  <div class="muted">Last success: {{ if .LastSuccess.IsZero }}never{{ else }}{{ ago .LastSuccess }} ({{ time .LastSuccess }}){{ end }}</div>
+  {{ if .LastError }}<div class="muted">Last error {{ ago .LastErrorAt }}: {{ .LastError }}</div>{{ end }}
+</div>
+{{- end }}
+{{- range .Tables }}
+<div class="card">
+  <div class="label">{{ .Title }} updated</div>
+  <div class="value">{{ if .UpdatedAt.IsZero }}never{{ else }}{{ ago .UpdatedAt }}{{ end }}</div>
+  <div class="muted">{{ len .Rows }} tracked{{ if not .UpdatedAt.IsZero }}, {{ time .UpdatedAt }}{{ end }}</div>
+</div>
+{{- end }}
+</div>
+{{ range .Tables }}
+<h2 id="{{ .ID }}">{{ .Title }}</h2>
+<input class="filter" type="search" placeholder="Filter {{ .ID }}" data-table="{{ .ID }}-table">
+<table class="sortable" id="{{ .ID }}-table">
+<thead><tr><th>Name</th><th class="sorted-desc">Cases</th><th>Deaths</th><th>Tests</th><th>Updated</th></tr></thead>
+<tbody>
+{{- $path := .Path }}
+{{- range .Rows }}
+<tr><td><a href="/{{ $path }}/{{ .Key }}">{{ .Name }}</a></td><td data-value="{{ .Cases }}">{{ number .Cases }}</td><td data-value="{{ .Deaths }}">{{ number .Deaths }}</td><td data-value="{{ .Tests }}">{{ number .Tests }}</td><td data-value="{{ .When.Unix }}">{{ ago .When }}</td></tr>
+{{- end }}
+</tbody>
+</table>
+{{ end }}
+{{ template "footer" . }}{{ end }}
+
+{{ define "entity" }}{{ template "header" . }}
+<h1>{{ .Title }}</h1>
+<div class="status">
+  <div class="card"><div class="label">Cases</div><div class="value">{{ number .Latest.Cases }}</div></div>
+  <div class="card"><div class="label">Deaths</div><div class="value">{{ number .Latest.Deaths }}</div></div>
+  <div class="card"><div class="label">Tests</div><div class="value">{{ number .Latest.Tests }}</div></div>
+  {{ if .Latest.Population }}<div class="card"><div class="label">Population</div><div class="value">{{ number .Latest.Population }}</div></div>{{ end }}
+  <div class="card"><div class="label">Updated</div><div class="value">{{ ago .Latest.When }}</div><div class="muted">{{ time .Latest.When }}</div></div>
+</div>
+<h2>Charts</h2>
+<p class="ranges">{{ $range := .Range }}{{ range .Ranges }}<a href="?range={{ . }}"{{ if eq . $range }} class="active"{{ end }}>{{ . }}</a>{{ end }}</p>
+<div class="charts">
+{{- range .Charts }}
+<img src="{{ . }}" alt="chart" loading="lazy">
+{{- end }}
+</div>
+<h2>Recent days</h2>
+<table class="sortable">
+<thead><tr><th>Date</th><th>New cases</th><th>New deaths</th><th>New tests</th><th>Cases</th><th>Deaths</th></tr></thead>
+<tbody>
+{{- range .Days }}
+<tr><td>{{ .Date.Format "2006-01-02" }}</td><td data-value="{{ .NewCases }}">{{ number .NewCases }}</td><td data-value="{{ .NewDeaths }}">{{ number .NewDeaths }}</td><td data-value="{{ .NewTests }}">{{ number .NewTests }}</td><td data-value="{{ .Cases }}">{{ number .Cases }}</td><td data-value="{{ .Deaths }}">{{ number .Deaths }}</td></tr>
+{{- end }}
+</tbody>
+</table>
+<p class="muted">JSON: <a href="/api/v1/{{ .Path }}/{{ .Code }}">datapoints</a>, <a href="/api/v1/{{ .Path }}/{{ .Code }}/metrics">metrics</a>.</p>
+{{ template "footer" . }}{{ end }}
+`
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	rctx.Health = health.NewTracker()
+	rctx.Health.Record(health.Countries, time.Now(), nil)
+	r := mux.NewRouter()
+	r.HandleFunc("/", HomeHandler)
+	r.HandleFunc("/assets/{name}", AssetHandler)
+	r.HandleFunc("/countries/{country}", CountryPageHandler)
+
+	page := func(url string) (int, string) {
+		w := httptest.NewRecorder()
+		requestcontext.InjectRequestContextMiddleware(r, rctx).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := page("/")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<a href="/countries/ukraine">Ukraine</a>`)
+	assert.Contains(t, body, `<td data-value="500">500</td>`)
+	assert.Contains(t, body, `<div class="value ok">OK</div>`)
+	assert.Contains(t, body, "No data yet") // states scraper never ran
+	assert.NotContains(t, body, "://", "no external assets")
+
+	code, body = page("/countries/Ukraine?range=30d")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<h1>Ukraine</h1>")
+	assert.Contains(t, body, `<img src="/api/v1/countries/ukraine/chart.svg?metric=deaths&amp;range=30d"`)
+	assert.Contains(t, body, "<td>2020-06-05</td>")
+
+	code, _ = page("/countries/Ukraine?range=7y")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = page("/countries/Atlantis")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = page("/assets/dashboard.js")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "sortable")
+	code, _ = page("/assets/missing.js")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	assert.Equal(t, "1,234,567", formatNumber(1234567))
+	assert.Equal(t, "999", formatNumber(999))
+}
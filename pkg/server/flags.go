@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/validation"
+	"github.com/pkg/errors"
+)
+
+func writeFlags(w http.ResponseWriter, r *http.Request, param string) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	name := mux.Vars(r)[param]
+	if name == "" {
+		writeError(w, http.StatusBadRequest, param+" param is required")
+		return
+	}
+
+	res, err := validation.Flags(db, strings.ToLower(name))
+	if err != nil {
+		panic(err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(res); err != nil {
+		panic(err)
+	}
+}
+
+// CountryFlagsHandler prints validation flags raised for country datapoints.
+func CountryFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	writeFlags(w, r, "country")
+}
+
+// StateFlagsHandler prints validation flags raised for state datapoints.
+func StateFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	writeFlags(w, r, "state")
+}
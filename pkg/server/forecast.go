@@ -0,0 +1,185 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/forecast"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultForecastDays   = 14
+	defaultForecastWindow = 21
+	defaultBacktestDays   = 30
+	maxForecastDays       = 60
+	maxForecastWindow     = 365
+	// every backtest origin refits all the models, keep a single request cheap on this public route
+	maxBacktestWindow  = 60
+	maxBacktestOrigins = 60
+)
+
+// ForecastPoint projected cumulative value of a single day.
+type ForecastPoint struct {
+	Date time.Time `json:"date"`
+	forecast.Prediction
+}
+
+// ModelForecast projections of a single model, or its backtest errors.
+type ModelForecast struct {
+	Model        string           `json:"model"`
+	Cases        []ForecastPoint  `json:"cases,omitempty"`
+	Deaths       []ForecastPoint  `json:"deaths,omitempty"`
+	CasesErrors  *forecast.Errors `json:"cases_errors,omitempty"`
+	DeathsErrors *forecast.Errors `json:"deaths_errors,omitempty"`
+	Error        string           `json:"error,omitempty"` // the model could not be fit
+}
+
+// ForecastResponse projected cumulative cases and deaths of a single country.
+type ForecastResponse struct {
+	Name     string          `json:"name"`
+	Code     string          `json:"code"`
+	Days     int             `json:"days"`
+	Window   int             `json:"window"`
+	Backtest bool            `json:"backtest"`
+	Origins  int             `json:"origins,omitempty"`
+	LastDate time.Time       `json:"last_date"`
+	Models   []ModelForecast `json:"models"`
+}
+
+func parseIntParam(r *http.Request, param string, defaultValue int, min int, max int) (int, error) {
+	v := r.URL.Query().Get(param)
+	if v == "" {
+		return defaultValue, nil
+	}
+	res, err := strconv.Atoi(v)
+	if err != nil || res < min || res > max {
+		return 0, errors.Errorf("invalid %s %s, expected a number from %d to %d", param, v, min, max)
+	}
+	return res, nil
+}
+
+func forecastPoints(lastDate time.Time, predictions []forecast.Prediction) []ForecastPoint {
+	res := make([]ForecastPoint, len(predictions))
+	for i := range predictions {
+		res[i] = ForecastPoint{Date: lastDate.AddDate(0, 0, i+1), Prediction: predictions[i]}
+	}
+	return res
+}
+
+func runModel(res *ForecastResponse, name string, cases []float64, deaths []float64) ModelForecast {
+	model := forecast.Models[name]
+	row := ModelForecast{Model: name}
+	if res.Backtest {
+		casesErrors, err := forecast.Backtest(model, cases, res.Window, res.Days, res.Origins)
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		deathsErrors, err := forecast.Backtest(model, deaths, res.Window, res.Days, res.Origins)
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		row.CasesErrors, row.DeathsErrors = &casesErrors, &deathsErrors
+		return row
+	}
+
+	if len(cases) > res.Window {
+		cases, deaths = cases[len(cases)-res.Window:], deaths[len(deaths)-res.Window:]
+	}
+	casesForecast, err := model(cases, res.Days)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	deathsForecast, err := model(deaths, res.Days)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Cases = forecastPoints(res.LastDate, casesForecast)
+	row.Deaths = forecastPoints(res.LastDate, deathsForecast)
+	return row
+}
+
+func writeForecast(w http.ResponseWriter, r *http.Request, param string) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	name := mux.Vars(r)[param]
+	if name == "" {
+		writeError(w, http.StatusBadRequest, param+" param is required")
+		return
+	}
+	q := r.URL.Query()
+	res := ForecastResponse{Backtest: q.Get("backtest") == "true", Models: []ModelForecast{}}
+	var err error
+	if res.Days, err = parseIntParam(r, "days", defaultForecastDays, 1, maxForecastDays); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	maxWindow := maxForecastWindow
+	if res.Backtest {
+		maxWindow = maxBacktestWindow
+	}
+	if res.Window, err = parseIntParam(r, "window", defaultForecastWindow, 5, maxWindow); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if res.Backtest {
+		if res.Origins, err = parseIntParam(r, "origins", defaultBacktestDays, 1, maxBacktestOrigins); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	models := forecast.ModelNames()
+	if v := q.Get("model"); v != "" {
+		if _, ok := forecast.Models[v]; !ok {
+			writeError(w, http.StatusBadRequest, "unknown model "+v)
+			return
+		}
+		models = []string{v}
+	}
+
+	var docs []documents.DataEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		res.Code = documents.ResolveAlias(tx, documents.Key(name))
+		var readErr error
+		docs, readErr = documents.ReadSeries(tx, res.Code, time.Time{}, time.Now())
+		return readErr
+	})
+	if errors.Is(err, documents.BucketNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	res.Name = displayName(docs)
+	dates, cases := timeseries.Daily(docs, func(d documents.DataEntry) float64 { return float64(d.Cases) })
+	_, deaths := timeseries.Daily(docs, func(d documents.DataEntry) float64 { return float64(d.Deaths) })
+	if len(dates) == 0 {
+		writeError(w, http.StatusNotFound, "no datapoints to forecast from")
+		return
+	}
+	res.LastDate = dates[len(dates)-1]
+	for _, model := range models {
+		res.Models = append(res.Models, runModel(&res, model, cases, deaths))
+	}
+	writeJSON(w, res)
+}
+
+// CountryForecastHandler projects cumulative cases and deaths of the country, or backtests the models with backtest=true.
+func CountryForecastHandler(w http.ResponseWriter, r *http.Request) {
+	writeForecast(w, r, "country")
+}
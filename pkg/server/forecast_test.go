@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryForecast(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/countries/{country}/forecast", CountryForecastHandler)
+
+	res := ForecastResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?days=3&window=5&model=holt", &res))
+	assert.Equal(t, time.Date(2020, 6, 5, 0, 0, 0, 0, time.UTC), res.LastDate)
+	require.Len(t, res.Models, 1)
+	holt := res.Models[0]
+	assert.Empty(t, holt.Error)
+	require.Len(t, holt.Cases, 3)
+	assert.Equal(t, time.Date(2020, 6, 6, 0, 0, 0, 0, time.UTC), holt.Cases[0].Date)
+	assert.InDelta(t, 600, holt.Cases[0].Value, 1e-6)
+	assert.InDelta(t, 8, holt.Deaths[2].Value, 1e-6)
+
+	backtest := ForecastResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?backtest=true&window=5", &backtest))
+	require.Len(t, backtest.Models, 3)
+	assert.NotEmpty(t, backtest.Models[0].Error, "5 days are not enough to backtest")
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?backtest=true&origins=365", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?backtest=true&window=365", nil))
+	assert.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?window=365", nil))
+
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?days=1000", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/countries/Ukraine/forecast?model=arima", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, rctx, r, "/api/v1/countries/Atlantis/forecast", nil))
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+var started = time.Now()
+
+// check status of a single subsystem.
+type check struct {
+	Status      string     `json:"status"`
+	Message     string     `json:"message,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+func (c *check) fail(format string, args ...interface{}) {
+	c.Status = statusFail
+	c.Message = fmt.Sprintf(format, args...)
+}
+
+// trackedCheck fills the check with the last outcome recorded for the subsystem.
+func trackedCheck(tracker *health.Tracker, subsystem string) check {
+	res := check{Status: statusOK}
+	if tracker == nil {
+		return res
+	}
+	state, ok := tracker.Get(subsystem)
+	if !ok {
+		return res
+	}
+	if !state.LastSuccess.IsZero() {
+		res.LastSuccess = &state.LastSuccess
+	}
+	if !state.LastErrorAt.IsZero() {
+		res.LastError = state.LastError
+		res.LastErrorAt = &state.LastErrorAt
+	}
+	return res
+}
+
+type healthResponse struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks"`
+}
+
+// writeHealth answers 200 when all checks pass, 503 otherwise.
+func writeHealth(w http.ResponseWriter, checks map[string]check) {
+	res := healthResponse{Status: statusOK, Checks: checks}
+	for _, c := range checks {
+		if c.Status != statusOK {
+			res.Status = statusFail
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if res.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		panic(errors.Wrap(err, "error encoding health response"))
+	}
+}
+
+// HealthzHandler tells whether the process is alive and the DB is readable.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	rctx := requestcontext.GetRequestContext(r.Context())
+	if rctx == nil {
+		panic(errors.New("Could not retrieve request context"))
+	}
+	process := check{Status: statusOK, Message: fmt.Sprintf("up %s", time.Since(started).Round(time.Second))}
+	db := check{Status: statusOK}
+	err := rctx.DB.View(func(tx *bolt.Tx) error {
+		tx.Cursor().First()
+		return nil
+	})
+	if err != nil {
+		db.fail("DB is not readable")
+		now := time.Now()
+		db.LastError = err.Error()
+		db.LastErrorAt = &now
+	}
+	writeHealth(w, map[string]check{"process": process, "db": db})
+}
+
+// ReadyzHandler tells whether the daemon serves fresh data: the scrapers succeeded recently and backups keep up.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	rctx := requestcontext.GetRequestContext(r.Context())
+	if rctx == nil {
+		panic(errors.New("Could not retrieve request context"))
+	}
+	checks := map[string]check{}
+	maxAge := time.Duration(rctx.Config.ReadyScrapeIntervals * float64(rctx.Config.ScrapeInterval))
+	for _, subsystem := range []string{health.Countries, health.States} {
+		c := trackedCheck(rctx.Health, subsystem)
+		switch {
+		case c.LastSuccess == nil:
+			c.fail("no successful scrape yet")
+		case time.Since(*c.LastSuccess) > maxAge:
+			c.fail("last successful scrape is older than %s", maxAge)
+		}
+		checks[subsystem] = c
+	}
+
+	backup := trackedCheck(rctx.Health, health.Backup)
+	if queue := rctx.UploadS3; queue != nil && cap(queue) > 0 {
+		if ratio := float64(len(queue)) / float64(cap(queue)); ratio >= rctx.Config.ReadyBackupQueueRatio {
+			backup.fail("upload queue is %d/%d full", len(queue), cap(queue))
+		}
+	}
+	checks[health.Backup] = backup
+	writeHealth(w, checks)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getHealth(t *testing.T, rctx *requestcontext.RequestContext, handler http.HandlerFunc) (int, healthResponse) {
+	r := mux.NewRouter()
+	r.HandleFunc("/", handler)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	requestcontext.InjectRequestContextMiddleware(r, rctx).ServeHTTP(w, req)
+	res := healthResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return w.Code, res
+}
+
+func TestHealthz(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+
+	code, res := getHealth(t, rctx, HealthzHandler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, statusOK, res.Checks["db"].Status)
+
+	require.NoError(t, rctx.DB.Close())
+	code, res = getHealth(t, rctx, HealthzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, statusFail, res.Status)
+	assert.Equal(t, statusOK, res.Checks["process"].Status)
+	assert.Equal(t, statusFail, res.Checks["db"].Status)
+	assert.NotEmpty(t, res.Checks["db"].LastError)
+}
+
+func TestReadyz(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	rctx.Config.ScrapeInterval = time.Hour
+	rctx.Config.ReadyScrapeIntervals = 3
+	rctx.Config.ReadyBackupQueueRatio = 0.5
+	rctx.Health = health.NewTracker()
+
+	code, res := getHealth(t, rctx, ReadyzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "no successful scrape yet", res.Checks[health.Countries].Message)
+
+	now := time.Now()
+	rctx.Health.Record(health.Countries, now.Add(-time.Hour), nil)
+	rctx.Health.Record(health.Countries, now, errors.New("worldometers is down"))
+	rctx.Health.Record(health.States, now, nil)
+	code, res = getHealth(t, rctx, ReadyzHandler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "worldometers is down", res.Checks[health.Countries].LastError)
+
+	rctx.Health = health.NewTracker()
+	rctx.Health.Record(health.Countries, now, nil)
+	rctx.Health.Record(health.States, now.Add(-4*time.Hour), nil)
+	code, res = getHealth(t, rctx, ReadyzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, statusOK, res.Checks[health.Countries].Status)
+	assert.Equal(t, statusFail, res.Checks[health.States].Status)
+
+	rctx.Health.Record(health.States, now, nil)
+	for i := 0; i < 5; i++ {
+		rctx.UploadS3 <- documents.DataEntry{Name: "Ukraine"}
+	}
+	code, res = getHealth(t, rctx, ReadyzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "upload queue is 5/10 full", res.Checks[health.Backup].Message)
+}
@@ -1,11 +1,72 @@
 package server
 
 import (
-	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/health"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
 )
 
-//HomeHandler handles /.
+// scraperStatus dashboard card of a single scraper.
+type scraperStatus struct {
+	Name        string
+	OK          bool // the last run succeeded
+	LastSuccess time.Time
+	LastError   string
+	LastErrorAt time.Time
+}
+
+// latestTable dashboard table of a collection.
+type latestTable struct {
+	Title     string
+	ID        string
+	Path      string // collection path segment, e.g. countries
+	UpdatedAt time.Time
+	Rows      []latest.Entry
+}
+
+type homePage struct {
+	dashboardPage
+	Scrapers []scraperStatus
+	Tables   []latestTable
+}
+
+func scraperStatuses(tracker *health.Tracker) []scraperStatus {
+	res := []scraperStatus{}
+	for _, s := range []struct{ subsystem, name string }{{health.Countries, "Countries scraper"}, {health.States, "States scraper"}} {
+		status := scraperStatus{Name: s.name}
+		if tracker != nil {
+			if state, ok := tracker.Get(s.subsystem); ok {
+				status.LastSuccess, status.LastError, status.LastErrorAt = state.LastSuccess, state.LastError, state.LastErrorAt
+				status.OK = !state.LastSuccess.IsZero() && !state.LastErrorAt.After(state.LastSuccess)
+			}
+		}
+		res = append(res, status)
+	}
+	return res
+}
+
+// HomeHandler handles /: scraper status and sortable tables of the newest values.
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "")
+	cache := requestcontext.Latest(r.Context())
+	if cache == nil {
+		panic(errors.New("Could not retrieve latest values cache from context"))
+	}
+
+	page := homePage{dashboardPage: newDashboardPage("Dashboard"), Scrapers: scraperStatuses(requestcontext.Health(r.Context()))}
+	for _, collection := range []string{documents.CountryCollection, documents.StateCollection} {
+		table := latestTable{Title: collection, ID: strings.ToLower(collection), Path: strings.ToLower(collection), Rows: cache.Get(collection)}
+		for _, row := range table.Rows {
+			if row.GetWhen().After(table.UpdatedAt) {
+				table.UpdatedAt = row.GetWhen()
+			}
+		}
+		page.Tables = append(page.Tables, table)
+	}
+	renderDashboard(w, "home", page)
 }
@@ -31,9 +31,28 @@ func UpsertAnythingHandler(w http.ResponseWriter, r *http.Request) {
 	if s3Chan == nil {
 		panic(errors.New("Could not backup chan from context"))
 	}
-	s3Chan <- dataEntry
-	if err := documents.FindBucketAndSave(db, dataEntry); err != nil {
+	verdict, err := documents.FindBucketAndSave(db, dataEntry, requestcontext.Validator(r.Context()))
+	if err != nil {
 		panic(err)
 	}
-	w.WriteHeader(http.StatusCreated)
+	switch verdict {
+	case documents.Rejected:
+		writeError(w, http.StatusUnprocessableEntity, "datapoint rejected by validation, see flags")
+	case documents.Quarantined:
+		writeError(w, http.StatusAccepted, "datapoint quarantined by validation, see flags")
+	default:
+		// rejected and quarantined datapoints are not backed up
+		s3Chan <- dataEntry
+		if cache := requestcontext.Latest(r.Context()); cache != nil {
+			if err := cache.Refresh(db, []documents.CollectionEntry{dataEntry}); err != nil {
+				panic(err)
+			}
+		}
+		if broker := requestcontext.Stream(r.Context()); broker != nil {
+			if err := broker.PublishSaved(db, []documents.CollectionEntry{dataEntry}); err != nil {
+				panic(err)
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
 }
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+func writeLatest(w http.ResponseWriter, r *http.Request, collection string) {
+	cache := requestcontext.Latest(r.Context())
+	if cache == nil {
+		panic(errors.New("Could not retrieve latest values cache from context"))
+	}
+	writeJSON(w, cache.Get(collection))
+}
+
+// LatestCountriesHandler prints the newest datapoint per country, most cases first.
+func LatestCountriesHandler(w http.ResponseWriter, r *http.Request) {
+	writeLatest(w, r, documents.CountryCollection)
+}
+
+// LatestStatesHandler prints the newest datapoint per state, most cases first.
+func LatestStatesHandler(w http.ResponseWriter, r *http.Request) {
+	writeLatest(w, r, documents.StateCollection)
+}
@@ -3,8 +3,12 @@ package server
 import (
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/metrics"
 )
 
 type logResponseWrapper struct {
@@ -12,6 +16,7 @@ type logResponseWrapper struct {
 
 	status        int
 	responseBytes int64
+	route         string // path template of the matched route, set by RouteMiddleware
 }
 
 func (r *logResponseWrapper) Write(p []byte) (int, error) {
@@ -25,6 +30,13 @@ func (r *logResponseWrapper) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Flush lets streaming handlers flush through the wrapper.
+func (r *logResponseWrapper) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 //LogMiddleware simple log middleware
 func LogMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,5 +52,35 @@ func LogMiddleware(handler http.Handler) http.Handler {
 		elapsedTime := finishTime.Sub(startTime)
 
 		log.Printf("[INFO] %s %s %s %d (%d bytes in %.4fms) by %s agent %s", r.Method, r.URL, r.Proto, wrapper.status, wrapper.responseBytes, elapsedTime.Seconds()*1000, clientIP, r.UserAgent())
+
+		route := wrapper.route
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+		metrics.HTTPRequests.Inc(route, method, strconv.Itoa(wrapper.status))
+		metrics.HTTPDuration.Observe(elapsedTime.Seconds(), route, method)
+	})
+}
+
+// methodLabel keeps the method label bounded: anything outside the standard methods is "other".
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// RouteMiddleware remembers the matched route for LogMiddleware, so metrics are per route rather than per URL.
+func RouteMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapper, ok := w.(*logResponseWrapper); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				wrapper.route, _ = route.GetPathTemplate()
+			}
+		}
+		handler.ServeHTTP(w, r)
 	})
 }
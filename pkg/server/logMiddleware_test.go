@@ -0,0 +1,15 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodLabel(t *testing.T) {
+	assert.Equal(t, http.MethodGet, methodLabel("GET"))
+	assert.Equal(t, http.MethodOptions, methodLabel("OPTIONS"))
+	assert.Equal(t, "other", methodLabel("PROPFIND"))
+	assert.Equal(t, "other", methodLabel("get"))
+}
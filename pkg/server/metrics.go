@@ -0,0 +1,15 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mkorenkov/covid-19/pkg/metrics"
+)
+
+// MetricsHandler prints daemon metrics in the Prometheus text exposition format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Default.Write(w); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mkorenkov/covid-19/pkg/auth"
+)
+
+// object JSON object of the OpenAPI document.
+type object = map[string]interface{}
+
+func schemaRef(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items object) object {
+	return object{"type": "array", "items": items}
+}
+
+func typed(typ string) object {
+	return object{"type": typ}
+}
+
+func content(contentType string, schema object) object {
+	return object{contentType: object{"schema": schema}}
+}
+
+func jsonContent(schema object) object {
+	return content("application/json", schema)
+}
+
+func respond(description string, body object) object {
+	res := object{"description": description}
+	if body != nil {
+		res["content"] = body
+	}
+	return res
+}
+
+func query(name string, typ string, description string) object {
+	return object{"name": name, "in": "query", "description": description, "schema": typed(typ)}
+}
+
+func pathParam(name string, description string) object {
+	return object{"name": name, "in": "path", "required": true, "description": description, "schema": typed("string")}
+}
+
+var (
+	countryParam = pathParam("country", "country name or code, e.g. ukraine")
+	stateParam   = pathParam("state", "state name or code, e.g. new_york")
+	fromQuery    = query(fromParam, "string", "RFC3339 time or YYYY-MM-DD date, inclusive")
+	toQuery      = query(toParam, "string", "RFC3339 time or YYYY-MM-DD date (end of day), inclusive; defaults to now")
+	stepQuery    = query("step", "string", "grid step, e.g. 1d or 12h; defaults to 1d")
+	namesQueries = []object{
+		query("countries", "string", "comma separated country names or codes"),
+		query("states", "string", "comma separated state names or codes, used when countries is not set"),
+	}
+	chartQueries = []object{
+		query("metric", "string", "cases (default), deaths or tests"),
+		query("type", "string", "daily (default) or cumulative"),
+		query("average", "integer", "rolling average window in days, default 7, 0 turns it off"),
+		query("range", "string", "e.g. 90d, overrides from"),
+		fromQuery,
+		toQuery,
+		query("log", "boolean", "log scale"),
+		query("width", "integer", "pixels, default 800"),
+		query("height", "integer", "pixels, default 400"),
+		query("theme", "string", "light (default) or dark"),
+	}
+
+	badRequest   = respond("invalid params", jsonContent(schemaRef("Error")))
+	notFound     = respond("not found", jsonContent(schemaRef("Error")))
+	unauthorized = respond("missing or invalid credentials", jsonContent(schemaRef("Error")))
+	forbidden    = respond("the credentials lack the scope", jsonContent(schemaRef("Error")))
+	rateLimited  = respond("rate limit exceeded, retry after Retry-After seconds", jsonContent(schemaRef("Error")))
+)
+
+func okJSON(schema object) object {
+	return respond("OK", jsonContent(schema))
+}
+
+func with(params ...[]object) []object {
+	res := []object{}
+	for _, p := range params {
+		res = append(res, p...)
+	}
+	return res
+}
+
+// endpoint single operation of the API.
+type endpoint struct {
+	method    string
+	path      string
+	tag       string
+	summary   string
+	params    []object
+	body      object // request body content
+	responses map[string]object
+}
+
+var endpoints = []endpoint{
+	{method: "GET", path: "/", tag: "dashboard", summary: "Dashboard with scraper status and the newest values",
+		responses: map[string]object{"200": respond("OK", content("text/html", typed("string")))}},
+	{method: "GET", path: "/countries/{country}", tag: "dashboard", summary: "Dashboard page of a country",
+		params:    []object{countryParam, query("range", "string", "chart range: 30d, 90d (default), 180d or all")},
+		responses: map[string]object{"200": respond("OK", content("text/html", typed("string"))), "404": respond("not found", nil)}},
+	{method: "GET", path: "/states/{state}", tag: "dashboard", summary: "Dashboard page of a state",
+		params:    []object{stateParam, query("range", "string", "chart range: 30d, 90d (default), 180d or all")},
+		responses: map[string]object{"200": respond("OK", content("text/html", typed("string"))), "404": respond("not found", nil)}},
+	{method: "GET", path: "/assets/{name}", tag: "dashboard", summary: "Dashboard CSS and JS",
+		params:    []object{pathParam("name", "dashboard.css or dashboard.js")},
+		responses: map[string]object{"200": respond("OK", nil), "404": respond("not found", nil)}},
+	{method: "GET", path: "/api/openapi.json", tag: "meta", summary: "This document",
+		responses: map[string]object{"200": okJSON(typed("object"))}},
+	{method: "GET", path: "/metrics", tag: "meta", summary: "Prometheus metrics",
+		responses: map[string]object{"200": respond("OK", content("text/plain", typed("string")))}},
+	{method: "GET", path: "/healthz", tag: "meta", summary: "Liveness: the process is up and the DB answers",
+		responses: map[string]object{"200": okJSON(schemaRef("Health")), "503": respond("unhealthy", jsonContent(schemaRef("Health")))}},
+	{method: "GET", path: "/readyz", tag: "meta", summary: "Readiness: scrapers are fresh and the backup queue drains",
+		responses: map[string]object{"200": okJSON(schemaRef("Health")), "503": respond("not ready", jsonContent(schemaRef("Health")))}},
+
+	{method: "POST", path: "/api/internal/v1/countries", tag: "internal", summary: "Upsert a country datapoint",
+		body: jsonContent(schemaRef("DataEntry")), responses: upsertResponses},
+	{method: "POST", path: "/api/internal/v1/states", tag: "internal", summary: "Upsert a state datapoint",
+		body: jsonContent(schemaRef("DataEntry")), responses: upsertResponses},
+	{method: "POST", path: "/api/internal/v1/import/country_or_state", tag: "internal", summary: "Upsert a datapoint, the collection is found by name",
+		body: jsonContent(schemaRef("DataEntry")), responses: upsertResponses},
+	{method: "POST", path: "/api/internal/v1/boltdb/import", tag: "internal", summary: "Import datapoints of another coviddy DB in the background",
+		body:      content("application/octet-stream", object{"type": "string", "format": "binary"}),
+		responses: map[string]object{"201": respond("accepted for import", nil), "401": unauthorized}},
+	{method: "POST", path: "/api/internal/v1/rename", tag: "internal", summary: "Rename a series or merge it into another one",
+		body:      jsonContent(schemaRef("RenameRequest")),
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest, "401": unauthorized, "404": notFound, "409": respond("conflict", jsonContent(schemaRef("Error")))}},
+	{method: "GET", path: "/api/internal/v1/webhooks", tag: "internal", summary: "List webhook subscriptions",
+		responses: map[string]object{"200": okJSON(arrayOf(schemaRef("Subscription"))), "401": unauthorized}},
+	{method: "POST", path: "/api/internal/v1/webhooks", tag: "internal", summary: "Create a webhook subscription, the secret is only returned here",
+		body:      jsonContent(schemaRef("Subscription")),
+		responses: map[string]object{"201": respond("created", jsonContent(schemaRef("Subscription"))), "400": badRequest, "401": unauthorized}},
+	{method: "GET", path: "/api/internal/v1/webhooks/deliveries", tag: "internal", summary: "Webhook delivery log, newest first",
+		params:    []object{query("subscription", "string", "subscription ID"), query("status", "string", "pending, delivered or failed"), query("limit", "integer", "default 100")},
+		responses: map[string]object{"200": okJSON(arrayOf(typed("object"))), "400": badRequest, "401": unauthorized}},
+	{method: "POST", path: "/api/internal/v1/webhooks/deliveries/replay", tag: "internal", summary: "Deliver failed webhooks again",
+		params:    []object{query("subscription", "string", "only deliveries of this subscription")},
+		responses: map[string]object{"200": okJSON(typed("object")), "401": unauthorized}},
+	{method: "DELETE", path: "/api/internal/v1/webhooks/{id}", tag: "internal", summary: "Delete a webhook subscription",
+		params:    []object{pathParam("id", "subscription ID")},
+		responses: map[string]object{"204": respond("deleted", nil), "401": unauthorized, "404": notFound}},
+	{method: "GET", path: "/api/internal/v1/tokens", tag: "internal", summary: "List API tokens",
+		responses: map[string]object{"200": okJSON(arrayOf(schemaRef("Token"))), "401": unauthorized}},
+	{method: "POST", path: "/api/internal/v1/tokens", tag: "internal", summary: "Issue an API token, the token is only returned here",
+		body:      jsonContent(schemaRef("TokenRequest")),
+		responses: map[string]object{"201": respond("issued", jsonContent(schemaRef("IssuedToken"))), "400": badRequest, "401": unauthorized}},
+	{method: "DELETE", path: "/api/internal/v1/tokens/{id}", tag: "internal", summary: "Revoke an API token",
+		params:    []object{pathParam("id", "token ID")},
+		responses: map[string]object{"204": respond("revoked", nil), "401": unauthorized, "404": notFound}},
+
+	{method: "GET", path: "/api/v1/countries", tag: "v1", summary: "Country codes",
+		responses: map[string]object{"200": okJSON(arrayOf(typed("string")))}},
+	{method: "GET", path: "/api/v1/states", tag: "v1", summary: "State codes",
+		responses: map[string]object{"200": okJSON(arrayOf(typed("string")))}},
+	{method: "GET", path: "/api/v1/countries/latest", tag: "v1", summary: "Newest datapoint per country, most cases first",
+		responses: map[string]object{"200": okJSON(arrayOf(schemaRef("LatestEntry")))}},
+	{method: "GET", path: "/api/v1/states/latest", tag: "v1", summary: "Newest datapoint per state, most cases first",
+		responses: map[string]object{"200": okJSON(arrayOf(schemaRef("LatestEntry")))}},
+	{method: "GET", path: "/api/v1/countries/{country}", tag: "v1", summary: "Datapoints of a country by RFC3339 key",
+		params:    []object{countryParam, query(beforeParam, "string", "RFC3339 lower bound (sic)"), query(afterParam, "string", "RFC3339 upper bound (sic)")},
+		responses: map[string]object{"200": okJSON(object{"type": "object", "additionalProperties": schemaRef("DataEntry")}), "404": notFound}},
+	{method: "GET", path: "/api/v1/states/{state}", tag: "v1", summary: "Datapoints of a state by RFC3339 key",
+		params:    []object{stateParam, query(beforeParam, "string", "RFC3339 lower bound (sic)"), query(afterParam, "string", "RFC3339 upper bound (sic)")},
+		responses: map[string]object{"200": okJSON(object{"type": "object", "additionalProperties": schemaRef("DataEntry")}), "404": notFound}},
+	{method: "GET", path: "/api/v1/compare", tag: "v1", summary: "Several series resampled onto a shared grid",
+		params: with(namesQueries, []object{query("metric", "string", "cases (default), deaths or tests"), fromQuery, toQuery, stepQuery,
+			query("mode", "string", "locf (default) or linear"), query("align", "string", "e.g. first_n_cases:100")}),
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/stream", tag: "v1", summary: "Server-Sent Events of new datapoints",
+		params: []object{query("collection", "string", "countries or states"), query("names", "string", "comma separated names or codes"),
+			query("last_event_id", "string", "resume after this event, same as the Last-Event-ID header")},
+		responses: map[string]object{"200": respond("event stream", content("text/event-stream", typed("string"))), "400": badRequest}},
+	{method: "GET", path: "/api/v1/regions", tag: "v1", summary: "Newest totals per region",
+		responses: map[string]object{"200": okJSON(arrayOf(typed("object")))}},
+	{method: "GET", path: "/api/v1/regions/{region}", tag: "v1", summary: "Member countries of a region summed on a time grid",
+		params:    []object{pathParam("region", "region name or code, e.g. europe"), fromQuery, toQuery, stepQuery},
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/rankings", tag: "v1", summary: "Countries or states ranked by a metric, with rank movement",
+		params: []object{query("collection", "string", "countries (default) or states"), query("metric", "string", "[new_]cases|deaths|tests[_per_1m], _per_1m ones are countries only; default new_cases_per_1m for countries, new_cases for states"),
+			query("window", "string", "e.g. 7d"), query("order", "string", "desc (default) or asc"), query("limit", "integer", "default 20"), toQuery},
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest}},
+	{method: "GET", path: "/api/v1/quality", tag: "v1", summary: "Data quality report",
+		params: []object{fromQuery, toQuery, query("issues_only", "boolean", "leave entities without issues out"),
+			query("stale", "string", "duration"), query("gap", "string", "duration"), query("flat", "string", "duration")},
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest}},
+	{method: "GET", path: "/api/v1/reconciliation", tag: "v1", summary: "US totals reconciliation history",
+		params:    []object{fromQuery, toQuery},
+		responses: map[string]object{"200": okJSON(arrayOf(typed("object"))), "400": badRequest}},
+	{method: "GET", path: "/api/v1/alerts", tag: "v1", summary: "Alerting rules and their states",
+		params:    []object{query("firing", "boolean", "firing alerts only")},
+		responses: map[string]object{"200": okJSON(typed("object"))}},
+	{method: "GET", path: "/api/v1/countries/{country}/flags", tag: "v1", summary: "Validation flags of a country",
+		params:    []object{countryParam},
+		responses: map[string]object{"200": okJSON(arrayOf(typed("object")))}},
+	{method: "GET", path: "/api/v1/states/{state}/flags", tag: "v1", summary: "Validation flags of a state",
+		params:    []object{stateParam},
+		responses: map[string]object{"200": okJSON(arrayOf(typed("object")))}},
+	{method: "GET", path: "/api/v1/countries/{country}/metrics", tag: "v1", summary: "CFR, positivity, doubling time and Rt of a country",
+		params:    []object{countryParam, fromQuery, toQuery, query("window", "integer", "days"), query("si_mean", "number", "serial interval mean"), query("si_sd", "number", "serial interval SD")},
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/states/{state}/metrics", tag: "v1", summary: "CFR, positivity, doubling time and Rt of a state",
+		params:    []object{stateParam, fromQuery, toQuery, query("window", "integer", "days"), query("si_mean", "number", "serial interval mean"), query("si_sd", "number", "serial interval SD")},
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/countries/{country}/forecast", tag: "v1", summary: "Cases and deaths forecast of a country",
+		params: []object{countryParam, query("days", "integer", "days ahead"), query("window", "integer", "days the models are fit on"),
+			query("model", "string", "a single model"), query("backtest", "boolean", "score the models on past data"), query("origins", "integer", "backtest origins, up to 60")},
+		responses: map[string]object{"200": okJSON(typed("object")), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/countries/{country}/chart.svg", tag: "v1", summary: "SVG chart of a country",
+		params:    with([]object{countryParam}, chartQueries),
+		responses: map[string]object{"200": respond("OK", content("image/svg+xml", typed("string"))), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/states/{state}/chart.svg", tag: "v1", summary: "SVG chart of a state",
+		params:    with([]object{stateParam}, chartQueries),
+		responses: map[string]object{"200": respond("OK", content("image/svg+xml", typed("string"))), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v1/compare/chart.svg", tag: "v1", summary: "SVG chart of up to 10 series",
+		params:    with(namesQueries, chartQueries),
+		responses: map[string]object{"200": respond("OK", content("image/svg+xml", typed("string"))), "400": badRequest, "404": notFound}},
+
+	{method: "GET", path: "/api/v2/countries", tag: "v2", summary: "Countries with their newest values, by code",
+		responses: map[string]object{"200": okJSON(arrayOf(schemaRef("EntityV2")))}},
+	{method: "GET", path: "/api/v2/states", tag: "v2", summary: "States with their newest values, by code",
+		responses: map[string]object{"200": okJSON(arrayOf(schemaRef("EntityV2")))}},
+	{method: "GET", path: "/api/v2/countries/{country}", tag: "v2", summary: "Time ordered datapoints of a country",
+		params:    with([]object{countryParam}, seriesV2Queries),
+		responses: map[string]object{"200": okJSON(schemaRef("SeriesV2")), "400": badRequest, "404": notFound}},
+	{method: "GET", path: "/api/v2/states/{state}", tag: "v2", summary: "Time ordered datapoints of a state",
+		params:    with([]object{stateParam}, seriesV2Queries),
+		responses: map[string]object{"200": okJSON(schemaRef("SeriesV2")), "400": badRequest, "404": notFound}},
+}
+
+var upsertResponses = map[string]object{
+	"201": respond("saved", nil),
+	"202": respond("quarantined by validation", jsonContent(schemaRef("Error"))),
+	"401": unauthorized,
+	"422": respond("rejected by validation", jsonContent(schemaRef("Error"))),
+}
+
+var seriesV2Queries = []object{
+	fromQuery,
+	toQuery,
+	query(fieldsParam, "string", "comma separated cases, deaths, tests; all by default"),
+	query(limitParam, "integer", "page size, default 1000"),
+	query(cursorParam, "string", "next_cursor of the previous page"),
+}
+
+var dataEntrySchema = object{"type": "object", "properties": object{
+	"name":         typed("string"),
+	"when":         object{"type": "string", "format": "date-time"},
+	"total_cases":  typed("integer"),
+	"total_deaths": typed("integer"),
+	"total_tests":  typed("integer"),
+	"region":       typed("string"),
+	"population":   typed("integer"),
+}, "required": []string{"name", "when"}}
+
+var schemas = object{
+	"Error":     object{"type": "object", "properties": object{"message": typed("string")}},
+	"DataEntry": dataEntrySchema,
+	"LatestEntry": object{"allOf": []object{
+		object{"type": "object", "properties": object{"key": typed("string")}},
+		schemaRef("DataEntry"),
+	}},
+	"EntityV2": object{"type": "object", "properties": object{
+		"name": typed("string"), "code": typed("string"), "cases": typed("integer"), "deaths": typed("integer"), "tests": typed("integer"),
+		"updated_at": object{"type": "string", "format": "date-time"},
+	}},
+	"SeriesV2": object{"type": "object", "properties": object{
+		"name": typed("string"), "code": typed("string"), "next_cursor": typed("string"),
+		"data": arrayOf(object{"type": "object", "properties": object{
+			"when": object{"type": "string", "format": "date-time"}, "cases": typed("integer"), "deaths": typed("integer"), "tests": typed("integer"),
+		}}),
+	}},
+	"Health": object{"type": "object", "properties": object{
+		"status": typed("string"),
+		"checks": object{"type": "object", "additionalProperties": typed("object")},
+	}},
+	"RenameRequest": object{"type": "object", "properties": object{
+		"collection": typed("string"), "from": typed("string"), "to": typed("string"), "merge": typed("boolean"),
+		"overlap": object{"type": "string", "description": "what to do with datapoints both series have"},
+	}},
+	"Subscription": object{"type": "object", "properties": object{
+		"id": typed("string"), "url": typed("string"), "secret": typed("string"),
+		"collections": arrayOf(typed("string")), "names": arrayOf(typed("string")), "events": arrayOf(typed("string")),
+		"created": object{"type": "string", "format": "date-time"},
+	}},
+	"TokenRequest": object{"type": "object", "properties": object{
+		"name":       typed("string"),
+		"scopes":     arrayOf(object{"type": "string", "enum": auth.Scopes}),
+		"expires_in": object{"type": "string", "description": "Go duration, e.g. 720h; never expires when empty"},
+	}, "required": []string{"name", "scopes"}},
+	"Token":       tokenSchema,
+	"IssuedToken": object{"allOf": []object{schemaRef("Token"), object{"type": "object", "properties": object{"token": typed("string")}}}},
+}
+
+var tokenSchema = object{"type": "object", "properties": object{
+	"id": typed("string"), "name": typed("string"), "scopes": arrayOf(typed("string")),
+	"created":    object{"type": "string", "format": "date-time"},
+	"expires_at": object{"type": "string", "format": "date-time"},
+	"last_used":  object{"type": "string", "format": "date-time"},
+}}
+
+// rateLimitedPath paths in the rate limited route groups.
+func rateLimitedPath(path string) bool {
+	for _, prefix := range []string{"/api/v1/", "/api/v2/", "/api/internal/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return path == "/" || path == "/countries/{country}" || path == "/states/{state}"
+}
+
+// OpenAPISpec the OpenAPI 3 document of the API.
+func OpenAPISpec() object {
+	paths := object{}
+	for _, e := range endpoints {
+		responses := map[string]object{}
+		for status, response := range e.responses {
+			responses[status] = response
+		}
+		op := object{"tags": []string{e.tag}, "summary": e.summary, "responses": responses}
+		if len(e.params) > 0 {
+			op["parameters"] = e.params
+		}
+		if e.body != nil {
+			op["requestBody"] = object{"required": true, "content": e.body}
+		}
+		if strings.HasPrefix(e.path, "/api/internal/") {
+			op["security"] = []object{{"basicAuth": []string{}}, {"bearerAuth": []string{}}}
+			responses["403"] = forbidden
+		}
+		if rateLimitedPath(e.path) {
+			responses["429"] = rateLimited
+		}
+		item, ok := paths[e.path].(object)
+		if !ok {
+			item = object{}
+			paths[e.path] = item
+		}
+		item[strings.ToLower(e.method)] = op
+	}
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "coviddy",
+			"description": "COVID-19 stats scraped from worldometers.",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"basicAuth":  object{"type": "http", "scheme": "basic"},
+				"bearerAuth": object{"type": "http", "scheme": "bearer", "description": "API token with the scope the operation needs"},
+			},
+		},
+	}
+}
+
+// OpenAPIHandler prints the OpenAPI 3 document of the API.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, OpenAPISpec())
+}
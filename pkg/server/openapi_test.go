@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var refPattern = regexp.MustCompile(`#/components/schemas/(\w+)`)
+
+// TestOpenAPIInSync every route has its operation documented and every documented operation is routed.
+func TestOpenAPIInSync(t *testing.T) {
+	routed := []string{}
+	err := NewRouter(Guards{}).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // path prefixes of subrouters
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, m := range methods {
+			routed = append(routed, strings.ToLower(m)+" "+path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(OpenAPISpec())
+	require.NoError(t, err)
+	spec := struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}{}
+	require.NoError(t, json.Unmarshal(payload, &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+	documented := []string{}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	for _, ref := range refPattern.FindAllStringSubmatch(string(payload), -1) {
+		assert.Contains(t, schemas, ref[1])
+	}
+
+	sort.Strings(routed)
+	sort.Strings(documented)
+	assert.Equal(t, routed, documented)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/quality"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+// defaultQualityRange how far back the quality report looks unless from= is given.
+const defaultQualityRange = 30 * timeseries.Day
+
+// QualityHandler reports gaps, stale, flat and decreasing series, the entities with most issues first.
+func QualityHandler(w http.ResponseWriter, r *http.Request) {
+	rctx := requestcontext.GetRequestContext(r.Context())
+	if rctx == nil || rctx.DB == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	q := r.URL.Query()
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.Get(fromParam) == "" {
+		from = to.Add(-defaultQualityRange)
+	}
+	thresholds := quality.ThresholdsFromConfig(rctx.Config)
+	for param, threshold := range map[string]*time.Duration{"stale": &thresholds.Stale, "gap": &thresholds.Gap, "flat": &thresholds.Flat} {
+		if v := q.Get(param); v != "" {
+			if *threshold, err = timeseries.ParseStep(v); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	report, err := quality.Check(rctx.DB, from, to, thresholds)
+	if err != nil {
+		panic(err)
+	}
+	if q.Get("issues_only") == "true" {
+		entities := []quality.Entity{}
+		for _, e := range report.Entities {
+			if e.Issues() > 0 {
+				entities = append(entities, e)
+			}
+		}
+		report.Entities = entities
+	}
+	writeJSON(w, report)
+}
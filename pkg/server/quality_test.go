@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuality(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	rctx.Config.QualityStaleAfter = 36 * time.Hour
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/quality", QualityHandler)
+
+	res := struct {
+		Thresholds map[string]interface{} `json:"thresholds"`
+		Entities   []struct {
+			Code  string `json:"code"`
+			Stale bool   `json:"stale"`
+			Gaps  []struct {
+				Duration string `json:"duration"`
+			} `json:"gaps"`
+		} `json:"entities"`
+	}{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/quality?from=2020-06-01&to=2020-06-06&gap=12h", &res))
+	assert.Equal(t, "12h0m0s", res.Thresholds["gap"])
+	assert.Equal(t, "36h0m0s", res.Thresholds["stale"])
+	require.Len(t, res.Entities, 1)
+	assert.Equal(t, "ukraine", res.Entities[0].Code)
+	assert.False(t, res.Entities[0].Stale)
+	assert.Len(t, res.Entities[0].Gaps, 4, "datapoints are a day apart")
+
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/quality?flat=often", nil))
+}
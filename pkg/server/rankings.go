@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/rankings"
+	"github.com/mkorenkov/covid-19/pkg/regions"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+// RankingsResponse top entities of a collection by the metric.
+type RankingsResponse struct {
+	Collection string           `json:"collection"`
+	Metric     string           `json:"metric"`
+	Window     string           `json:"window"`
+	Order      string           `json:"order"`
+	At         time.Time        `json:"at"`
+	Entries    []rankings.Entry `json:"entries"`
+}
+
+// RankingsHandler ranks countries or states by the metric over the window, with rank movement since the previous window.
+func RankingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	q := r.URL.Query()
+	res := RankingsResponse{Collection: q.Get("collection"), Metric: q.Get("metric"), Window: q.Get("window"), Order: q.Get("order"), At: time.Now().UTC()}
+	if res.Collection == "" {
+		res.Collection = "countries"
+	}
+	if res.Window == "" {
+		res.Window = "7d"
+	}
+	if res.Order == "" {
+		res.Order = "desc"
+	}
+	collection, err := documents.ParseCollection(res.Collection)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if res.Metric == "" {
+		// states have no population, so there is nothing per capita to rank them by
+		res.Metric = "new_cases_per_1m"
+		if collection == documents.StateCollection {
+			res.Metric = "new_cases"
+		}
+	}
+	metric, err := rankings.ParseMetric(res.Metric)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if metric.PerCapita() && collection == documents.StateCollection {
+		writeError(w, http.StatusBadRequest, "per capita metrics are countries only, states have no population")
+		return
+	}
+	window, err := timeseries.ParseStep(res.Window)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if res.Order != "asc" && res.Order != "desc" {
+		writeError(w, http.StatusBadRequest, "invalid order "+res.Order+", expected asc or desc")
+		return
+	}
+	limit, err := parseIntParam(r, "limit", 20, 1, 1000)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := q.Get(toParam); v != "" {
+		if res.At, err = timeseries.ParseTime(v, true); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	series := []rankings.Series{}
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, k := range documents.ListKeys(tx, collection) {
+			if regions.IsTotal(k) {
+				continue
+			}
+			// one more window back, so values carried forward into the previous window are there
+			docs, readErr := documents.ReadSeries(tx, k, res.At.Add(-3*window), res.At)
+			if errors.Is(readErr, documents.BucketNotFoundError) {
+				continue
+			}
+			if readErr != nil {
+				return readErr
+			}
+			series = append(series, rankings.Series{Key: k, Docs: docs})
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	res.Collection = strings.ToLower(collection)
+	res.Entries = rankings.Rank(series, metric, res.At, window, res.Order == "desc")
+	if len(res.Entries) > limit {
+		res.Entries = res.Entries[:limit]
+	}
+	writeJSON(w, res)
+}
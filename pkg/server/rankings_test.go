@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankings(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/rankings", RankingsHandler)
+
+	res := RankingsResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/rankings?metric=new_cases&window=2d&to=2020-06-05", &res))
+	assert.Equal(t, "countries", res.Collection)
+	require.Len(t, res.Entries, 1)
+	assert.Equal(t, "ukraine", res.Entries[0].Code)
+	assert.InDelta(t, 200, res.Entries[0].Value, 1e-9)
+	assert.Equal(t, 0, *res.Entries[0].Movement)
+
+	perCapita := RankingsResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/rankings?to=2020-06-05", &perCapita))
+	assert.Empty(t, perCapita.Entries, "population is unknown")
+
+	states := []documents.CollectionEntry{}
+	for day := 1; day <= 5; day++ {
+		states = append(states, documents.DataEntry{Name: "Texas", When: time.Date(2020, 6, day, 12, 0, 0, 0, time.UTC), Cases: uint64(day * 10)})
+	}
+	require.NoError(t, documents.BulkSave(rctx.DB, documents.StateCollection, states, nil))
+	byState := RankingsResponse{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v1/rankings?collection=states&window=2d&to=2020-06-05", &byState))
+	assert.Equal(t, "new_cases", byState.Metric, "states default to a metric they have")
+	require.Len(t, byState.Entries, 1)
+	assert.Equal(t, "texas", byState.Entries[0].Code)
+	assert.InDelta(t, 20, byState.Entries[0].Value, 1e-9)
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/rankings?collection=states&metric=deaths_per_1m", nil))
+
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/rankings?collection=cities", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/rankings?metric=recovered", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/rankings?order=up", nil))
+}
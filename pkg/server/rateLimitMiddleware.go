@@ -0,0 +1,241 @@
+package server
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/auth"
+	"github.com/mkorenkov/covid-19/pkg/metrics"
+	"github.com/mkorenkov/covid-19/pkg/ratelimit"
+	"github.com/pkg/errors"
+)
+
+// Route groups rate limits are configured for.
+const (
+	APIGroup       = "api"       // /api/v1 and /api/v2
+	DashboardGroup = "dashboard" // HTML pages
+	InternalGroup  = "internal"  // /api/internal/v1
+	AuthGroup      = "auth"      // failed authentication attempts per IP, see LimitFailedAuth
+)
+
+// RouteGroups all route groups.
+var RouteGroups = []string{APIGroup, DashboardGroup, InternalGroup, AuthGroup}
+
+// RateLimitMiddleware token bucket rate limits per route group and client.
+type RateLimitMiddleware struct {
+	limiters map[string]*ratelimit.Limiter
+	proxies  []*net.IPNet // trusted proxies, their X-Forwarded-For tells the client IP
+}
+
+// NewRateLimitMiddleware creates RateLimitMiddleware from group:<requests>/<period> pairs, groups left out are not limited.
+// Requests coming from trustedProxies (IPs or CIDRs, e.g. a CDN or a load balancer) are limited per the IP
+// they forwarded the request for rather than per proxy.
+func NewRateLimitMiddleware(limits map[string]string, trustedProxies []string) (*RateLimitMiddleware, error) {
+	res := &RateLimitMiddleware{limiters: map[string]*ratelimit.Limiter{}}
+	for _, v := range trustedProxies {
+		proxy, err := parseIPNet(v)
+		if err != nil {
+			return nil, err
+		}
+		res.proxies = append(res.proxies, proxy)
+	}
+	for group, v := range limits {
+		known := false
+		for _, g := range RouteGroups {
+			known = known || g == group
+		}
+		if !known {
+			return nil, errors.Errorf("unknown rate limit route group %q", group)
+		}
+		limit, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			return nil, err
+		}
+		res.limiters[group] = ratelimit.New(limit)
+	}
+	return res, nil
+}
+
+// clientKind kind of a client key for the rate limited requests metric: token, user or anonymous.
+// Keys themselves are only logged, so the metric does not grow with every client.
+func clientKind(key string) string {
+	if strings.HasPrefix(key, "ip:") {
+		return "anonymous"
+	}
+	return key[:strings.Index(key, ":")]
+}
+
+// countRateLimited counts and logs a rejected request.
+func countRateLimited(group string, client string) {
+	log.Printf("[INFO] rate limited %s in the %s group\n", client, group)
+	metrics.RateLimited.Inc(group, clientKind(client))
+}
+
+// parseIPNet parses a CIDR or a single IP.
+func parseIPNet(v string) (*net.IPNet, error) {
+	v = strings.TrimSpace(v)
+	if strings.Contains(v, "/") {
+		_, res, err := net.ParseCIDR(v)
+		return res, errors.Wrapf(err, "invalid trusted proxy %q", v)
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil, errors.Errorf("invalid trusted proxy %q, expected IP or CIDR", v)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func (m *RateLimitMiddleware) trusted(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range m.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP the peer address, or behind trusted proxies the rightmost X-Forwarded-For address that is not
+// a trusted proxy itself. Addresses left of it are whatever the client sent, so they are not believed.
+func (m *RateLimitMiddleware) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !m.trusted(host) {
+		return host
+	}
+	hops := []string{}
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		host = hops[i]
+		if !m.trusted(host) {
+			break
+		}
+	}
+	return host
+}
+
+func (m *RateLimitMiddleware) ipKey(r *http.Request) string {
+	return "ip:" + m.clientIP(r)
+}
+
+// clientKey authenticated clients are limited per token or user, everyone else per IP.
+func (m *RateLimitMiddleware) clientKey(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		if p.TokenID != "" {
+			return "token:" + p.TokenID
+		}
+		return "user:" + p.Name
+	}
+	return m.ipKey(r)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Limit rate limits the route group, answers 429 with Retry-After once the client runs out of requests.
+func (m *RateLimitMiddleware) Limit(group string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		limiter, ok := m.limiters[group]
+		if !ok {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := m.clientKey(r)
+			d := limiter.Allow(client, time.Now())
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			w.Header().Set("X-RateLimit-Reset", ceilSeconds(d.Reset))
+			if !d.Allowed {
+				countRateLimited(group, client)
+				w.Header().Set("Retry-After", ceilSeconds(d.RetryAfter))
+				writeError(w, http.StatusTooManyRequests, "rate limit of "+limiter.Limit().String()+" exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authStatusWriter calls settled once the status of the response is known.
+type authStatusWriter struct {
+	http.ResponseWriter
+
+	settled func(status int)
+}
+
+func (w *authStatusWriter) settle(status int) {
+	if w.settled != nil {
+		w.settled(status)
+		w.settled = nil
+	}
+}
+
+func (w *authStatusWriter) WriteHeader(status int) {
+	w.settle(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *authStatusWriter) Write(p []byte) (int, error) {
+	w.settle(http.StatusOK)
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets streaming handlers flush through the wrapper.
+func (w *authStatusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// LimitFailedAuth rate limits failed authentication attempts per IP, goes in front of Require and Identify.
+// Requests with credentials take a token up front, so guesses are cut off before the password is checked,
+// and get it back unless the response is 401.
+func (m *RateLimitMiddleware) LimitFailedAuth(next http.Handler) http.Handler {
+	limiter, ok := m.limiters[AuthGroup]
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := m.ipKey(r)
+		d := limiter.Allow(client, time.Now())
+		if !d.Allowed {
+			countRateLimited(AuthGroup, client)
+			w.Header().Set("Retry-After", ceilSeconds(d.RetryAfter))
+			writeError(w, http.StatusTooManyRequests, "too many failed authentication attempts")
+			return
+		}
+		sw := &authStatusWriter{ResponseWriter: w, settled: func(status int) {
+			if status != http.StatusUnauthorized {
+				limiter.Refund(client)
+			}
+		}}
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	l, err := NewRateLimitMiddleware(map[string]string{APIGroup: "2/1m"}, nil)
+	require.NoError(t, err)
+	router := NewRouter(Guards{Limit: l.Limit})
+
+	call := func(url string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		requestcontext.InjectRequestContextMiddleware(router, rctx).ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("/api/v1/countries", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, call("/api/v2/countries", "10.0.0.1:1235").Code)
+
+	w = call("/api/v1/countries", "10.0.0.1:1236")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, call("/api/v1/countries", "10.0.0.2:1234").Code, "limits are per client")
+	assert.Equal(t, http.StatusOK, call("/", "10.0.0.1:1234").Code, "the dashboard group is not limited")
+
+	assert.Equal(t, "anonymous", clientKind("ip:10.0.0.1"))
+	assert.Equal(t, "token", clientKind("token:abc"))
+
+	_, err = NewRateLimitMiddleware(map[string]string{"everything": "2/1m"}, nil)
+	assert.Error(t, err)
+	_, err = NewRateLimitMiddleware(map[string]string{APIGroup: "2"}, nil)
+	assert.Error(t, err)
+	_, err = NewRateLimitMiddleware(nil, []string{"cdn"})
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	l, err := NewRateLimitMiddleware(nil, []string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+	for _, c := range []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"}, // not a trusted proxy
+		{"10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1, 192.168.1.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"garbage, 10.0.0.5"}, "10.0.0.5"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/countries", nil)
+		req.RemoteAddr = c.remoteAddr
+		for _, v := range c.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		assert.Equal(t, c.expected, l.clientIP(req), "%s %v", c.remoteAddr, c.forwarded)
+	}
+}
+
+func TestLimitFailedAuth(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	a := NewAuthMiddleware(map[string]string{"admin": "secret"})
+	l, err := NewRateLimitMiddleware(map[string]string{AuthGroup: "2/1m"}, nil)
+	require.NoError(t, err)
+	router := NewRouter(Guards{Require: a.Require, Identify: a.Identify, Limit: l.Limit, LimitAuth: l.LimitFailedAuth})
+
+	call := func(url string, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.SetBasicAuth("admin", password)
+		w := httptest.NewRecorder()
+		requestcontext.InjectRequestContextMiddleware(router, rctx).ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, call("/api/internal/v1/webhooks", "secret").Code, "authenticated requests do not count")
+	}
+	assert.Equal(t, http.StatusUnauthorized, call("/api/internal/v1/webhooks", "guess1").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/api/v1/countries", "guess2").Code)
+	w := call("/api/internal/v1/webhooks", "secret")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
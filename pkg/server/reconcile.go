@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mkorenkov/covid-19/pkg/reconcile"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+// defaultReconcileRange how far back the reconciliation history goes unless from= is given.
+const defaultReconcileRange = 30 * timeseries.Day
+
+// ReconciliationHandler prints how far the states sum, the "USA Total" row and the USA country row were apart, oldest first.
+func ReconciliationHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get(fromParam) == "" {
+		from = to.Add(-defaultReconcileRange)
+	}
+	res, err := reconcile.History(db, from, to)
+	if err != nil {
+		panic(err)
+	}
+	writeJSON(w, res)
+}
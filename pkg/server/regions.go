@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/regions"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+// RegionSeries region totals on a time grid.
+type RegionSeries struct {
+	regions.Region
+	Step string          `json:"step"`
+	Data []regions.Point `json:"data"`
+}
+
+// RegionsHandler prints the newest totals per region, compared against worldometers' own continent totals.
+func RegionsHandler(w http.ResponseWriter, r *http.Request) {
+	cache := requestcontext.Latest(r.Context())
+	if cache == nil {
+		panic(errors.New("Could not retrieve latest values cache from context"))
+	}
+	writeJSON(w, regions.Summarize(cache.Get(documents.CountryCollection)))
+}
+
+// RegionDatapointsHandler sums member countries of the region on a common time grid.
+func RegionDatapointsHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	cache := requestcontext.Latest(r.Context())
+	if cache == nil {
+		panic(errors.New("Could not retrieve latest values cache from context"))
+	}
+
+	vars := mux.Vars(r)
+	region, ok := regions.Find(regions.Group(cache.Get(documents.CountryCollection)), vars["region"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "region not found")
+		return
+	}
+	step, err := timeseries.ParseStep(r.URL.Query().Get("step"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	members := map[string][]documents.DataEntry{}
+	var total []documents.DataEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, k := range region.Members {
+			docs, readErr := documents.ReadSeries(tx, k, from, to)
+			if readErr != nil {
+				return readErr
+			}
+			members[k] = docs
+		}
+		docs, readErr := documents.ReadSeries(tx, region.TotalKey(), from, to)
+		if readErr != nil && !errors.Is(readErr, documents.BucketNotFoundError) {
+			return readErr
+		}
+		total = docs
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	start := from
+	if start.IsZero() {
+		start = earliest(members)
+	}
+	if timeseries.GridSize(start, to, step) > maxGridSize {
+		writeError(w, http.StatusBadRequest, "too many grid points, use a larger step or a shorter range")
+		return
+	}
+	grid := timeseries.Grid(start, to, step)
+	writeJSON(w, RegionSeries{Region: region, Step: step.String(), Data: regions.Rollup(members, total, grid)})
+}
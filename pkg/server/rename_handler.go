@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+type renameRequest struct {
+	Collection string `json:"collection"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Merge      bool   `json:"merge"`
+	Overlap    string `json:"overlap"`
+}
+
+// RenameHandler renames a series or merges it into another one, keeping an alias for the old name.
+func RenameHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	req := renameRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	collection, err := documents.ParseCollection(req.Collection)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	policy, err := documents.ParseOverlapPolicy(req.Overlap)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var res documents.MergeResult
+	if req.Merge {
+		res, err = documents.Merge(db, collection, req.From, req.To, policy)
+	} else {
+		res, err = documents.Rename(db, collection, req.From, req.To)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, documents.InvalidRenameError):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, documents.BucketNotFoundError):
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			// the target already exists or the merge ran into overlapping datapoints
+			writeError(w, http.StatusConflict, err.Error())
+		}
+		return
+	}
+	if cache := requestcontext.Latest(r.Context()); cache != nil {
+		if err := cache.Load(db); err != nil {
+			panic(err)
+		}
+	}
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(res); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/auth"
+)
+
+// Guards middlewares NewRouter protects routes with, nil ones let every request through.
+type Guards struct {
+	Require   func(scope string) mux.MiddlewareFunc // internal API routes need the scope
+	Identify  mux.MiddlewareFunc                    // optional credentials on public routes
+	Limit     func(group string) mux.MiddlewareFunc // rate limits per route group
+	LimitAuth mux.MiddlewareFunc                    // failed authentication attempts, in front of Require and Identify
+}
+
+func passThrough(next http.Handler) http.Handler {
+	return next
+}
+
+func (g Guards) require(scope string) mux.MiddlewareFunc {
+	if g.Require == nil {
+		return passThrough
+	}
+	return g.Require(scope)
+}
+
+func (g Guards) identify() mux.MiddlewareFunc {
+	if g.Identify == nil {
+		return passThrough
+	}
+	return g.Identify
+}
+
+func (g Guards) limitAuth() mux.MiddlewareFunc {
+	if g.LimitAuth == nil {
+		return passThrough
+	}
+	return g.LimitAuth
+}
+
+func (g Guards) limit(group string) mux.MiddlewareFunc {
+	if g.Limit == nil {
+		return passThrough
+	}
+	return g.Limit(group)
+}
+
+// NewRouter routes of the daemon.
+func NewRouter(g Guards) *mux.Router {
+	r := mux.NewRouter()
+	page := func(handler http.HandlerFunc) http.Handler {
+		return g.limit(DashboardGroup)(handler)
+	}
+	r.Handle("/", page(HomeHandler)).Methods("GET")
+	r.HandleFunc("/api/openapi.json", OpenAPIHandler).Methods("GET")
+	r.HandleFunc("/assets/{name}", AssetHandler).Methods("GET")
+	r.Handle("/countries/{country}", page(CountryPageHandler)).Methods("GET")
+	r.Handle("/states/{state}", page(StatePageHandler)).Methods("GET")
+	r.HandleFunc("/metrics", MetricsHandler).Methods("GET")
+	r.HandleFunc("/healthz", HealthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", ReadyzHandler).Methods("GET")
+	r.Handle("/api/v1/stream", g.limitAuth()(g.identify()(g.limit(APIGroup)(http.HandlerFunc(StreamHandler))))).Methods("GET")
+	r.Use(RouteMiddleware, CompressionMiddleware)
+
+	internal := r.PathPrefix("/api/internal/v1/").Subrouter()
+	// limited after auth, so clients are told apart by their credentials, failed attempts are limited before it
+	guarded := func(scope string, handler http.HandlerFunc) http.Handler {
+		return g.limitAuth()(g.require(scope)(g.limit(InternalGroup)(handler)))
+	}
+	internal.Handle("/countries", guarded(auth.ScopeUpsert, UpsertAnythingHandler)).Methods("POST")
+	internal.Handle("/states", guarded(auth.ScopeUpsert, UpsertAnythingHandler)).Methods("POST")
+	internal.Handle("/import/country_or_state", guarded(auth.ScopeUpsert, UpsertAnythingHandler)).Methods("POST")
+	internal.Handle("/boltdb/import", guarded(auth.ScopeImport, BoltDBImportHandler)).Methods("POST")
+	internal.Handle("/rename", guarded(auth.ScopeAdmin, RenameHandler)).Methods("POST")
+	internal.Handle("/webhooks", guarded(auth.ScopeRead, ListWebhooksHandler)).Methods("GET")
+	internal.Handle("/webhooks", guarded(auth.ScopeAdmin, CreateWebhookHandler)).Methods("POST")
+	internal.Handle("/webhooks/deliveries", guarded(auth.ScopeRead, WebhookDeliveriesHandler)).Methods("GET")
+	internal.Handle("/webhooks/deliveries/replay", guarded(auth.ScopeAdmin, ReplayWebhooksHandler)).Methods("POST")
+	internal.Handle("/webhooks/{id}", guarded(auth.ScopeAdmin, DeleteWebhookHandler)).Methods("DELETE")
+	internal.Handle("/tokens", guarded(auth.ScopeAdmin, ListTokensHandler)).Methods("GET")
+	internal.Handle("/tokens", guarded(auth.ScopeAdmin, CreateTokenHandler)).Methods("POST")
+	internal.Handle("/tokens/{id}", guarded(auth.ScopeAdmin, RevokeTokenHandler)).Methods("DELETE")
+
+	api := r.PathPrefix("/api/v1/").Subrouter()
+	api.HandleFunc("/countries", ListCountriesHandler).Methods("GET")
+	api.HandleFunc("/states", ListStatesHandler).Methods("GET")
+	api.HandleFunc("/countries/latest", LatestCountriesHandler).Methods("GET")
+	api.HandleFunc("/states/latest", LatestStatesHandler).Methods("GET")
+	api.HandleFunc("/countries/{country}", CountryDatapointsHandler).Methods("GET")
+	api.HandleFunc("/states/{state}", StateDatapointsHandler).Methods("GET")
+	api.HandleFunc("/compare", CompareHandler).Methods("GET")
+	api.HandleFunc("/regions", RegionsHandler).Methods("GET")
+	api.HandleFunc("/rankings", RankingsHandler).Methods("GET")
+	api.HandleFunc("/quality", QualityHandler).Methods("GET")
+	api.HandleFunc("/reconciliation", ReconciliationHandler).Methods("GET")
+	api.HandleFunc("/alerts", AlertsHandler).Methods("GET")
+	api.HandleFunc("/regions/{region}", RegionDatapointsHandler).Methods("GET")
+	api.HandleFunc("/countries/{country}/flags", CountryFlagsHandler).Methods("GET")
+	api.HandleFunc("/states/{state}/flags", StateFlagsHandler).Methods("GET")
+	api.HandleFunc("/countries/{country}/metrics", CountryMetricsHandler).Methods("GET")
+	api.HandleFunc("/states/{state}/metrics", StateMetricsHandler).Methods("GET")
+	api.HandleFunc("/countries/{country}/forecast", CountryForecastHandler).Methods("GET")
+	api.HandleFunc("/countries/{country}/chart.svg", CountryChartHandler).Methods("GET")
+	api.HandleFunc("/states/{state}/chart.svg", StateChartHandler).Methods("GET")
+	api.HandleFunc("/compare/chart.svg", CompareChartHandler).Methods("GET")
+	api.Use(g.limitAuth(), g.identify(), g.limit(APIGroup), CachingMiddleware)
+
+	apiV2 := r.PathPrefix("/api/v2/").Subrouter()
+	apiV2.HandleFunc("/countries", ListCountriesV2Handler).Methods("GET")
+	apiV2.HandleFunc("/states", ListStatesV2Handler).Methods("GET")
+	apiV2.HandleFunc("/countries/{country}", CountryDatapointsV2Handler).Methods("GET")
+	apiV2.HandleFunc("/states/{state}", StateDatapointsV2Handler).Methods("GET")
+	apiV2.Use(g.limitAuth(), g.identify(), g.limit(APIGroup), CachingMiddleware)
+	return r
+}
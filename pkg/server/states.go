@@ -63,12 +63,17 @@ func StateDatapointsHandler(w http.ResponseWriter, r *http.Request) {
 		max = time.Now().Format(time.RFC3339)
 	}
 
+	fresh := false
 	err := db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(strings.ToLower(state)))
+		code := documents.ResolveAlias(tx, strings.ToLower(state))
+		bucket := tx.Bucket([]byte(code))
 		if bucket == nil {
 			writeError(w, http.StatusNotFound, "state not found")
 			return nil
 		}
+		if fresh = writeValidators(w, r, rangeValidators(bucket, code, []byte(min), []byte(max))); fresh {
+			return nil
+		}
 
 		c := bucket.Cursor()
 		for k, v := c.Seek([]byte(min)); k != nil && bytes.Compare(k, []byte(max)) <= 0; k, v = c.Next() {
@@ -83,6 +88,9 @@ func StateDatapointsHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
+	if fresh {
+		return
+	}
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	if err = enc.Encode(res); err != nil {
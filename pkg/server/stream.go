@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/stream"
+	"github.com/pkg/errors"
+)
+
+const (
+	// streamLifetime stays below the server WriteTimeout, EventSource clients reconnect with Last-Event-ID.
+	streamLifetime    = 50 * time.Second
+	streamKeepalive   = 15 * time.Second
+	streamRetry       = 3 * time.Second
+	maxReplayedEvents = 10000
+)
+
+// streamFilter reads collection= and names= params, names are resolved through aliases.
+func streamFilter(db *bolt.DB, r *http.Request) (stream.Filter, error) {
+	res := stream.Filter{Collections: map[string]bool{}, Codes: map[string]bool{}}
+	if v := r.URL.Query().Get("collection"); v != "" {
+		collection, err := documents.ParseCollection(v)
+		if err != nil {
+			return res, err
+		}
+		res.Collections[strings.ToLower(collection)] = true
+	}
+	v := r.URL.Query().Get("names")
+	if v == "" {
+		return res, nil
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				res.Codes[documents.ResolveAlias(tx, documents.Key(name))] = true
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// lastEventID reads Last-Event-ID header, or last_event_id param for clients that cannot set headers.
+func lastEventID(r *http.Request) string {
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		return v
+	}
+	return r.URL.Query().Get("last_event_id")
+}
+
+func writeEvent(w http.ResponseWriter, e stream.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error encoding stream event")
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: datapoint\ndata: %s\n\n", e.ID, payload)
+	return err
+}
+
+// StreamHandler pushes new datapoints as Server-Sent Events. Optional collection= and names= params filter them,
+// Last-Event-ID resumes from the given event: datapoints stored after it are replayed from the DB first.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	broker := requestcontext.Stream(r.Context())
+	if broker == nil {
+		panic(errors.New("Could not retrieve stream broker from context"))
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "streaming is not supported")
+		return
+	}
+	filter, err := streamFilter(db, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var resume *stream.Position
+	if id := lastEventID(r); id != "" {
+		p, err := stream.ParseID(id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resume = &p
+	}
+
+	// subscribe before replaying, so nothing committed in between gets lost
+	sub := broker.Subscribe(filter)
+	defer broker.Unsubscribe(sub)
+
+	replayed := map[string]bool{}
+	backlog := []stream.Event{}
+	if resume != nil {
+		if backlog, err = stream.Since(db, *resume, filter, maxReplayedEvents); err != nil {
+			panic(err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	for _, e := range backlog {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+		replayed[e.ID] = true
+	}
+	flusher.Flush()
+	if len(backlog) == maxReplayedEvents {
+		// the client reconnects from the last replayed event and gets the rest
+		return
+	}
+
+	lifetime := time.NewTimer(streamLifetime)
+	defer lifetime.Stop()
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lifetime.C:
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, more := <-sub.Events():
+			if !more {
+				// dropped for falling behind, the client resumes from the last event it got
+				return
+			}
+			if replayed[e.ID] {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
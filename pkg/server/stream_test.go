@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEventID reads the stream up to the next event and returns its ID.
+func nextEventID(t *testing.T, r *bufio.Reader) string {
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, "id: ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "id: "))
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	rctx.Stream = stream.NewBroker(10)
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/stream", StreamHandler)
+	srv := httptest.NewServer(LogMiddleware(requestcontext.InjectRequestContextMiddleware(r, rctx)))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/stream?collection=countries&names=ukraine", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "2020-06-03T12:00:00Z/countries/ukraine")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(resp.Body)
+	assert.Equal(t, "2020-06-04T12:00:00Z/countries/ukraine", nextEventID(t, body))
+	assert.Equal(t, "2020-06-05T12:00:00Z/countries/ukraine", nextEventID(t, body))
+
+	docs := []documents.CollectionEntry{
+		documents.DataEntry{Name: "Italy", When: time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC), Cases: 1},
+		documents.DataEntry{Name: "Ukraine", When: time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC), Cases: 600},
+	}
+	require.NoError(t, documents.BulkSave(rctx.DB, documents.CountryCollection, docs, nil))
+	require.NoError(t, rctx.Stream.PublishSaved(rctx.DB, docs))
+	assert.Equal(t, "2020-06-06T12:00:00Z/countries/ukraine", nextEventID(t, body))
+
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v1/stream?collection=cities", nil))
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/auth"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/pkg/errors"
+)
+
+// TokenRequest POST /api/internal/v1/tokens payload, an empty expires_in never expires.
+type TokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in,omitempty"` // Go duration, e.g. 720h
+}
+
+// IssuedToken token with its secret, which is only shown once.
+type IssuedToken struct {
+	auth.Token
+	Secret string `json:"token"`
+}
+
+// ListTokensHandler prints API tokens, hashes left out.
+func ListTokensHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	res, err := auth.List(db)
+	if err != nil {
+		panic(err)
+	}
+	writeJSON(w, res)
+}
+
+// CreateTokenHandler issues an API token. The token is shown in the response only.
+func CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	req := TokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expires_in "+req.ExpiresIn)
+			return
+		}
+	}
+	t, secret, err := auth.Issue(db, req.Name, req.Scopes, ttl, time.Now())
+	if errors.Is(err, auth.InvalidTokenError) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(IssuedToken{Token: t, Secret: secret}); err != nil {
+		panic(err)
+	}
+}
+
+// RevokeTokenHandler deletes an API token.
+func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	err := auth.Revoke(db, mux.Vars(r)["id"])
+	if errors.Is(err, auth.TokenNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
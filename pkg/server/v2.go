@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/timeseries"
+	"github.com/pkg/errors"
+)
+
+const (
+	fromParam   = "from"
+	toParam     = "to"
+	fieldsParam = "fields"
+	limitParam  = "limit"
+	cursorParam = "cursor"
+
+	defaultLimit = 1000
+	maxLimit     = 10000
+)
+
+var v2Fields = []string{"cases", "deaths", "tests"}
+
+// EntityV2 single country / state in v2 list responses.
+type EntityV2 struct {
+	Name      string    `json:"name"`
+	Code      string    `json:"code"`
+	Cases     uint64    `json:"cases"`
+	Deaths    uint64    `json:"deaths"`
+	Tests     uint64    `json:"tests"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DatapointV2 single datapoint in v2 series responses. Fields not requested via fields= are omitted.
+type DatapointV2 struct {
+	When   time.Time `json:"when"`
+	Cases  *uint64   `json:"cases,omitempty"`
+	Deaths *uint64   `json:"deaths,omitempty"`
+	Tests  *uint64   `json:"tests,omitempty"`
+}
+
+// SeriesV2 v2 series response.
+type SeriesV2 struct {
+	Name       string        `json:"name"`
+	Code       string        `json:"code"`
+	Data       []DatapointV2 `json:"data"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// timeRange reads from= and to= query params, both optional.
+func timeRange(r *http.Request) (time.Time, time.Time, error) {
+	from := time.Time{}
+	to := time.Now().UTC()
+	var err error
+	if v := r.URL.Query().Get(fromParam); v != "" {
+		if from, err = timeseries.ParseTime(v, false); err != nil {
+			return from, to, err
+		}
+	}
+	if v := r.URL.Query().Get(toParam); v != "" {
+		if to, err = timeseries.ParseTime(v, true); err != nil {
+			return from, to, err
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("to is before from")
+	}
+	return from, to, nil
+}
+
+func parseFields(v string) (map[string]bool, error) {
+	res := map[string]bool{}
+	if v == "" {
+		for _, f := range v2Fields {
+			res[f] = true
+		}
+		return res, nil
+	}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		known := false
+		for _, k := range v2Fields {
+			known = known || k == f
+		}
+		if !known {
+			return nil, errors.Errorf("unknown field %s, expected any of %s", f, strings.Join(v2Fields, ","))
+		}
+		res[f] = true
+	}
+	return res, nil
+}
+
+func parseLimit(v string) (int, error) {
+	if v == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, errors.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+	return limit, nil
+}
+
+func encodeCursor(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+func decodeCursor(v string) ([]byte, error) {
+	res, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return res, nil
+}
+
+func newDatapointV2(doc documents.DataEntry, fields map[string]bool) DatapointV2 {
+	res := DatapointV2{When: doc.GetWhen()}
+	if fields["cases"] {
+		res.Cases = &doc.Cases
+	}
+	if fields["deaths"] {
+		res.Deaths = &doc.Deaths
+	}
+	if fields["tests"] {
+		res.Tests = &doc.Tests
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		panic(err)
+	}
+}
+
+// listEntitiesV2 returns entities of the collection with their latest values, ordered by code.
+func listEntitiesV2(w http.ResponseWriter, r *http.Request, collection string) {
+	cache := requestcontext.Latest(r.Context())
+	if cache == nil {
+		panic(errors.New("Could not retrieve latest values cache from context"))
+	}
+
+	res := []EntityV2{}
+	for _, entry := range cache.Get(collection) {
+		res = append(res, EntityV2{
+			Name:      entry.Name,
+			Code:      entry.Key,
+			Cases:     entry.Cases,
+			Deaths:    entry.Deaths,
+			Tests:     entry.Tests,
+			UpdatedAt: entry.GetWhen(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Code < res[j].Code
+	})
+	writeJSON(w, res)
+}
+
+// seriesV2 returns time ordered datapoints of a single entity.
+func seriesV2(w http.ResponseWriter, r *http.Request, param string) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+
+	name := mux.Vars(r)[param]
+	if name == "" {
+		writeError(w, http.StatusBadRequest, param+" param is required")
+		return
+	}
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query().Get(fieldsParam))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseLimit(r.URL.Query().Get(limitParam))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var after []byte
+	if v := r.URL.Query().Get(cursorParam); v != "" {
+		if after, err = decodeCursor(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	min := []byte(from.UTC().Format(time.RFC3339))
+	max := []byte(to.UTC().Format(time.RFC3339))
+	if after != nil && bytes.Compare(after, min) >= 0 {
+		min = after
+	}
+
+	res := SeriesV2{Data: []DatapointV2{}}
+	found, fresh := false, false
+	err = db.View(func(tx *bolt.Tx) error {
+		res.Code = documents.ResolveAlias(tx, strings.ToLower(name))
+		bucket := tx.Bucket([]byte(res.Code))
+		if bucket == nil {
+			return nil
+		}
+		found = true
+		// every page of the range shares the validators
+		if fresh = writeValidators(w, r, rangeValidators(bucket, res.Code, []byte(from.UTC().Format(time.RFC3339)), max)); fresh {
+			return nil
+		}
+		if _, last := bucket.Cursor().Last(); last != nil {
+			if doc, parseErr := documents.NoValidationsParse(last); parseErr == nil {
+				res.Name = doc.Name
+			}
+		}
+
+		var lastKey []byte
+		c := bucket.Cursor()
+		k, v := c.Seek(min)
+		if after != nil && bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+		for ; k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+			if len(res.Data) == limit {
+				res.NextCursor = encodeCursor(lastKey)
+				break
+			}
+			doc, parseErr := documents.NoValidationsParse(v)
+			if parseErr != nil {
+				return errors.Wrap(parseErr, "error decoding json from DB")
+			}
+			res.Data = append(res.Data, newDatapointV2(doc, fields))
+			lastKey = k
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, param+" not found")
+		return
+	}
+	if fresh {
+		return
+	}
+	writeJSON(w, res)
+}
+
+// ListCountriesV2Handler lists countries with their latest values.
+func ListCountriesV2Handler(w http.ResponseWriter, r *http.Request) {
+	listEntitiesV2(w, r, documents.CountryCollection)
+}
+
+// ListStatesV2Handler lists states with their latest values.
+func ListStatesV2Handler(w http.ResponseWriter, r *http.Request) {
+	listEntitiesV2(w, r, documents.StateCollection)
+}
+
+// CountryDatapointsV2Handler prints time ordered per country data.
+func CountryDatapointsV2Handler(w http.ResponseWriter, r *http.Request) {
+	seriesV2(w, r, "country")
+}
+
+// StateDatapointsV2Handler prints time ordered per state data.
+func StateDatapointsV2Handler(w http.ResponseWriter, r *http.Request) {
+	seriesV2(w, r, "state")
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/config"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/latest"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext(t *testing.T) (*requestcontext.RequestContext, func()) {
+	dir, err := ioutil.TempDir("", "server")
+	require.NoError(t, err)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+
+	docs := []documents.CollectionEntry{}
+	for day := 1; day <= 5; day++ {
+		docs = append(docs, documents.DataEntry{Name: "Ukraine", When: time.Date(2020, 6, day, 12, 0, 0, 0, time.UTC), Cases: uint64(day * 100), Deaths: uint64(day)})
+	}
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs, nil))
+
+	rctx := requestcontext.New(config.Config{Storage: config.Storage{StorageDir: dir}}, db, make(chan error, 10), make(chan documents.CollectionEntry, 10), nil)
+	rctx.Latest = latest.New()
+	require.NoError(t, rctx.Latest.Load(db))
+	return rctx, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func get(t *testing.T, rctx *requestcontext.RequestContext, router *mux.Router, url string, v interface{}) int {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	w := httptest.NewRecorder()
+	requestcontext.InjectRequestContextMiddleware(router, rctx).ServeHTTP(w, req)
+	if v != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func TestSeriesV2(t *testing.T) {
+	rctx, cleanup := testContext(t)
+	defer cleanup()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/countries", ListCountriesV2Handler)
+	r.HandleFunc("/api/v2/countries/{country}", CountryDatapointsV2Handler)
+
+	entities := []EntityV2{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v2/countries", &entities))
+	require.Len(t, entities, 1)
+	assert.Equal(t, EntityV2{Name: "Ukraine", Code: "ukraine", Cases: 500, Deaths: 5, UpdatedAt: time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)}, entities[0])
+
+	series := SeriesV2{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v2/countries/Ukraine?from=2020-06-02&to=2020-06-04&fields=cases&limit=2", &series))
+	require.Len(t, series.Data, 2)
+	assert.Equal(t, uint64(200), *series.Data[0].Cases)
+	assert.Nil(t, series.Data[0].Deaths)
+	assert.Equal(t, uint64(300), *series.Data[1].Cases)
+	require.NotEmpty(t, series.NextCursor)
+
+	next := SeriesV2{}
+	require.Equal(t, http.StatusOK, get(t, rctx, r, "/api/v2/countries/Ukraine?from=2020-06-02&to=2020-06-04&fields=cases&limit=2&cursor="+series.NextCursor, &next))
+	require.Len(t, next.Data, 1)
+	assert.Equal(t, uint64(400), *next.Data[0].Cases)
+	assert.Empty(t, next.NextCursor)
+
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v2/countries/Ukraine?fields=recovered", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, rctx, r, "/api/v2/countries/Ukraine?from=yesterday", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, rctx, r, "/api/v2/countries/Atlantis", nil))
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mkorenkov/covid-19/pkg/requestcontext"
+	"github.com/mkorenkov/covid-19/pkg/webhooks"
+	"github.com/pkg/errors"
+)
+
+const defaultDeliveriesLimit = 100
+
+// ListWebhooksHandler prints webhook subscriptions, secrets left out.
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	res, err := webhooks.List(db)
+	if err != nil {
+		panic(err)
+	}
+	writeJSON(w, res)
+}
+
+// CreateWebhookHandler registers a webhook subscription. The secret is shown in the response only.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	req := webhooks.Subscription{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	res, err := webhooks.Create(db, req, time.Now())
+	if errors.Is(err, webhooks.InvalidSubscriptionError) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		panic(err)
+	}
+}
+
+// DeleteWebhookHandler removes a webhook subscription.
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	err := webhooks.Delete(db, mux.Vars(r)["id"])
+	if errors.Is(err, webhooks.SubscriptionNotFoundError) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveriesHandler prints the delivery log, newest first. Optional params: subscription, status and limit.
+func WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	limit, err := parseIntParam(r, "limit", defaultDeliveriesLimit, 1, 10000)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := r.URL.Query()
+	res, err := webhooks.Deliveries(db, webhooks.DeliveryFilter{SubscriptionID: q.Get("subscription"), Status: q.Get("status"), Limit: limit})
+	if err != nil {
+		panic(err)
+	}
+	writeJSON(w, res)
+}
+
+// ReplayWebhooksHandler queues failed deliveries again, optionally of a single subscription only.
+func ReplayWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	db := requestcontext.DB(r.Context())
+	if db == nil {
+		panic(errors.New("Could not retrieve DB from context"))
+	}
+	n, err := webhooks.Replay(db, r.URL.Query().Get("subscription"))
+	if err != nil {
+		panic(err)
+	}
+	if dispatcher := requestcontext.Webhooks(r.Context()); dispatcher != nil {
+		dispatcher.Wake()
+	}
+	writeJSON(w, map[string]int{"replayed": n})
+}
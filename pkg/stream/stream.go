@@ -0,0 +1,279 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+var collections = []string{documents.CountryCollection, documents.StateCollection}
+
+// Event new datapoint committed to the DB.
+type Event struct {
+	ID         string              `json:"id"`
+	Collection string              `json:"collection"` // lower case, e.g. "countries"
+	Code       string              `json:"code"`
+	Datapoint  documents.DataEntry `json:"datapoint"`
+}
+
+// NewEvent creates an event of the datapoint stored in the collection under the bucket key.
+func NewEvent(collection string, code string, doc documents.DataEntry) Event {
+	p := Position{When: doc.GetWhen(), Collection: strings.ToLower(collection), Code: code}
+	return Event{ID: p.String(), Collection: p.Collection, Code: code, Datapoint: doc}
+}
+
+// Position of an event in the stream. Events are ordered by datapoint time, collection and code.
+type Position struct {
+	When       time.Time
+	Collection string
+	Code       string
+}
+
+// String event ID of the position, the bolt key of the datapoint followed by collection and code.
+func (p Position) String() string {
+	return p.When.UTC().Format(time.RFC3339) + "/" + p.Collection + "/" + p.Code
+}
+
+// Before tells whether p goes before o in the stream.
+func (p Position) Before(o Position) bool {
+	if !p.When.Equal(o.When) {
+		return p.When.Before(o.When)
+	}
+	if p.Collection != o.Collection {
+		return p.Collection < o.Collection
+	}
+	return p.Code < o.Code
+}
+
+// ParseID parses event ID back to the position.
+func ParseID(id string) (Position, error) {
+	parts := strings.SplitN(id, "/", 3)
+	if len(parts) != 3 {
+		return Position{}, errors.Errorf("malformed event ID %q", id)
+	}
+	when, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return Position{}, errors.Wrapf(err, "malformed event ID %q", id)
+	}
+	return Position{When: when.UTC(), Collection: parts[1], Code: parts[2]}, nil
+}
+
+func (e Event) position() Position {
+	return Position{When: e.Datapoint.GetWhen(), Collection: e.Collection, Code: e.Code}
+}
+
+// Filter selects events by collection and code, empty sets match everything.
+type Filter struct {
+	Collections map[string]bool // lower case
+	Codes       map[string]bool
+}
+
+// Match tells whether the event passes the filter.
+func (f Filter) Match(e Event) bool {
+	if len(f.Collections) > 0 && !f.Collections[e.Collection] {
+		return false
+	}
+	if len(f.Codes) > 0 && !f.Codes[e.Code] {
+		return false
+	}
+	return true
+}
+
+// Subscription live events of a single client.
+type Subscription struct {
+	events chan Event
+	filter Filter
+	lagged bool
+}
+
+// Events delivers the events, the channel is closed once the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged tells whether the subscription was dropped for not keeping up; read it after Events got closed.
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// Broker fans out events to subscribers. Publishing never blocks: a subscriber whose buffer is full
+// is dropped and expected to reconnect, resuming from the last event it got.
+type Broker struct {
+	mu     sync.Mutex
+	buffer int
+	subs   map[*Subscription]struct{}
+}
+
+// NewBroker creates a broker buffering up to buffer events per subscriber.
+func NewBroker(buffer int) *Broker {
+	return &Broker{buffer: buffer, subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe starts delivering events matching the filter.
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	s := &Subscription{events: make(chan Event, b.buffer), filter: filter}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe stops delivering events, it is safe to call more than once.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+func (b *Broker) remove(s *Subscription) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	close(s.events)
+}
+
+// Subscribers number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Publish delivers events to the matching subscribers.
+func (b *Broker) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		for _, e := range events {
+			if !s.filter.Match(e) {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				s.lagged = true
+				b.remove(s)
+			}
+			if s.lagged {
+				break
+			}
+		}
+	}
+}
+
+// PublishSaved reads back docs just saved and publishes the ones that made it into their series.
+func (b *Broker) PublishSaved(db *bolt.DB, docs []documents.CollectionEntry) error {
+	events, err := Saved(db, docs)
+	if err != nil {
+		return err
+	}
+	b.Publish(events...)
+	return nil
+}
+
+// Saved returns events of the docs that are stored as is. Rejected and quarantined docs are left out,
+// reading back keeps events right about aliases.
+func Saved(db *bolt.DB, docs []documents.CollectionEntry) ([]Event, error) {
+	res := []Event{}
+	err := db.View(func(tx *bolt.Tx) error {
+		seen := map[string]bool{}
+		for _, doc := range docs {
+			bucketKey := documents.ResolveAlias(tx, documents.Key(doc.GetName()))
+			bucket := tx.Bucket([]byte(bucketKey))
+			if bucketKey == "" || bucket == nil {
+				continue
+			}
+			collection, ok := documents.CollectionOf(tx, bucketKey)
+			if !ok {
+				continue
+			}
+			body, err := json.Marshal(doc)
+			if err != nil {
+				return errors.Wrap(err, "JSON marshal error")
+			}
+			stored := bucket.Get([]byte(doc.GetWhen().Format(time.RFC3339)))
+			if !bytes.Equal(stored, body) {
+				continue
+			}
+			entry, err := documents.NoValidationsParse(stored)
+			if err != nil {
+				return errors.Wrapf(err, "error decoding %s", bucketKey)
+			}
+			e := NewEvent(collection, bucketKey, entry)
+			if seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			res = append(res, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading saved datapoints")
+	}
+	return res, nil
+}
+
+// Since reads events after the position that match the filter, oldest first, at most limit of them.
+// With a limit, each bucket is read only as far as its events can still make it into the result.
+func Since(db *bolt.DB, after Position, filter Filter, limit int) ([]Event, error) {
+	res := []Event{}
+	min := []byte(after.When.UTC().Format(time.RFC3339))
+	full := func() bool {
+		return limit > 0 && len(res) >= limit
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, collection := range collections {
+			for _, k := range documents.ListKeys(tx, collection) {
+				probe := Event{Collection: strings.ToLower(collection), Code: k}
+				if !filter.Match(probe) {
+					continue
+				}
+				bucket := tx.Bucket([]byte(k))
+				if bucket == nil {
+					continue
+				}
+				read := 0
+				c := bucket.Cursor()
+				for key, v := c.Seek(min); key != nil && (limit <= 0 || read < limit); key, v = c.Next() {
+					doc, err := documents.NoValidationsParse(v)
+					if err != nil {
+						return errors.Wrapf(err, "error decoding %s/%s", k, key)
+					}
+					e := NewEvent(collection, k, doc)
+					if !after.Before(e.position()) {
+						continue
+					}
+					if full() && !e.position().Before(res[len(res)-1].position()) {
+						break
+					}
+					res = append(res, e)
+					read++
+				}
+				sortEvents(res)
+				if full() {
+					res = res[:limit]
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading datapoints to resume from")
+	}
+	return res, nil
+}
+
+func sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].position().Before(events[j].position())
+	})
+}
@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entry(name string, day int, cases uint64) documents.DataEntry {
+	return documents.DataEntry{Name: name, When: time.Date(2020, 6, day, 0, 0, 0, 0, time.UTC), Cases: cases}
+}
+
+// rejectSmall rejects datapoints with less than 10 cases.
+type rejectSmall struct{}
+
+func (rejectSmall) Validate(tx *bolt.Tx, bucketKey string, doc documents.CollectionEntry) (documents.Verdict, error) {
+	if doc.(documents.DataEntry).Cases < 10 {
+		return documents.Rejected, nil
+	}
+	return documents.Accepted, nil
+}
+
+func ids(events []Event) []string {
+	res := []string{}
+	for _, e := range events {
+		res = append(res, e.ID)
+	}
+	return res
+}
+
+func TestSavedAndSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	countries := []documents.CollectionEntry{entry("USA", 1, 10), entry("USA", 2, 20), entry("Italy", 2, 5)}
+	states := []documents.CollectionEntry{entry("California", 1, 7)}
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, countries, rejectSmall{}))
+	require.NoError(t, documents.BulkSave(db, documents.StateCollection, states, nil))
+
+	events, err := Saved(db, append(countries, states...))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2020-06-01T00:00:00Z/countries/usa", "2020-06-02T00:00:00Z/countries/usa", "2020-06-01T00:00:00Z/states/california"}, ids(events))
+
+	p, err := ParseID("2020-06-01T00:00:00Z/countries/usa")
+	require.NoError(t, err)
+	events, err = Since(db, p, Filter{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2020-06-01T00:00:00Z/states/california", "2020-06-02T00:00:00Z/countries/usa"}, ids(events))
+
+	events, err = Since(db, Position{}, Filter{Collections: map[string]bool{"countries": true}}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2020-06-01T00:00:00Z/countries/usa"}, ids(events))
+
+	events, err = Since(db, Position{}, Filter{}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2020-06-01T00:00:00Z/countries/usa", "2020-06-01T00:00:00Z/states/california"}, ids(events))
+
+	_, err = ParseID("2020-06-01/usa")
+	assert.Error(t, err)
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(2)
+	all := b.Subscribe(Filter{})
+	usa := b.Subscribe(Filter{Codes: map[string]bool{"usa": true}})
+	assert.Equal(t, 2, b.Subscribers())
+
+	events := []Event{
+		NewEvent(documents.CountryCollection, "usa", entry("USA", 1, 10)),
+		NewEvent(documents.CountryCollection, "italy", entry("Italy", 1, 10)),
+		NewEvent(documents.CountryCollection, "usa", entry("USA", 2, 20)),
+	}
+	b.Publish(events...)
+
+	// the slow subscriber is dropped once its buffer is full, the others keep going
+	assert.Equal(t, events[0], <-all.Events())
+	assert.Equal(t, events[1], <-all.Events())
+	_, more := <-all.Events()
+	assert.False(t, more)
+	assert.True(t, all.Lagged())
+
+	assert.Equal(t, events[0], <-usa.Events())
+	assert.Equal(t, events[2], <-usa.Events())
+	assert.False(t, usa.Lagged())
+	assert.Equal(t, 1, b.Subscribers())
+
+	b.Unsubscribe(usa)
+	b.Unsubscribe(usa)
+	assert.Equal(t, 0, b.Subscribers())
+}
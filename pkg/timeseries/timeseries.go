@@ -0,0 +1,206 @@
+package timeseries
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Day grid step most endpoints use.
+	Day = 24 * time.Hour
+	// DateLayout plain dates ParseTime accepts.
+	DateLayout = "2006-01-02"
+
+	maxStepDays = 100 * 366
+)
+
+// Point single observation.
+type Point struct {
+	When  time.Time
+	Value float64
+}
+
+// Mode how values between observations are filled in.
+type Mode string
+
+const (
+	// LOCF last observation carried forward.
+	LOCF = Mode("locf")
+	// Linear interpolation between surrounding observations, carried forward after the last one.
+	Linear = Mode("linear")
+)
+
+// ParseMode converts user input into Mode, empty string means LOCF.
+func ParseMode(v string) (Mode, error) {
+	switch m := Mode(v); m {
+	case "":
+		return LOCF, nil
+	case LOCF, Linear:
+		return m, nil
+	}
+	return "", errors.Errorf("unknown mode %s, expected %s or %s", v, LOCF, Linear)
+}
+
+// Metric extracts a value from the datapoint.
+type Metric func(documents.DataEntry) float64
+
+var metrics = map[string]Metric{
+	"cases":  func(d documents.DataEntry) float64 { return float64(d.Cases) },
+	"deaths": func(d documents.DataEntry) float64 { return float64(d.Deaths) },
+	"tests":  func(d documents.DataEntry) float64 { return float64(d.Tests) },
+}
+
+// ParseMetric returns the metric by name: cases, deaths or tests.
+func ParseMetric(name string) (Metric, error) {
+	if m, ok := metrics[name]; ok {
+		return m, nil
+	}
+	return nil, errors.Errorf("unknown metric %s, expected cases, deaths or tests", name)
+}
+
+// ParseStep parses durations like time.ParseDuration does, additionally accepting days, e.g. "1d" or "7d".
+func ParseStep(v string) (time.Duration, error) {
+	if v == "" {
+		return Day, nil
+	}
+	var step time.Duration
+	var err error
+	if strings.HasSuffix(v, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if days > maxStepDays {
+			// time.Duration would overflow
+			return 0, errors.Errorf("invalid step %s, expected at most %dd", v, maxStepDays)
+		}
+		step = time.Duration(days) * Day
+	} else {
+		step, err = time.ParseDuration(v)
+	}
+	if err != nil || step < time.Hour {
+		return 0, errors.Errorf("invalid step %s, expected e.g. 1d or 12h (at least 1h)", v)
+	}
+	return step, nil
+}
+
+// ParseTime accepts RFC3339 timestamps and plain dates. Plain dates mean the start of that day (UTC),
+// or the end of it when endOfDay is set.
+func ParseTime(v string, endOfDay bool) (time.Time, error) {
+	if when, err := time.Parse(time.RFC3339, v); err == nil {
+		return when, nil
+	}
+	when, err := time.Parse(DateLayout, v)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%s is neither RFC3339 timestamp nor %s date", v, DateLayout)
+	}
+	if endOfDay {
+		return when.Add(Day - time.Second), nil
+	}
+	return when, nil
+}
+
+// FromEntries converts datapoints into points of the given metric.
+func FromEntries(docs []documents.DataEntry, metric Metric) []Point {
+	res := make([]Point, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, Point{When: doc.GetWhen(), Value: metric(doc)})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].When.Before(res[j].When)
+	})
+	return res
+}
+
+// gridStart day multiple steps start at midnight UTC.
+func gridStart(start time.Time, step time.Duration) time.Time {
+	start = start.UTC()
+	if step%Day == 0 {
+		start = start.Truncate(Day)
+	}
+	return start
+}
+
+// GridSize number of times Grid returns, without building the grid.
+func GridSize(start time.Time, end time.Time, step time.Duration) int {
+	start = gridStart(start, step)
+	if end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start)/step) + 1
+}
+
+// Grid returns evenly spaced times from start to end (inclusive).
+// Day multiple steps start at midnight UTC.
+func Grid(start time.Time, end time.Time, step time.Duration) []time.Time {
+	start = gridStart(start, step)
+	res := []time.Time{}
+	for t := start; !t.After(end); t = t.Add(step) {
+		res = append(res, t)
+	}
+	return res
+}
+
+// Resample puts points (oldest first) onto the grid. Grid times before the first observation get NaN.
+func Resample(points []Point, grid []time.Time, mode Mode) []float64 {
+	res := make([]float64, len(grid))
+	idx := 0
+	for i, t := range grid {
+		for idx < len(points) && !points[idx].When.After(t) {
+			idx++
+		}
+		// points[idx-1] is the last observation at or before t
+		switch {
+		case idx == 0:
+			res[i] = math.NaN()
+		case mode == Linear && idx < len(points):
+			prev, next := points[idx-1], points[idx]
+			span := next.When.Sub(prev.When).Seconds()
+			ratio := t.Sub(prev.When).Seconds() / span
+			res[i] = prev.Value + (next.Value-prev.Value)*ratio
+		default:
+			res[i] = points[idx-1].Value
+		}
+	}
+	return res
+}
+
+// Daily dates (midnight UTC) from the first to the last datapoint's day and the metric value reported by the end of each day.
+func Daily(docs []documents.DataEntry, metric Metric) ([]time.Time, []float64) {
+	points := FromEntries(docs, metric)
+	if len(points) == 0 {
+		return []time.Time{}, []float64{}
+	}
+	dates := Grid(points[0].When, points[len(points)-1].When, Day)
+	endOfDay := make([]time.Time, len(dates))
+	for i := range dates {
+		endOfDay[i] = dates[i].Add(Day - time.Nanosecond)
+	}
+	return dates, Resample(points, endOfDay, LOCF)
+}
+
+// FirstReaching returns the time of the first observation with value >= threshold.
+func FirstReaching(points []Point, threshold float64) (time.Time, bool) {
+	for _, p := range points {
+		if p.Value >= threshold {
+			return p.When, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Nullable converts NaN to nil, so values can be encoded as JSON.
+func Nullable(values []float64) []*float64 {
+	res := make([]*float64, len(values))
+	for i := range values {
+		if !math.IsNaN(values[i]) {
+			v := values[i]
+			res[i] = &v
+		}
+	}
+	return res
+}
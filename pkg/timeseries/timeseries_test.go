@@ -0,0 +1,78 @@
+package timeseries
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func at(hours int, value float64) Point {
+	return Point{When: t0.Add(time.Duration(hours) * time.Hour), Value: value}
+}
+
+func TestResample(t *testing.T) {
+	points := []Point{at(6, 10), at(30, 20), at(78, 40)}
+	grid := Grid(t0.Add(3*time.Hour), t0.Add(4*Day), Day)
+	require.Len(t, grid, 5)
+	assert.Equal(t, t0, grid[0], "day steps start at midnight")
+	assert.Equal(t, 5, GridSize(t0.Add(3*time.Hour), t0.Add(4*Day), Day))
+	assert.Equal(t, 4, GridSize(t0.Add(3*time.Hour), t0.Add(12*time.Hour), 3*time.Hour))
+	assert.Equal(t, 0, GridSize(t0.Add(Day), t0, Day))
+
+	locf := Resample(points, grid, LOCF)
+	assert.True(t, math.IsNaN(locf[0]))
+	assert.Equal(t, []float64{10, 20, 20, 40}, locf[1:])
+
+	linear := Resample(points, grid, Linear)
+	assert.True(t, math.IsNaN(linear[0]))
+	assert.InDelta(t, 17.5, linear[1], 1e-9)
+	assert.InDelta(t, 27.5, linear[2], 1e-9)
+	assert.InDelta(t, 37.5, linear[3], 1e-9)
+	assert.InDelta(t, 40, linear[4], 1e-9, "carried forward after the last observation")
+
+	nullable := Nullable(locf)
+	assert.Nil(t, nullable[0])
+	assert.Equal(t, 10.0, *nullable[1])
+}
+
+func TestParseStep(t *testing.T) {
+	step, err := ParseStep("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*Day, step)
+	step, err = ParseStep("12h")
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, step)
+	_, err = ParseStep("1m")
+	assert.Error(t, err)
+	_, err = ParseStep("d")
+	assert.Error(t, err)
+	_, err = ParseStep("213505d")
+	assert.Error(t, err, "wraps around to a day")
+}
+
+func TestParseTime(t *testing.T) {
+	when, err := ParseTime("2020-06-01T12:00:00Z", true)
+	require.NoError(t, err)
+	assert.Equal(t, t0.Add(12*time.Hour), when)
+	when, err = ParseTime("2020-06-01", false)
+	require.NoError(t, err)
+	assert.Equal(t, t0, when)
+	when, err = ParseTime("2020-06-01", true)
+	require.NoError(t, err)
+	assert.Equal(t, t0.Add(Day-time.Second), when)
+	_, err = ParseTime("June 1", false)
+	assert.Error(t, err)
+}
+
+func TestFirstReaching(t *testing.T) {
+	when, ok := FirstReaching([]Point{at(0, 50), at(24, 99), at(48, 120)}, 100)
+	require.True(t, ok)
+	assert.Equal(t, t0.Add(48*time.Hour), when)
+	_, ok = FirstReaching([]Point{at(0, 50)}, 100)
+	assert.False(t, ok)
+}
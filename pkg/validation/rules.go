@@ -0,0 +1,133 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mkorenkov/covid-19/pkg/documents"
+)
+
+const (
+	// NonDecreasingRule cumulative totals must not go down.
+	NonDecreasingRule = "non_decreasing"
+	// DeathsNotAboveCasesRule deaths can not exceed cases.
+	DeathsNotAboveCasesRule = "deaths_le_cases"
+	// SpikeRule day-over-day growth must stay within N sigma of the recent growth.
+	SpikeRule = "spike"
+
+	// spikeMinSamples how many growth rates are needed before the spike rule kicks in.
+	spikeMinSamples = 5
+	day             = 24 * 60 * 60
+)
+
+// NonDecreasing checks that cumulative totals never decrease compared to the previous datapoint.
+// Tests are not always reported, so zero tests is not considered a decrease.
+type NonDecreasing struct{}
+
+// Name implements Rule.
+func (NonDecreasing) Name() string {
+	return NonDecreasingRule
+}
+
+// Check implements Rule.
+func (NonDecreasing) Check(history []documents.DataEntry, doc documents.DataEntry) string {
+	if len(history) == 0 {
+		return ""
+	}
+	prev := history[len(history)-1]
+	switch {
+	case doc.Cases < prev.Cases:
+		return fmt.Sprintf("total cases decreased from %d to %d", prev.Cases, doc.Cases)
+	case doc.Deaths < prev.Deaths:
+		return fmt.Sprintf("total deaths decreased from %d to %d", prev.Deaths, doc.Deaths)
+	case doc.Tests != 0 && doc.Tests < prev.Tests:
+		return fmt.Sprintf("total tests decreased from %d to %d", prev.Tests, doc.Tests)
+	}
+	return ""
+}
+
+// DeathsNotAboveCases checks deaths ≤ cases.
+type DeathsNotAboveCases struct{}
+
+// Name implements Rule.
+func (DeathsNotAboveCases) Name() string {
+	return DeathsNotAboveCasesRule
+}
+
+// Check implements Rule.
+func (DeathsNotAboveCases) Check(history []documents.DataEntry, doc documents.DataEntry) string {
+	if doc.Deaths > doc.Cases {
+		return fmt.Sprintf("total deaths %d exceed total cases %d", doc.Deaths, doc.Cases)
+	}
+	return ""
+}
+
+// Spike flags datapoints where daily growth of cases or deaths is more than Sigma standard deviations
+// above the mean daily growth of the preceding datapoints.
+type Spike struct {
+	Sigma float64
+}
+
+// Name implements Rule.
+func (Spike) Name() string {
+	return SpikeRule
+}
+
+// Check implements Rule.
+func (s Spike) Check(history []documents.DataEntry, doc documents.DataEntry) string {
+	if s.Sigma <= 0 || len(history) < spikeMinSamples+1 {
+		return ""
+	}
+	cases := func(d documents.DataEntry) uint64 { return d.Cases }
+	deaths := func(d documents.DataEntry) uint64 { return d.Deaths }
+	if msg := s.check("cases", cases, history, doc); msg != "" {
+		return msg
+	}
+	return s.check("deaths", deaths, history, doc)
+}
+
+func (s Spike) check(metric string, value func(documents.DataEntry) uint64, history []documents.DataEntry, doc documents.DataEntry) string {
+	rates := []float64{}
+	for i := 1; i < len(history); i++ {
+		if rate, ok := dailyRate(value, history[i-1], history[i]); ok {
+			rates = append(rates, rate)
+		}
+	}
+	if len(rates) < spikeMinSamples {
+		return ""
+	}
+	rate, ok := dailyRate(value, history[len(history)-1], doc)
+	if !ok {
+		return ""
+	}
+	mean, stddev := meanStddev(rates)
+	if stddev == 0 {
+		return ""
+	}
+	if rate > mean+s.Sigma*stddev {
+		return fmt.Sprintf("daily %s growth %.0f is %.1f sigma above the mean %.0f", metric, rate, (rate-mean)/stddev, mean)
+	}
+	return ""
+}
+
+// dailyRate growth between two datapoints normalized to a day.
+func dailyRate(value func(documents.DataEntry) uint64, prev documents.DataEntry, next documents.DataEntry) (float64, bool) {
+	elapsed := next.When.Sub(prev.When).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (float64(value(next)) - float64(value(prev))) * day / elapsed, true
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
@@ -0,0 +1,207 @@
+package validation
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/pkg/errors"
+)
+
+// historySize how many preceding datapoints rules get to look at.
+const historySize = 30
+
+// Level how serious a rule violation is.
+type Level string
+
+const (
+	// Warn flags the datapoint, but still stores it in the series.
+	Warn = Level("warn")
+	// Quarantine flags the datapoint and keeps it out of the series.
+	Quarantine = Level("quarantine")
+	// Reject flags the datapoint and drops it.
+	Reject = Level("reject")
+)
+
+// ParseLevel converts configuration value into Level.
+func ParseLevel(v string) (Level, error) {
+	switch l := Level(v); l {
+	case Warn, Quarantine, Reject:
+		return l, nil
+	}
+	return "", errors.Errorf("unknown validation level %q", v)
+}
+
+func (l Level) verdict() documents.Verdict {
+	switch l {
+	case Quarantine:
+		return documents.Quarantined
+	case Reject:
+		return documents.Rejected
+	}
+	return documents.Accepted
+}
+
+// Flag single rule violation recorded for a datapoint.
+type Flag struct {
+	Rule    string `json:"rule"`
+	Level   Level  `json:"level"`
+	Message string `json:"message"`
+}
+
+// Rule checks a datapoint against the datapoints preceding it (oldest first).
+// Returns an empty string when the datapoint is fine, otherwise describes the violation.
+type Rule interface {
+	Name() string
+	Check(history []documents.DataEntry, doc documents.DataEntry) string
+}
+
+// Flagged datapoint along with the flags it raised.
+type Flagged struct {
+	BucketKey string
+	Datapoint documents.DataEntry
+	Flags     []Flag
+	Verdict   documents.Verdict
+}
+
+// Validator runs all rules against the incoming datapoints and records flags on violations.
+type Validator struct {
+	rules  []Rule
+	levels map[string]Level
+
+	// OnFlagged is optionally called for each flagged datapoint once its transaction commits.
+	OnFlagged func(Flagged)
+}
+
+// New creates Validator with the default rules. levels maps rule names to "warn", "quarantine" or "reject",
+// rules not mentioned keep their default level.
+func New(levels map[string]string, spikeSigma float64) (*Validator, error) {
+	v := &Validator{
+		rules: []Rule{
+			NonDecreasing{},
+			DeathsNotAboveCases{},
+			Spike{Sigma: spikeSigma},
+		},
+		levels: map[string]Level{
+			NonDecreasingRule:       Warn,
+			DeathsNotAboveCasesRule: Quarantine,
+			SpikeRule:               Warn,
+		},
+	}
+	for rule, level := range levels {
+		if _, ok := v.levels[rule]; !ok {
+			return nil, errors.Errorf("unknown validation rule %q", rule)
+		}
+		l, err := ParseLevel(level)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid level for %s", rule)
+		}
+		v.levels[rule] = l
+	}
+	return v, nil
+}
+
+// Check runs all the rules and returns the flags raised for the datapoint.
+func (v *Validator) Check(history []documents.DataEntry, doc documents.DataEntry) []Flag {
+	flags := []Flag{}
+	for _, rule := range v.rules {
+		if msg := rule.Check(history, doc); msg != "" {
+			flags = append(flags, Flag{
+				Rule:    rule.Name(),
+				Level:   v.levels[rule.Name()],
+				Message: msg,
+			})
+		}
+	}
+	return flags
+}
+
+// Validate implements documents.Validator. Flags are stored in documents.FlagsBucket.
+func (v *Validator) Validate(tx *bolt.Tx, bucketKey string, doc documents.CollectionEntry) (documents.Verdict, error) {
+	entry, ok := doc.(documents.DataEntry)
+	if !ok {
+		if ptr, isPtr := doc.(*documents.DataEntry); isPtr && ptr != nil {
+			entry = *ptr
+		} else {
+			return documents.Accepted, nil
+		}
+	}
+	history, err := readHistory(tx, bucketKey, doc.GetWhen())
+	if err != nil {
+		return documents.Accepted, err
+	}
+	flags := v.Check(history, entry)
+	if len(flags) == 0 {
+		return documents.Accepted, nil
+	}
+	if err := documents.PutNested(tx, documents.FlagsBucket, bucketKey, doc.GetWhen(), flags); err != nil {
+		return documents.Accepted, errors.Wrap(err, "error saving validation flags")
+	}
+	verdict := documents.Accepted
+	for _, flag := range flags {
+		if fv := flag.Level.verdict(); fv > verdict {
+			verdict = fv
+		}
+	}
+	if v.OnFlagged != nil {
+		flagged := Flagged{BucketKey: bucketKey, Datapoint: entry, Flags: flags, Verdict: verdict}
+		tx.OnCommit(func() {
+			v.OnFlagged(flagged)
+		})
+	}
+	return verdict, nil
+}
+
+// readHistory reads up to historySize datapoints stored strictly before when, oldest first.
+func readHistory(tx *bolt.Tx, bucketKey string, when time.Time) ([]documents.DataEntry, error) {
+	bucket := tx.Bucket([]byte(bucketKey))
+	if bucket == nil {
+		return nil, nil
+	}
+	whenKey := []byte(when.UTC().Format(time.RFC3339))
+
+	c := bucket.Cursor()
+	k, v := c.Seek(whenKey)
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	res := []documents.DataEntry{}
+	for ; k != nil && len(res) < historySize; k, v = c.Prev() {
+		entry, err := documents.NoValidationsParse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding %s/%s", bucketKey, k)
+		}
+		res = append(res, entry)
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, nil
+}
+
+// Flags returns validation flags recorded for the given bucket keyed by datapoint timestamp.
+func Flags(db *bolt.DB, bucketKey string) (map[string][]Flag, error) {
+	res := map[string][]Flag{}
+	err := db.View(func(tx *bolt.Tx) error {
+		top := tx.Bucket([]byte(documents.FlagsBucket))
+		if top == nil {
+			return nil
+		}
+		bucket := top.Bucket([]byte(documents.ResolveAlias(tx, bucketKey)))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			flags := []Flag{}
+			if err := json.Unmarshal(v, &flags); err != nil {
+				return errors.Wrapf(err, "error decoding flags %s/%s", bucketKey, k)
+			}
+			res[string(k)] = flags
+			return nil
+		})
+	})
+	return res, err
+}
@@ -0,0 +1,97 @@
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func series(cases ...uint64) []documents.DataEntry {
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	res := []documents.DataEntry{}
+	for i, c := range cases {
+		res = append(res, documents.DataEntry{Name: "Ukraine", When: start.Add(time.Duration(i) * 24 * time.Hour), Cases: c, Deaths: c / 50})
+	}
+	return res
+}
+
+func TestRules(t *testing.T) {
+	history := series(100, 110, 121, 130, 142, 151, 160)
+	next := func(cases uint64, deaths uint64) documents.DataEntry {
+		return documents.DataEntry{Name: "Ukraine", When: history[len(history)-1].When.Add(24 * time.Hour), Cases: cases, Deaths: deaths}
+	}
+
+	assert.Empty(t, NonDecreasing{}.Check(history, next(170, 3)))
+	assert.NotEmpty(t, NonDecreasing{}.Check(history, next(150, 3)))
+	assert.NotEmpty(t, NonDecreasing{}.Check(history, next(170, 1)))
+	assert.Empty(t, NonDecreasing{}.Check(nil, next(1, 0)))
+
+	assert.Empty(t, DeathsNotAboveCases{}.Check(history, next(170, 170)))
+	assert.NotEmpty(t, DeathsNotAboveCases{}.Check(history, next(170, 171)))
+
+	spike := Spike{Sigma: 4}
+	assert.Empty(t, spike.Check(history, next(171, 3)))
+	assert.NotEmpty(t, spike.Check(history, next(400, 3)))
+	assert.Empty(t, spike.Check(history[:3], next(400, 3)), "not enough history")
+}
+
+func TestNewLevels(t *testing.T) {
+	_, err := New(map[string]string{"unknown": "warn"}, 6)
+	require.Error(t, err)
+	_, err = New(map[string]string{SpikeRule: "ignore"}, 6)
+	require.Error(t, err)
+
+	v, err := New(map[string]string{NonDecreasingRule: "reject"}, 6)
+	require.NoError(t, err)
+	flags := v.Check(series(100), series(100, 90)[1])
+	require.Len(t, flags, 1)
+	assert.Equal(t, Reject, flags[0].Level)
+}
+
+func TestValidateStoresFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	v, err := New(nil, 6)
+	require.NoError(t, err)
+	flagged := []Flagged{}
+	v.OnFlagged = func(f Flagged) {
+		flagged = append(flagged, f)
+	}
+
+	docs := []documents.CollectionEntry{}
+	for _, doc := range series(100, 110, 90) {
+		docs = append(docs, doc)
+	}
+	badDeaths := series(0, 0, 0, 120)[3]
+	badDeaths.Deaths = 500
+	docs = append(docs, badDeaths)
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs, v))
+
+	flags, err := Flags(db, "ukraine")
+	require.NoError(t, err)
+	require.Len(t, flags, 2)
+	assert.Equal(t, NonDecreasingRule, flags[docs[2].GetWhen().Format(time.RFC3339)][0].Rule)
+	assert.Equal(t, Quarantine, flags[badDeaths.GetWhen().Format(time.RFC3339)][0].Level)
+	require.Len(t, flagged, 2)
+	assert.Equal(t, "ukraine", flagged[1].BucketKey)
+	assert.Equal(t, documents.Quarantined, flagged[1].Verdict)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 3, tx.Bucket([]byte("ukraine")).Stats().KeyN)
+		assert.NotNil(t, tx.Bucket([]byte(documents.QuarantineBucket)).Bucket([]byte("ukraine")))
+		return nil
+	})
+	require.NoError(t, err)
+}
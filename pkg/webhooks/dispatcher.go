@@ -0,0 +1,343 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/httpclient"
+	"github.com/mkorenkov/covid-19/pkg/metrics"
+	"github.com/mkorenkov/covid-19/pkg/stream"
+	"github.com/mkorenkov/covid-19/pkg/validation"
+	"github.com/pkg/errors"
+)
+
+const (
+	eventsBufferSize = 256
+	streamBufferSize = 4096
+	pendingBatch     = 100
+	pollInterval     = time.Minute
+	pruneInterval    = time.Hour
+	maxAttempts      = 8
+	retryBackoff     = 30 * time.Second
+	maxRetryBackoff  = time.Hour
+)
+
+// nextAttemptIn backoff after the failed attempt, doubling up to maxRetryBackoff.
+func nextAttemptIn(attempts int) time.Duration {
+	res := retryBackoff
+	for i := 1; i < attempts && res < maxRetryBackoff; i++ {
+		res *= 2
+	}
+	if res > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return res
+}
+
+// deliveries webhook delivery attempts by result.
+var deliveries = metrics.NewCounter("coviddy_webhook_deliveries_total", "Webhook delivery attempts by result.", "result")
+
+func init() {
+	metrics.Default.Register(deliveries)
+}
+
+// Dispatcher turns new datapoints, scrape failures and validation flags into webhook deliveries
+// and sends them out.
+type Dispatcher struct {
+	db        *bolt.DB
+	broker    *stream.Broker
+	client    httpclient.HTTPClient
+	retention time.Duration
+	events    chan Event
+	wake      chan struct{}
+	now       func() time.Time
+}
+
+// NewDispatcher creates a dispatcher. New datapoints come from the broker, delivered events are kept
+// in the delivery log for retention. The client should not retry: httpclient.Retryable backs off in place,
+// which would hold up all other deliveries while one endpoint is down. Failed attempts are rescheduled
+// in the delivery log instead, see nextAttemptIn.
+func NewDispatcher(db *bolt.DB, broker *stream.Broker, client httpclient.HTTPClient, retention time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:        db,
+		broker:    broker,
+		client:    client,
+		retention: retention,
+		events:    make(chan Event, eventsBufferSize),
+		wake:      make(chan struct{}, 1),
+		now:       time.Now,
+	}
+}
+
+// Emit queues the event without blocking the caller.
+func (d *Dispatcher) Emit(e Event) {
+	select {
+	case d.events <- e:
+	default:
+		log.Printf("[ERROR] webhook events queue is full, dropping %s %s\n", e.Type, e.ID)
+	}
+}
+
+// Wake makes the dispatcher look for pending deliveries right away, e.g. after a replay.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ScrapeFailed emits scrape_failed event.
+func (d *Dispatcher) ScrapeFailed(collection string, err error) {
+	now := time.Now().UTC()
+	d.Emit(Event{
+		ID:         ScrapeFailedEvent + "/" + now.Format(time.RFC3339Nano),
+		Type:       ScrapeFailedEvent,
+		When:       now,
+		Collection: strings.ToLower(collection),
+		Scraper:    strings.ToLower(collection),
+		Error:      err.Error(),
+	})
+}
+
+// Flagged emits validation_flag event, meant for validation.Validator.OnFlagged.
+func (d *Dispatcher) Flagged(f validation.Flagged) {
+	datapoint := f.Datapoint
+	d.Emit(Event{
+		ID:        ValidationFlagEvent + "/" + datapoint.GetWhen().Format(time.RFC3339) + "/" + f.BucketKey,
+		Type:      ValidationFlagEvent,
+		When:      time.Now().UTC(),
+		Code:      f.BucketKey,
+		Datapoint: &datapoint,
+		Flags:     f.Flags,
+		Verdict:   f.Verdict.String(),
+	})
+}
+
+func datapointEvent(e stream.Event) Event {
+	datapoint := e.Datapoint
+	return Event{
+		ID:         DatapointEvent + "/" + e.ID,
+		Type:       DatapointEvent,
+		When:       time.Now().UTC(),
+		Collection: e.Collection,
+		Code:       e.Code,
+		Datapoint:  &datapoint,
+	}
+}
+
+func (d *Dispatcher) enqueue(events []Event, errorChan chan<- error) {
+	n, err := enqueue(d.db, events, time.Now())
+	if err != nil {
+		errorChan <- err
+		return
+	}
+	if n > 0 {
+		d.Wake()
+	}
+}
+
+// drain takes the events already waiting on the subscription, so a whole scrape is enqueued at once.
+// more is false once the subscription got closed.
+func drain(sub *stream.Subscription, events []stream.Event) (res []stream.Event, more bool) {
+	for len(events) < streamBufferSize {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return events, false
+			}
+			events = append(events, e)
+		default:
+			return events, true
+		}
+	}
+	return events, true
+}
+
+// Run collects events and delivers them until the context is done.
+func (d *Dispatcher) Run(ctx context.Context, errorChan chan<- error) {
+	go d.deliverLoop(ctx, errorChan)
+
+	sub := d.broker.Subscribe(stream.Filter{})
+	defer func() {
+		d.broker.Unsubscribe(sub)
+	}()
+	last := stream.Position{When: time.Now().UTC()}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-d.events:
+			d.enqueue([]Event{e}, errorChan)
+		case e, more := <-sub.Events():
+			received := []stream.Event{}
+			if more {
+				received, more = drain(sub, []stream.Event{e})
+			}
+			events := []Event{}
+			for _, e := range received {
+				if p, err := stream.ParseID(e.ID); err == nil && last.Before(p) {
+					last = p
+				}
+				events = append(events, datapointEvent(e))
+			}
+			if !more {
+				// fell behind: catch up from the DB, the same way stream clients resume
+				sub = d.broker.Subscribe(stream.Filter{})
+				missed, err := stream.Since(d.db, last, stream.Filter{}, 0)
+				if err != nil {
+					errorChan <- err
+				}
+				for _, e := range missed {
+					if p, err := stream.ParseID(e.ID); err == nil && last.Before(p) {
+						last = p
+					}
+					events = append(events, datapointEvent(e))
+				}
+				log.Printf("[INFO] webhooks caught up on %d datapoints\n", len(missed))
+			}
+			if len(events) > 0 {
+				d.enqueue(events, errorChan)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliverLoop(ctx context.Context, errorChan chan<- error) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-prune.C:
+			if _, err := Prune(d.db, time.Now().Add(-d.retention)); err != nil {
+				errorChan <- err
+			}
+		case <-poll.C:
+		case <-d.wake:
+		}
+		if err := d.DeliverPending(ctx); err != nil {
+			errorChan <- err
+		}
+	}
+}
+
+// DeliverPending makes one attempt at each pending delivery that is due. A failed attempt is retried
+// with backoff up to maxAttempts times, later deliveries to the same subscription wait for the next pass.
+func (d *Dispatcher) DeliverPending(ctx context.Context) error {
+	now := d.now()
+	blocked := map[string]bool{} // subscriptions with a delivery waiting for a retry
+	after := ""
+	for {
+		batch, err := pending(d.db, after, pendingBatch)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		subs := map[string]Subscription{}
+		err = d.db.View(func(tx *bolt.Tx) error {
+			all, err := readSubscriptions(tx)
+			for _, s := range all {
+				subs[s.ID] = s
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, delivery := range batch {
+			if ctx.Err() != nil {
+				return nil
+			}
+			after = delivery.ID
+			if blocked[delivery.SubscriptionID] {
+				continue
+			}
+			if delivery.NextAttempt != nil && delivery.NextAttempt.After(now) {
+				blocked[delivery.SubscriptionID] = true
+				continue
+			}
+			delivery.Attempts++
+			s, ok := subs[delivery.SubscriptionID]
+			if ok {
+				err = d.send(ctx, s, delivery)
+				if ctx.Err() != nil {
+					return nil
+				}
+			} else {
+				err = errors.Wrapf(SubscriptionNotFoundError, "subscription %s", delivery.SubscriptionID)
+			}
+			switch {
+			case err == nil:
+				deliveries.Inc(Delivered)
+				delivered := d.now().UTC()
+				delivery.Status = Delivered
+				delivery.LastError = ""
+				delivery.NextAttempt = nil
+				delivery.DeliveredAt = &delivered
+			case ok && delivery.Attempts < maxAttempts:
+				deliveries.Inc(Failed)
+				blocked[delivery.SubscriptionID] = true
+				next := now.Add(nextAttemptIn(delivery.Attempts)).UTC()
+				delivery.LastError = err.Error()
+				delivery.NextAttempt = &next
+				log.Printf("[INFO] webhook delivery %s to %s failed, retrying at %s: %s\n", delivery.ID, s.URL, next.Format(time.RFC3339), err)
+			default:
+				deliveries.Inc(Failed)
+				delivery.Status = Failed
+				delivery.LastError = err.Error()
+				delivery.NextAttempt = nil
+				log.Printf("[ERROR] webhook delivery %s to %s failed: %s\n", delivery.ID, s.URL, err)
+			}
+			err = d.db.Update(func(tx *bolt.Tx) error {
+				return putDelivery(tx, delivery)
+			})
+			if err != nil {
+				return errors.Wrap(err, "error updating webhook delivery")
+			}
+		}
+	}
+}
+
+// send POSTs the event, signed with the subscription secret.
+func (d *Dispatcher) send(ctx context.Context, s Subscription, delivery Delivery) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return errors.Wrap(err, "error encoding webhook event")
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error creating webhook request")
+	}
+	req = req.WithContext(ctx)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "coviddy-webhooks")
+	req.Header.Set("X-Coviddy-Event", delivery.Event.Type)
+	req.Header.Set("X-Coviddy-Delivery", delivery.ID)
+	req.Header.Set("X-Coviddy-Timestamp", timestamp)
+	req.Header.Set("X-Coviddy-Signature", Sign(s.Secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/validation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SubscriptionsBucket stores subscriptions keyed by ID.
+	SubscriptionsBucket = "Webhooks"
+	// DeliveriesBucket stores the delivery log keyed by sequence number.
+	DeliveriesBucket = "WebhookDeliveries"
+)
+
+// Event types.
+const (
+	DatapointEvent      = "datapoint"
+	ScrapeFailedEvent   = "scrape_failed"
+	ValidationFlagEvent = "validation_flag"
+	AlertEvent          = "alert"
+)
+
+// EventTypes all supported event types.
+var EventTypes = []string{DatapointEvent, ScrapeFailedEvent, ValidationFlagEvent, AlertEvent}
+
+// Delivery statuses.
+const (
+	Pending   = "pending"
+	Delivered = "delivered"
+	Failed    = "failed"
+)
+
+const (
+	// SubscriptionNotFoundError no subscription with the given ID.
+	SubscriptionNotFoundError = sentinelError("Subscription not found")
+	// InvalidSubscriptionError subscription URL or filters are not valid.
+	InvalidSubscriptionError = sentinelError("Invalid subscription")
+)
+
+type sentinelError string
+
+func (e sentinelError) Error() string {
+	return string(e)
+}
+
+// Event payload POSTed to the subscribers.
+type Event struct {
+	ID         string               `json:"id"`
+	Type       string               `json:"type"`
+	When       time.Time            `json:"when"`
+	Collection string               `json:"collection,omitempty"` // lower case, e.g. "countries"
+	Code       string               `json:"code,omitempty"`
+	Datapoint  *documents.DataEntry `json:"datapoint,omitempty"`
+	Flags      []validation.Flag    `json:"flags,omitempty"`   // validation_flag only
+	Verdict    string               `json:"verdict,omitempty"` // validation_flag only
+	Scraper    string               `json:"scraper,omitempty"` // scrape_failed only
+	Error      string               `json:"error,omitempty"`   // scrape_failed only
+	Alert      interface{}          `json:"alert,omitempty"`   // alert only
+}
+
+// Subscription where to send which events. Empty filters match everything.
+type Subscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"` // HMAC key, only shown on creation
+	Collections []string  `json:"collections"`      // lower case
+	Names       []string  `json:"names"`            // bucket keys; scrape_failed events are not filtered by name
+	Events      []string  `json:"events"`
+	Created     time.Time `json:"created"`
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Match tells whether the subscription wants the event.
+func (s Subscription) Match(e Event) bool {
+	if len(s.Events) > 0 && !contains(s.Events, e.Type) {
+		return false
+	}
+	if len(s.Collections) > 0 && e.Collection != "" && !contains(s.Collections, e.Collection) {
+		return false
+	}
+	if len(s.Names) > 0 && e.Code != "" && !contains(s.Names, e.Code) {
+		return false
+	}
+	return true
+}
+
+// normalize validates the subscription and brings filters to their canonical form.
+func (s *Subscription) normalize() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("invalid webhook URL %q", s.URL)
+	}
+	for i, c := range s.Collections {
+		collection, err := documents.ParseCollection(c)
+		if err != nil {
+			return err
+		}
+		s.Collections[i] = strings.ToLower(collection)
+	}
+	for i, name := range s.Names {
+		s.Names[i] = documents.Key(name)
+	}
+	for _, e := range s.Events {
+		if !contains(EventTypes, e) {
+			return errors.Errorf("unknown event type %q, expected one of %s", e, strings.Join(EventTypes, ", "))
+		}
+	}
+	if s.Collections == nil {
+		s.Collections = []string{}
+	}
+	if s.Names == nil {
+		s.Names = []string{}
+	}
+	if s.Events == nil {
+		s.Events = []string{}
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error generating random ID")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Coviddy-Signature value: HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Create stores a new subscription. A secret is generated unless given.
+func Create(db *bolt.DB, s Subscription, now time.Time) (Subscription, error) {
+	if err := s.normalize(); err != nil {
+		return s, errors.Wrap(InvalidSubscriptionError, err.Error())
+	}
+	var err error
+	if s.ID, err = randomHex(8); err != nil {
+		return s, err
+	}
+	if s.Secret == "" {
+		if s.Secret, err = randomHex(32); err != nil {
+			return s, err
+		}
+	}
+	s.Created = now.UTC()
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return s, errors.Wrap(err, "error encoding webhook subscription")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(SubscriptionsBucket))
+		if err != nil {
+			return errors.Wrapf(err, "error creating %s bucket", SubscriptionsBucket)
+		}
+		return bucket.Put([]byte(s.ID), payload)
+	})
+	return s, errors.Wrap(err, "error saving webhook subscription")
+}
+
+// Delete removes the subscription, its delivery log is kept.
+func Delete(db *bolt.DB, id string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(SubscriptionsBucket))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return errors.Wrapf(SubscriptionNotFoundError, "subscription %s", id)
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+func readSubscriptions(tx *bolt.Tx) ([]Subscription, error) {
+	res := []Subscription{}
+	bucket := tx.Bucket([]byte(SubscriptionsBucket))
+	if bucket == nil {
+		return res, nil
+	}
+	err := bucket.ForEach(func(k, v []byte) error {
+		s := Subscription{}
+		if err := json.Unmarshal(v, &s); err != nil {
+			return errors.Wrapf(err, "error decoding webhook subscription %s", k)
+		}
+		res = append(res, s)
+		return nil
+	})
+	return res, err
+}
+
+// List returns all subscriptions, oldest first, with secrets left out.
+func List(db *bolt.DB) ([]Subscription, error) {
+	var res []Subscription
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		res, err = readSubscriptions(tx)
+		return err
+	})
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	for i := range res {
+		res[i].Secret = ""
+	}
+	return res, err
+}
+
+// Delivery single event sent to a single subscription.
+type Delivery struct {
+	ID             string     `json:"id"`
+	SubscriptionID string     `json:"subscription_id"`
+	Event          Event      `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"` // a single request each
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttempt    *time.Time `json:"next_attempt,omitempty"` // pending deliveries that failed wait for it
+	Created        time.Time  `json:"created"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+func putDelivery(tx *bolt.Tx, d Delivery) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(DeliveriesBucket))
+	if err != nil {
+		return errors.Wrapf(err, "error creating %s bucket", DeliveriesBucket)
+	}
+	if d.ID == "" {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return errors.Wrap(err, "error generating delivery ID")
+		}
+		d.ID = fmt.Sprintf("%020d", seq)
+	}
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "error encoding webhook delivery")
+	}
+	return bucket.Put([]byte(d.ID), payload)
+}
+
+// withCollection fills in the collection of flagged datapoints, unknown at validation time.
+func withCollection(tx *bolt.Tx, e Event) Event {
+	if e.Collection != "" || e.Code == "" {
+		return e
+	}
+	if collection, ok := documents.CollectionOf(tx, e.Code); ok {
+		e.Collection = strings.ToLower(collection)
+	}
+	return e
+}
+
+// enqueue stores a pending delivery per event and matching subscription in a single transaction,
+// returns how many were stored. Nothing is written when no subscription matches.
+func enqueue(db *bolt.DB, events []Event, now time.Time) (int, error) {
+	matched := []Delivery{}
+	err := db.View(func(tx *bolt.Tx) error {
+		subs, err := readSubscriptions(tx)
+		if err != nil || len(subs) == 0 {
+			return err
+		}
+		for _, e := range events {
+			e = withCollection(tx, e)
+			for _, s := range subs {
+				if s.Match(e) {
+					matched = append(matched, Delivery{SubscriptionID: s.ID, Event: e, Status: Pending, Created: now.UTC()})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil || len(matched) == 0 {
+		return 0, errors.Wrap(err, "error enqueueing webhook deliveries")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, d := range matched {
+			if err := putDelivery(tx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "error enqueueing webhook deliveries")
+	}
+	return len(matched), nil
+}
+
+// DeliveryFilter selects deliveries, empty fields match everything.
+type DeliveryFilter struct {
+	SubscriptionID string
+	Status         string
+	Limit          int // newest first when set
+}
+
+func (f DeliveryFilter) match(d Delivery) bool {
+	return (f.SubscriptionID == "" || d.SubscriptionID == f.SubscriptionID) && (f.Status == "" || d.Status == f.Status)
+}
+
+// Deliveries reads the delivery log, newest first.
+func Deliveries(db *bolt.DB, f DeliveryFilter) ([]Delivery, error) {
+	res := []Delivery{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(DeliveriesBucket))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil && (f.Limit <= 0 || len(res) < f.Limit); k, v = c.Prev() {
+			d := Delivery{}
+			if err := json.Unmarshal(v, &d); err != nil {
+				return errors.Wrapf(err, "error decoding webhook delivery %s", k)
+			}
+			if f.match(d) {
+				res = append(res, d)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// pending reads up to limit pending deliveries after the delivery ID, oldest first.
+func pending(db *bolt.DB, after string, limit int) ([]Delivery, error) {
+	res := []Delivery{}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(DeliveriesBucket))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		k, v := c.First()
+		if after != "" {
+			if k, v = c.Seek([]byte(after)); k != nil && string(k) == after {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil && len(res) < limit; k, v = c.Next() {
+			d := Delivery{}
+			if err := json.Unmarshal(v, &d); err != nil {
+				return errors.Wrapf(err, "error decoding webhook delivery %s", k)
+			}
+			if d.Status == Pending {
+				res = append(res, d)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Replay marks failed deliveries, optionally of a single subscription, as pending again, with a new round of attempts.
+func Replay(db *bolt.DB, subscriptionID string) (int, error) {
+	n := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(DeliveriesBucket))
+		if bucket == nil {
+			return nil
+		}
+		failed := []Delivery{}
+		err := bucket.ForEach(func(k, v []byte) error {
+			d := Delivery{}
+			if err := json.Unmarshal(v, &d); err != nil {
+				return errors.Wrapf(err, "error decoding webhook delivery %s", k)
+			}
+			if d.Status == Failed && (subscriptionID == "" || d.SubscriptionID == subscriptionID) {
+				failed = append(failed, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range failed {
+			d.Status = Pending
+			d.Attempts = 0
+			d.NextAttempt = nil
+			if err := putDelivery(tx, d); err != nil {
+				return err
+			}
+		}
+		n = len(failed)
+		return nil
+	})
+	return n, errors.Wrap(err, "error replaying webhook deliveries")
+}
+
+// Prune removes deliveries that were delivered before the cutoff, failed ones are kept for replays.
+func Prune(db *bolt.DB, before time.Time) (int, error) {
+	n := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(DeliveriesBucket))
+		if bucket == nil {
+			return nil
+		}
+		old := [][]byte{}
+		err := bucket.ForEach(func(k, v []byte) error {
+			d := Delivery{}
+			if err := json.Unmarshal(v, &d); err != nil {
+				return errors.Wrapf(err, "error decoding webhook delivery %s", k)
+			}
+			if d.Status == Delivered && d.Created.Before(before) {
+				old = append(old, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range old {
+			if err := bucket.Delete(k); err != nil {
+				return errors.Wrapf(err, "error removing webhook delivery %s", k)
+			}
+		}
+		n = len(old)
+		return nil
+	})
+	return n, errors.Wrap(err, "error pruning webhook deliveries")
+}
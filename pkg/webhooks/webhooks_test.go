@@ -0,0 +1,232 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/mkorenkov/covid-19/pkg/documents"
+	"github.com/mkorenkov/covid-19/pkg/stream"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDB(t *testing.T) (*bolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "webhooks")
+	require.NoError(t, err)
+	db, err := bolt.Open(path.Join(dir, "test.db"), 0600, nil)
+	require.NoError(t, err)
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	_, err := Create(db, Subscription{URL: "ftp://example.com"}, time.Now())
+	assert.True(t, errors.Is(err, InvalidSubscriptionError))
+	_, err = Create(db, Subscription{URL: "https://example.com", Events: []string{"nope"}}, time.Now())
+	assert.True(t, errors.Is(err, InvalidSubscriptionError))
+
+	s, err := Create(db, Subscription{URL: "https://example.com/hook", Collections: []string{"Countries"}, Names: []string{"S. Korea"}}, time.Now())
+	require.NoError(t, err)
+	assert.NotEmpty(t, s.ID)
+	assert.Len(t, s.Secret, 64)
+	assert.Equal(t, []string{"countries"}, s.Collections)
+	assert.Equal(t, []string{"s_korea"}, s.Names)
+
+	assert.True(t, s.Match(Event{Type: DatapointEvent, Collection: "countries", Code: "s_korea"}))
+	assert.False(t, s.Match(Event{Type: DatapointEvent, Collection: "countries", Code: "usa"}))
+	assert.False(t, s.Match(Event{Type: DatapointEvent, Collection: "states", Code: "s_korea"}))
+	assert.True(t, s.Match(Event{Type: ScrapeFailedEvent, Collection: "countries"}))
+
+	all, err := List(db)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Empty(t, all[0].Secret)
+
+	require.NoError(t, Delete(db, s.ID))
+	assert.True(t, errors.Is(Delete(db, s.ID), SubscriptionNotFoundError))
+}
+
+func TestEnqueue(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	txID := func() int {
+		id := 0
+		db.View(func(tx *bolt.Tx) error {
+			id = tx.ID()
+			return nil
+		})
+		return id
+	}
+	events := []Event{
+		datapointEvent(stream.NewEvent(documents.CountryCollection, "usa", documents.DataEntry{Name: "USA"})),
+		datapointEvent(stream.NewEvent(documents.CountryCollection, "italy", documents.DataEntry{Name: "Italy"})),
+		datapointEvent(stream.NewEvent(documents.StateCollection, "california", documents.DataEntry{Name: "California"})),
+	}
+
+	before := txID()
+	n, err := enqueue(db, events, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, before, txID(), "nothing is written without subscriptions")
+
+	_, err = Create(db, Subscription{URL: "https://example.com/hook", Collections: []string{"countries"}}, time.Now())
+	require.NoError(t, err)
+	before = txID()
+	n, err = enqueue(db, events, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, before+1, txID(), "events are enqueued in a single transaction")
+}
+
+// receiver records signed requests, failing the first failures of them.
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	failures int
+	events   []Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	if Sign(rc.secret, r.Header.Get("X-Coviddy-Timestamp"), body) != r.Header.Get("X-Coviddy-Signature") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	e := Event{}
+	json.Unmarshal(body, &e)
+	rc.events = append(rc.events, e)
+}
+
+func (rc *receiver) received() []Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Event{}, rc.events...)
+}
+
+func TestDeliveryAndReplay(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	rc := &receiver{secret: "s3cret", failures: 1}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	s, err := Create(db, Subscription{URL: srv.URL, Secret: rc.secret, Events: []string{ScrapeFailedEvent}}, time.Now())
+	require.NoError(t, err)
+	d := NewDispatcher(db, stream.NewBroker(10), http.DefaultClient, time.Hour)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	d.enqueue([]Event{datapointEvent(stream.NewEvent(documents.CountryCollection, "usa", documents.DataEntry{Name: "USA"}))}, nil)
+	d.ScrapeFailed(documents.StateCollection, errors.New("worldometers is down"))
+	d.enqueue([]Event{<-d.events}, nil)
+	d.ScrapeFailed(documents.CountryCollection, errors.New("worldometers is still down"))
+	d.enqueue([]Event{<-d.events}, nil)
+	require.NoError(t, d.DeliverPending(context.Background()))
+
+	waiting, err := Deliveries(db, DeliveryFilter{Status: Pending})
+	require.NoError(t, err)
+	require.Len(t, waiting, 2)
+	assert.Equal(t, 0, waiting[0].Attempts, "later deliveries wait for the retry")
+	assert.Equal(t, 1, waiting[1].Attempts)
+	assert.Equal(t, "HTTP 500", waiting[1].LastError)
+	assert.Equal(t, now.Add(retryBackoff), *waiting[1].NextAttempt)
+
+	require.NoError(t, d.DeliverPending(context.Background()))
+	assert.Empty(t, rc.received(), "not due yet")
+
+	now = now.Add(retryBackoff)
+	require.NoError(t, d.DeliverPending(context.Background()))
+	events := rc.received()
+	require.Len(t, events, 2)
+	assert.Equal(t, ScrapeFailedEvent, events[0].Type)
+	assert.Equal(t, "states", events[0].Collection)
+	assert.Equal(t, "worldometers is down", events[0].Error)
+	assert.Equal(t, "countries", events[1].Collection)
+	delivered, err := Deliveries(db, DeliveryFilter{Status: Delivered})
+	require.NoError(t, err)
+	require.Len(t, delivered, 2)
+	assert.Equal(t, 2, delivered[1].Attempts)
+
+	rc.failures = maxAttempts
+	d.ScrapeFailed(documents.StateCollection, errors.New("worldometers is down again"))
+	d.enqueue([]Event{<-d.events}, nil)
+	for i := 0; i < maxAttempts; i++ {
+		require.NoError(t, d.DeliverPending(context.Background()))
+		now = now.Add(maxRetryBackoff)
+	}
+	failed, err := Deliveries(db, DeliveryFilter{Status: Failed})
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, s.ID, failed[0].SubscriptionID)
+	assert.Equal(t, maxAttempts, failed[0].Attempts)
+
+	n, err := Replay(db, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.NoError(t, d.DeliverPending(context.Background()))
+	assert.Len(t, rc.received(), 3)
+
+	n, err = Prune(db, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestNextAttemptIn(t *testing.T) {
+	assert.Equal(t, retryBackoff, nextAttemptIn(1))
+	assert.Equal(t, 4*retryBackoff, nextAttemptIn(3))
+	assert.Equal(t, maxRetryBackoff, nextAttemptIn(maxAttempts))
+}
+
+func TestRunDeliversNewDatapoints(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	rc := &receiver{secret: "s3cret"}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	_, err := Create(db, Subscription{URL: srv.URL, Secret: rc.secret, Names: []string{"USA"}}, time.Now())
+	require.NoError(t, err)
+
+	broker := stream.NewBroker(10)
+	d := NewDispatcher(db, broker, http.DefaultClient, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errorChan := make(chan error, 10)
+	go d.Run(ctx, errorChan)
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+
+	docs := []documents.CollectionEntry{
+		documents.DataEntry{Name: "USA", When: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), Cases: 10},
+		documents.DataEntry{Name: "Italy", When: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), Cases: 5},
+	}
+	require.NoError(t, documents.BulkSave(db, documents.CountryCollection, docs, nil))
+	require.NoError(t, broker.PublishSaved(db, docs))
+
+	require.Eventually(t, func() bool { return len(rc.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	e := rc.received()[0]
+	assert.Equal(t, DatapointEvent, e.Type)
+	assert.Equal(t, "usa", e.Code)
+	assert.Equal(t, uint64(10), e.Datapoint.Cases)
+	assert.Empty(t, errorChan)
+}